@@ -0,0 +1,52 @@
+package api
+
+import (
+	"fiber/store"
+	"fiber/types"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type AuditHandler struct {
+	auditStore store.AuditStore
+}
+
+func NewAuditHandler(auditStore store.AuditStore) *AuditHandler {
+	return &AuditHandler{
+		auditStore: auditStore,
+	}
+}
+
+// HandleGetAuditEvents lists audit events, newest first. Filters and paging
+// come from the actorId, targetId, action, from, to, limit and offset query params.
+func (h *AuditHandler) HandleGetAuditEvents(c *fiber.Ctx) error {
+	var filter types.AuditFilter
+	if err := c.QueryParser(&filter); err != nil {
+		return NewError(fiber.StatusBadRequest, "invalid query parameters")
+	}
+	errors := map[string]string{}
+	for name, dst := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if v := c.Query(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				errors[name] = fmt.Sprintf("%s should be an RFC 3339 timestamp", name)
+				continue
+			}
+			*dst = t
+		}
+	}
+	for k, v := range filter.Validate() {
+		errors[k] = v
+	}
+	if len(errors) > 0 {
+		return NewValidationError(errors)
+	}
+
+	events, err := h.auditStore.GetAuditEvents(c.UserContext(), filter)
+	if err != nil {
+		return err
+	}
+	return c.JSON(events)
+}
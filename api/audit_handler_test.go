@@ -0,0 +1,71 @@
+package api
+
+import (
+	"context"
+	"fiber/types"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type auditStoreFunc func(context.Context, types.AuditFilter) ([]*types.AuditEvent, error)
+
+func (f auditStoreFunc) RecordAuditEvent(context.Context, *types.AuditEvent) error {
+	return nil
+}
+
+func (f auditStoreFunc) GetAuditEvents(ctx context.Context, filter types.AuditFilter) ([]*types.AuditEvent, error) {
+	return f(ctx, filter)
+}
+
+func TestHandleGetAuditEventsFilter(t *testing.T) {
+	var got types.AuditFilter
+	app := fiber.New(fiber.Config{
+		ErrorHandler: ErrorHandler,
+	})
+	auditHandler := NewAuditHandler(auditStoreFunc(func(_ context.Context, filter types.AuditFilter) ([]*types.AuditEvent, error) {
+		got = filter
+		return []*types.AuditEvent{}, nil
+	}))
+	app.Get("/audit", auditHandler.HandleGetAuditEvents)
+
+	req := httptest.NewRequest("GET", "/audit?actorId=3&action=user.update&from=2025-01-02T00:00:00Z&limit=10&offset=20", nil)
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("expected status code %d but got %d", fiber.StatusOK, resp.StatusCode)
+	}
+	want := types.AuditFilter{
+		ActorID: 3,
+		Action:  types.AuditUserUpdate,
+		From:    time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC),
+		Limit:   10,
+		Offset:  20,
+	}
+	if !got.From.Equal(want.From) || got.ActorID != want.ActorID || got.Action != want.Action || got.Limit != want.Limit || got.Offset != want.Offset {
+		t.Errorf("expected filter %+v but got %+v", want, got)
+	}
+}
+
+func TestHandleGetAuditEventsInvalidFilter(t *testing.T) {
+	app := fiber.New(fiber.Config{
+		ErrorHandler: ErrorHandler,
+	})
+	auditHandler := NewAuditHandler(auditStoreFunc(func(context.Context, types.AuditFilter) ([]*types.AuditEvent, error) {
+		t.Fatal("store should not be called")
+		return nil, nil
+	}))
+	app.Get("/audit", auditHandler.HandleGetAuditEvents)
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/audit?from=yesterday&limit=1000", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusUnprocessableEntity {
+		t.Errorf("expected status code %d but got %d", fiber.StatusUnprocessableEntity, resp.StatusCode)
+	}
+}
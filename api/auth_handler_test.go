@@ -1 +1,50 @@
 package api
+
+import (
+	"context"
+	"fiber/store/storetest"
+	"fiber/types"
+	"testing"
+)
+
+type recordingAuditStore struct {
+	storetest.NopAuditStore
+	events []*types.AuditEvent
+}
+
+func (s *recordingAuditStore) RecordAuditEvent(_ context.Context, event *types.AuditEvent) error {
+	s.events = append(s.events, event)
+	return nil
+}
+
+func TestLoginAuditActor(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	mem := storetest.NewMemStore()
+	user, err := types.NewUserFromParams(types.CreateUserParams{FirstName: "Ada", Email: "ada@foo.com", Password: "correct horse"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user, err = mem.InsertUser(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	audit := &recordingAuditStore{}
+	h := NewAuthHandler(mem, audit)
+
+	if _, err := h.Login(context.Background(), AuthParams{Email: "ada@foo.com", Password: "wrong"}); err == nil {
+		t.Fatal("expected the wrong password to be refused")
+	}
+	if _, err := h.Login(context.Background(), AuthParams{Email: "ada@foo.com", Password: "correct horse"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(audit.events) != 2 {
+		t.Fatalf("expected 2 audit events, got %d", len(audit.events))
+	}
+	failure, login := audit.events[0], audit.events[1]
+	if failure.Action != types.AuditAuthLoginFailure || failure.ActorID != nil || *failure.TargetID != user.ID || failure.Details["reason"] == "" {
+		t.Errorf("expected a failed login on the user with no actor, got %+v", failure)
+	}
+	if login.Action != types.AuditAuthLogin || *login.ActorID != user.ID || *login.TargetID != user.ID {
+		t.Errorf("expected the user to be the actor of its login, got %+v", login)
+	}
+}
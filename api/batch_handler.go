@@ -0,0 +1,130 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fiber/requestid"
+	"fiber/store"
+	"fiber/types"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+// batchContextKey is the fasthttp user value a sub-request carries the context
+// of its batch under, for WithBatchContext.
+type batchContextKey struct{}
+
+// batchResultHeaders are the sub-request response headers reported in a batch result.
+var batchResultHeaders = []string{fiber.HeaderETag, fiber.HeaderLocation}
+
+// errBatchFailed rolls back an atomic batch after an operation failed.
+var errBatchFailed = errors.New("batch operation failed")
+
+type BatchHandler struct {
+	txRunner store.TxRunner
+}
+
+func NewBatchHandler(txRunner store.TxRunner) *BatchHandler {
+	return &BatchHandler{
+		txRunner: txRunner,
+	}
+}
+
+// HandleBatch runs the operations of a batch in order through the app's own
+// routes, with the caller's credentials. In an atomic batch the first failing
+// operation rolls everything back and the ones after it are not run; they are
+// reported as 424 Failed Dependency.
+func (h *BatchHandler) HandleBatch(c *fiber.Ctx) error {
+	var req types.BatchRequest
+	if err := c.BodyParser(&req); err != nil {
+		return ErrBadRequest()
+	}
+	if errors := req.Validate(); len(errors) > 0 {
+		return NewValidationError(errors)
+	}
+
+	dispatch := c.App().Handler()
+	results := make([]types.BatchResult, len(req.Operations))
+	if !req.Atomic {
+		for i, op := range req.Operations {
+			results[i] = runBatchOperation(c, c.UserContext(), dispatch, i, op)
+		}
+		return c.JSON(types.BatchResponse{Committed: true, Results: results})
+	}
+
+	err := h.txRunner.RunInTx(c.UserContext(), func(ctx context.Context) error {
+		for i, op := range req.Operations {
+			results[i] = runBatchOperation(c, ctx, dispatch, i, op)
+			if results[i].Status >= fiber.StatusBadRequest {
+				for j := i + 1; j < len(results); j++ {
+					results[j] = types.BatchResult{Status: fiber.StatusFailedDependency}
+				}
+				return errBatchFailed
+			}
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errBatchFailed) {
+		return err
+	}
+	return c.JSON(types.BatchResponse{Committed: err == nil, Results: results})
+}
+
+// WithBatchContext makes the context of a batch the user context of its
+// sub-requests. It must run before any handler that reads the user context.
+func WithBatchContext(c *fiber.Ctx) error {
+	if ctx, ok := c.Context().UserValue(batchContextKey{}).(context.Context); ok {
+		c.SetUserContext(ctx)
+	}
+	return c.Next()
+}
+
+// runBatchOperation sends op through dispatch as if the caller had sent it,
+// with ctx as its user context.
+func runBatchOperation(c *fiber.Ctx, ctx context.Context, dispatch fasthttp.RequestHandler, i int, op types.BatchOperation) types.BatchResult {
+	var req fasthttp.Request
+	req.Header.SetMethod(op.Method)
+	req.SetRequestURI(op.Path)
+	for name, value := range op.Headers {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set(fiber.HeaderAuthorization, c.Get(fiber.HeaderAuthorization))
+	req.Header.Set(fiber.HeaderUserAgent, c.Get(fiber.HeaderUserAgent))
+	req.Header.Set(requestid.Header, fmt.Sprintf("%s.%d", requestid.FromContext(c.UserContext()), i+1))
+	if op.Body != nil {
+		body, err := json.Marshal(op.Body)
+		if err != nil {
+			return types.BatchResult{Status: fiber.StatusBadRequest, Body: ErrBadRequest()}
+		}
+		req.SetBody(body)
+		if len(req.Header.ContentType()) == 0 {
+			req.Header.SetContentType(fiber.MIMEApplicationJSON)
+		}
+	}
+
+	var sub fasthttp.RequestCtx
+	sub.Init(&req, c.Context().RemoteAddr(), nil)
+	sub.SetUserValue(batchContextKey{}, ctx)
+	dispatch(&sub)
+
+	result := types.BatchResult{Status: sub.Response.StatusCode()}
+	for _, name := range batchResultHeaders {
+		if value := sub.Response.Header.Peek(name); len(value) > 0 {
+			if result.Headers == nil {
+				result.Headers = map[string]string{}
+			}
+			result.Headers[name] = string(value)
+		}
+	}
+	if body := sub.Response.Body(); len(body) > 0 {
+		if json.Valid(body) {
+			result.Body = json.RawMessage(append([]byte(nil), body...))
+		} else {
+			result.Body = string(body)
+		}
+	}
+	return result
+}
@@ -0,0 +1,128 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fiber/types"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type txKey struct{}
+
+// fakeTxRunner marks the context it hands out, so sub-requests can tell they
+// run inside the transaction.
+type fakeTxRunner struct {
+	err error
+}
+
+func (f *fakeTxRunner) RunInTx(ctx context.Context, fn func(context.Context) error) error {
+	f.err = fn(context.WithValue(ctx, txKey{}, true))
+	return f.err
+}
+
+func newBatchApp(tx *fakeTxRunner) *fiber.App {
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Use(WithBatchContext)
+	app.Post(types.BatchPath, NewBatchHandler(tx).HandleBatch)
+	app.Get("/api/v1/user/:id", func(c *fiber.Ctx) error {
+		if c.Params("id") == "404" {
+			return ErrNotFound(404, "User")
+		}
+		inTx, _ := c.UserContext().Value(txKey{}).(bool)
+		c.Set(fiber.HeaderETag, `"v1"`)
+		return c.JSON(map[string]any{"auth": c.Get(fiber.HeaderAuthorization), "inTx": inTx})
+	})
+	app.Put("/api/v1/user/:id", func(c *fiber.Ctx) error {
+		var body map[string]string
+		if err := c.BodyParser(&body); err != nil {
+			return ErrBadRequest()
+		}
+		return c.JSON(body)
+	})
+	return app
+}
+
+func postBatch(t *testing.T, app *fiber.App, body string) (int, types.BatchResponse) {
+	req := httptest.NewRequest("POST", types.BatchPath, strings.NewReader(body))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer token")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var batch types.BatchResponse
+	json.NewDecoder(resp.Body).Decode(&batch)
+	return resp.StatusCode, batch
+}
+
+func TestHandleBatch(t *testing.T) {
+	app := newBatchApp(&fakeTxRunner{})
+	status, batch := postBatch(t, app, `{"operations":[
+		{"method":"GET","path":"/api/v1/user/1"},
+		{"method":"PUT","path":"/api/v1/user/1","body":{"firstName":"James"}},
+		{"method":"GET","path":"/api/v1/user/404"}
+	]}`)
+	if status != fiber.StatusOK {
+		t.Fatalf("expected status code %d but got %d", fiber.StatusOK, status)
+	}
+	if len(batch.Results) != 3 || !batch.Committed {
+		t.Fatalf("unexpected response %+v", batch)
+	}
+	if got := batch.Results[0].Body.(map[string]any); got["auth"] != "Bearer token" || got["inTx"] != false {
+		t.Errorf("expected the caller's auth outside a transaction but got %v", got)
+	}
+	if batch.Results[0].Headers[fiber.HeaderETag] != `"v1"` {
+		t.Errorf("expected the ETag to be reported but got %v", batch.Results[0].Headers)
+	}
+	if got := batch.Results[1].Body.(map[string]any); got["firstName"] != "James" {
+		t.Errorf("expected the body to be passed on but got %v", got)
+	}
+	if batch.Results[2].Status != fiber.StatusNotFound {
+		t.Errorf("expected status %d but got %d", fiber.StatusNotFound, batch.Results[2].Status)
+	}
+}
+
+func TestHandleBatchAtomic(t *testing.T) {
+	tx := &fakeTxRunner{}
+	app := newBatchApp(tx)
+	_, batch := postBatch(t, app, `{"atomic":true,"operations":[
+		{"method":"GET","path":"/api/v1/user/1"},
+		{"method":"GET","path":"/api/v1/user/404"},
+		{"method":"GET","path":"/api/v1/user/2"}
+	]}`)
+	if batch.Committed || tx.err == nil {
+		t.Fatalf("expected the batch to be rolled back")
+	}
+	if got := batch.Results[0].Body.(map[string]any); got["inTx"] != true {
+		t.Errorf("expected the operation to run in the transaction but got %v", got)
+	}
+	want := []int{fiber.StatusOK, fiber.StatusNotFound, fiber.StatusFailedDependency}
+	for i, result := range batch.Results {
+		if result.Status != want[i] {
+			t.Errorf("operation %d: expected status %d but got %d", i, want[i], result.Status)
+		}
+	}
+}
+
+func TestHandleBatchValidates(t *testing.T) {
+	app := newBatchApp(&fakeTxRunner{})
+	for _, body := range []string{
+		`{"operations":[]}`,
+		`{"operations":[{"method":"GET","path":"/api/v1/batch"}]}`,
+		`{"operations":[{"method":"HEAD","path":"/api/v1/user/1"}]}`,
+		`{"operations":[{"method":"GET","path":"/metrics"}]}`,
+		`{"operations":[{"method":"POST","path":"/api/v1/../v1/batch"}]}`,
+		`{"operations":[{"method":"POST","path":"/api/v1/%2e%2e/v1/batch"}]}`,
+		`{"operations":[{"method":"GET","path":"/api/v1/../../metrics"}]}`,
+		`{"operations":[{"method":"POST","path":"/api/v1//batch"}]}`,
+		`{"operations":[{"method":"POST","path":"/api/v1/Batch/"}]}`,
+	} {
+		if status, _ := postBatch(t, app, body); status != fiber.StatusUnprocessableEntity {
+			t.Errorf("%s: expected status code %d but got %d", body, fiber.StatusUnprocessableEntity, status)
+		}
+	}
+}
@@ -1,20 +1,37 @@
 package api
 
 import (
+	"context"
+	"time"
+
 	"github.com/gofiber/fiber/v2"
 )
 
-type CheckHandler struct{}
+// Pinger is a dependency HandleReady checks.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
 
-func NewCheckHandler() *CheckHandler {
-	return &CheckHandler{}
+type CheckHandler struct {
+	db Pinger
 }
 
+func NewCheckHandler(db Pinger) *CheckHandler {
+	return &CheckHandler{db: db}
+}
+
+// HandleHealthy answers as long as the process serves requests.
 func (h CheckHandler) HandleHealthy(c *fiber.Ctx) error {
-	//fmt.Println("check")
 	return c.JSON(fiber.Map{"result": "ok"})
 }
 
-func (h CheckHandler) HandleDrop(c *fiber.Ctx) error {
-	panic("Drop application")
+// HandleReady answers 503 while the database is unreachable, so that traffic
+// is kept away from the replica.
+func (h CheckHandler) HandleReady(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.UserContext(), 2*time.Second)
+	defer cancel()
+	if err := h.db.Ping(ctx); err != nil {
+		return NewError(fiber.StatusServiceUnavailable, "database unavailable")
+	}
+	return c.JSON(fiber.Map{"result": "ok"})
 }
@@ -1,6 +1,8 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -16,7 +18,7 @@ func TestHealthy(t *testing.T) {
 	// app.Get("/", func(c *fiber.Ctx) error {
 	// 	return c.JSON("result", "ok")
 	// })
-	checkHandler := NewCheckHandler()
+	checkHandler := NewCheckHandler(nil)
 	app.Get("/", checkHandler.HandleHealthy)
 
 	req := httptest.NewRequest("GET", "/", nil)
@@ -30,3 +32,30 @@ func TestHealthy(t *testing.T) {
 	}
 
 }
+
+type pingFunc func(context.Context) error
+
+func (f pingFunc) Ping(ctx context.Context) error { return f(ctx) }
+
+func TestReady(t *testing.T) {
+	var pingErr error
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Get("/", NewCheckHandler(pingFunc(func(context.Context) error { return pingErr })).HandleReady)
+
+	for _, tc := range []struct {
+		err  error
+		want int
+	}{
+		{nil, fiber.StatusOK},
+		{errors.New("connection refused"), fiber.StatusServiceUnavailable},
+	} {
+		pingErr = tc.err
+		resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tc.want {
+			t.Errorf("expected status code %d with ping error %v but got %d", tc.want, tc.err, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package api
+
+import (
+	"encoding/json"
+	"fiber/openapi"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type DocsHandler struct {
+	spec []byte
+}
+
+// NewDocsHandler serves doc, which is encoded once up front.
+func NewDocsHandler(doc *openapi.Document) (*DocsHandler, error) {
+	spec, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	return &DocsHandler{
+		spec: spec,
+	}, nil
+}
+
+func (h *DocsHandler) HandleOpenAPI(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	return c.Send(h.spec)
+}
+
+func (h *DocsHandler) HandleDocs(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+	return c.Send(openapi.DocsPage)
+}
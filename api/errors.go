@@ -1,36 +1,65 @@
 package api
 
 import (
+	"errors"
+	"fiber/requestid"
 	"fmt"
-	"time"
+	"log/slog"
+	"strings"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 func ErrorHandler(c *fiber.Ctx, err error) error {
+	requestID := requestid.FromContext(c.UserContext())
 	if ApiError, ok := err.(Error); ok {
+		ApiError.RequestID = requestID
 		return c.Status(ApiError.Code).JSON(ApiError)
 	} else {
 		if ValError, ok := err.(ValidationError); ok {
+			ValError.RequestID = requestID
 			return c.Status(ValError.Status).JSON(ValError)
 		}
 	}
 
-	ApiError := NewError(err.(*fiber.Error).Code, err.Error())
-	curTime := time.Now()
-	fmt.Printf("%s Request failed with code %d and message: %s\n", &curTime, ApiError.Code, ApiError.Message)
+	// Anything that is neither ours nor a fiber error is an internal failure
+	// whose message must not leak to the client.
+	ApiError := ErrInternal()
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		ApiError = NewError(fiberErr.Code, fiberErr.Message)
+	}
+	ApiError.RequestID = requestID
+	slog.ErrorContext(c.UserContext(), "request failed", "code", ApiError.Code, "error", err.Error())
 	return c.Status(ApiError.Code).JSON(ApiError)
 
 }
 
+// StatusCode reports the HTTP status ErrorHandler answers err with.
+func StatusCode(err error) int {
+	switch e := err.(type) {
+	case Error:
+		return e.Code
+	case ValidationError:
+		return e.Status
+	}
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return fiberErr.Code
+	}
+	return fiber.StatusInternalServerError
+}
+
 type Error struct {
-	Code    int    `json:"code"`
-	Message string `json:"error"`
+	Code      int    `json:"code"`
+	Message   string `json:"error"`
+	RequestID string `json:"requestId,omitempty"`
 }
 
 type ValidationError struct {
-	Status int               `json:"status"`
-	Errors map[string]string `json:"errors"`
+	Status    int               `json:"status"`
+	Errors    map[string]string `json:"errors"`
+	RequestID string            `json:"requestId,omitempty"`
 }
 
 func (e ValidationError) Error() string {
@@ -90,3 +119,31 @@ func ErrInvalidCredentials() Error {
 		Message: "invalid credentials",
 	}
 }
+
+func ErrForbidden() Error {
+	return Error{
+		Code:    fiber.StatusForbidden,
+		Message: "forbidden",
+	}
+}
+
+func ErrPreconditionFailed() Error {
+	return Error{
+		Code:    fiber.StatusPreconditionFailed,
+		Message: "precondition failed: user was modified",
+	}
+}
+
+func ErrUnsupportedMediaType(supported ...string) Error {
+	return Error{
+		Code:    fiber.StatusUnsupportedMediaType,
+		Message: fmt.Sprintf("unsupported content type, expected one of %s", strings.Join(supported, ", ")),
+	}
+}
+
+func ErrInternal() Error {
+	return Error{
+		Code:    fiber.StatusInternalServerError,
+		Message: "internal server error",
+	}
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestErrorHandlerInternalError(t *testing.T) {
+	app := fiber.New(fiber.Config{
+		ErrorHandler: ErrorHandler,
+	})
+	app.Get("/", func(c *fiber.Ctx) error {
+		return errors.New("pq: password authentication failed")
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusInternalServerError {
+		t.Errorf("expected status code %d but got %d", fiber.StatusInternalServerError, resp.StatusCode)
+	}
+	var apiErr Error
+	json.NewDecoder(resp.Body).Decode(&apiErr)
+	if apiErr.Message != ErrInternal().Message {
+		t.Errorf("expected sanitized message %q but got %q", ErrInternal().Message, apiErr.Message)
+	}
+}
+
+func TestErrorHandlerFiberError(t *testing.T) {
+	app := fiber.New(fiber.Config{
+		ErrorHandler: ErrorHandler,
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/missing", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusNotFound {
+		t.Errorf("expected status code %d but got %d", fiber.StatusNotFound, resp.StatusCode)
+	}
+}
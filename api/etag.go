@@ -0,0 +1,117 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fiber/store"
+	"fiber/types"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ETag returns the entity tag of a user, derived from its version.
+func ETag(user *types.User) string {
+	return `"v` + strconv.Itoa(user.Version) + `"`
+}
+
+// versionFromETag is the inverse of ETag.
+func versionFromETag(tag string) (int, bool) {
+	inner, ok := strings.CutPrefix(tag, `"v`)
+	if !ok {
+		return 0, false
+	}
+	inner, ok = strings.CutSuffix(inner, `"`)
+	if !ok {
+		return 0, false
+	}
+	version, err := strconv.Atoi(inner)
+	if err != nil || version <= 0 {
+		return 0, false
+	}
+	return version, true
+}
+
+// parseETags splits an If-Match or If-None-Match header into its entity tags.
+func parseETags(header string) []string {
+	var tags []string
+	for _, tag := range strings.Split(header, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// matchesETag reports whether etag is listed in header. Weak comparison
+// ignores the W/ prefix, as If-None-Match requires; If-Match uses strong
+// comparison, where weak tags never match.
+func matchesETag(header, etag string, weak bool) bool {
+	for _, tag := range parseETags(header) {
+		if tag == "*" {
+			return true
+		}
+		if strings.HasPrefix(tag, "W/") {
+			if !weak {
+				continue
+			}
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+		if tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// expectedVersion turns the If-Match header of a request into the version a
+// mutation of user id must match; 0 means the request is unconditional. A
+// single tag is handed to the store so the check happens under the row lock,
+// anything else is resolved against the current user first. A hard purge also
+// applies to soft-deleted users, so withDeleted includes them in that lookup.
+func (h *UserHandler) expectedVersion(c *fiber.Ctx, id int, withDeleted bool) (int, error) {
+	header := c.Get(fiber.HeaderIfMatch)
+	if header == "" {
+		return 0, nil
+	}
+	if tags := parseETags(header); len(tags) == 1 && tags[0] != "*" {
+		version, ok := versionFromETag(tags[0])
+		if !ok {
+			return 0, ErrPreconditionFailed()
+		}
+		return version, nil
+	}
+
+	lookup := h.UserStore.GetUserByID
+	if withDeleted {
+		lookup = h.UserStore.GetUserByIDWithDeleted
+	}
+	user, err := lookup(c.UserContext(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// If-Match: * fails when there is no current representation.
+			return 0, ErrPreconditionFailed()
+		}
+		return 0, err
+	}
+	if !matchesETag(header, ETag(user), false) {
+		return 0, ErrPreconditionFailed()
+	}
+	return user.Version, nil
+}
+
+// versionError maps the store errors of a mutation on user id. A conditional
+// one fails its precondition when the user does not exist, so it never gets
+// 404 (RFC 9110, section 13.1.1).
+func versionError(err error, id int, conditional bool) error {
+	switch {
+	case errors.Is(err, sql.ErrNoRows) && conditional:
+		return ErrPreconditionFailed()
+	case errors.Is(err, sql.ErrNoRows):
+		return ErrNotFound(id, "User")
+	case errors.Is(err, store.ErrVersionMismatch):
+		return ErrPreconditionFailed()
+	}
+	return err
+}
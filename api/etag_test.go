@@ -0,0 +1,42 @@
+package api
+
+import (
+	"fiber/types"
+	"testing"
+)
+
+func TestMatchesETag(t *testing.T) {
+	etag := ETag(&types.User{Version: 3})
+	if etag != `"v3"` {
+		t.Fatalf("expected \"v3\" got %s", etag)
+	}
+
+	tests := []struct {
+		header string
+		weak   bool
+		want   bool
+	}{
+		{`"v3"`, false, true},
+		{`"v2", "v3"`, false, true},
+		{`"v2"`, false, false},
+		{`*`, false, true},
+		{`W/"v3"`, false, false},
+		{`W/"v3"`, true, true},
+	}
+	for _, tt := range tests {
+		if got := matchesETag(tt.header, etag, tt.weak); got != tt.want {
+			t.Errorf("matchesETag(%q, weak=%v) = %v, want %v", tt.header, tt.weak, got, tt.want)
+		}
+	}
+}
+
+func TestVersionFromETag(t *testing.T) {
+	if version, ok := versionFromETag(`"v12"`); !ok || version != 12 {
+		t.Fatalf("expected version 12 got %d (%v)", version, ok)
+	}
+	for _, tag := range []string{`v12`, `"12"`, `"v0"`, `W/"v12"`, `"vx"`} {
+		if _, ok := versionFromETag(tag); ok {
+			t.Errorf("expected %s to be rejected", tag)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fiber/store"
+	"fiber/stream"
+	"fiber/types"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// eventBuffer is how many events a subscriber may fall behind before it
+	// is disconnected and has to resume.
+	eventBuffer = 256
+	// replayBatch is how many events are read from the log at once.
+	replayBatch = 500
+	// replayWindow is how many ids up to the event a subscriber resumes after
+	// are replayed again. Ids are taken before the commit, so an event may
+	// commit after one with a higher id that the subscriber already got.
+	replayWindow = 100
+	// heartbeatInterval keeps idle streams open through proxies and notices
+	// clients that went away.
+	heartbeatInterval  = 15 * time.Second
+	websocketWriteWait = 10 * time.Second
+)
+
+type EventsHandler struct {
+	broker *stream.Broker
+	events store.UserEventStore
+}
+
+func NewEventsHandler(broker *stream.Broker, events store.UserEventStore) *EventsHandler {
+	return &EventsHandler{
+		broker: broker,
+		events: events,
+	}
+}
+
+// eventFeed is what a subscriber gets: the events it missed since the event
+// it names, then live events, limited to those it may see.
+type eventFeed struct {
+	user     *types.User
+	sub      *stream.Subscription
+	backlog  []*types.UserEvent
+	replayed map[int64]bool
+}
+
+// openFeed subscribes before replaying the log, so no event falls in between;
+// events both replayed and published are only sent once. A resuming
+// subscriber may get events again that it got before, and has to skip them
+// by id.
+func (h *EventsHandler) openFeed(c *fiber.Ctx, lastEventID string) (*eventFeed, error) {
+	user, ok := AuthUser(c)
+	if !ok {
+		return nil, ErrUnAuthorized("unauthorized")
+	}
+	var after int64
+	if lastEventID != "" {
+		id, err := strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil || id < 0 {
+			return nil, NewValidationError(map[string]string{"lastEventId": "lastEventId should be an event id"})
+		}
+		after = id
+	}
+
+	feed := &eventFeed{user: user, sub: h.broker.Subscribe(eventBuffer), replayed: map[int64]bool{}}
+	if lastEventID != "" {
+		if err := h.replay(c.UserContext(), feed, after); err != nil {
+			feed.sub.Close()
+			return nil, err
+		}
+	}
+	return feed, nil
+}
+
+func (h *EventsHandler) replay(ctx context.Context, feed *eventFeed, after int64) error {
+	oldest, _, err := h.events.UserEventBounds(ctx)
+	if err != nil {
+		return err
+	}
+	if oldest > after+1 {
+		// The events right after the requested one have been trimmed.
+		feed.backlog = append(feed.backlog, &types.UserEvent{Type: types.UserEventReset})
+		return nil
+	}
+	after = max(after-replayWindow, 0)
+	for {
+		events, err := h.events.UserEventsAfter(ctx, after, replayBatch)
+		if err != nil {
+			return err
+		}
+		for _, event := range events {
+			feed.replayed[event.ID] = true
+			if feed.visible(event) {
+				feed.backlog = append(feed.backlog, event)
+			}
+			after = event.ID
+		}
+		if len(events) < replayBatch {
+			return nil
+		}
+	}
+}
+
+// visible reports whether the subscriber may see event: admins see every
+// user, everyone else only themselves.
+func (f *eventFeed) visible(event *types.UserEvent) bool {
+	return f.user.IsAdmin || event.User == nil || event.User.ID == f.user.ID
+}
+
+// send reports whether a live event is to be sent to the subscriber.
+func (f *eventFeed) send(event *types.UserEvent) bool {
+	return !f.replayed[event.ID] && f.visible(event)
+}
+
+// HandleUserEvents streams user changes as Server-Sent Events. Each event is
+// a JSON types.UserEvent with its id as the SSE id, so a reconnecting
+// EventSource resumes through Last-Event-ID.
+func (h *EventsHandler) HandleUserEvents(c *fiber.Ctx) error {
+	lastEventID := c.Get("Last-Event-ID", c.Query("lastEventId"))
+	feed, err := h.openFeed(c, lastEventID)
+	if err != nil {
+		return err
+	}
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer feed.sub.Close()
+		for _, event := range feed.backlog {
+			if err := writeSSE(w, event); err != nil {
+				return
+			}
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+
+		heartbeat := time.NewTicker(heartbeatInterval)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case event, ok := <-feed.sub.Events():
+				if !ok {
+					return
+				}
+				if !feed.send(event) {
+					continue
+				}
+				if err := writeSSE(w, event); err != nil {
+					return
+				}
+			case <-heartbeat.C:
+				if _, err := w.WriteString(": ping\n\n"); err != nil {
+					return
+				}
+			}
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	})
+	return nil
+}
+
+func writeSSE(w *bufio.Writer, event *types.UserEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if event.ID != 0 {
+		if _, err := fmt.Fprintf(w, "id: %d\n", event.ID); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+	return err
+}
+
+// HandleUserEventsWebSocket is HandleUserEvents over a WebSocket: every
+// message is a JSON types.UserEvent, and lastEventId resumes after an event.
+func (h *EventsHandler) HandleUserEventsWebSocket(c *fiber.Ctx) error {
+	if !websocket.IsWebSocketUpgrade(c) {
+		return NewError(fiber.StatusUpgradeRequired, "websocket upgrade required")
+	}
+	feed, err := h.openFeed(c, c.Query("lastEventId"))
+	if err != nil {
+		return err
+	}
+	err = websocket.New(func(conn *websocket.Conn) {
+		defer feed.sub.Close()
+		streamWebSocket(conn, feed)
+	})(c)
+	if err != nil {
+		// The upgrade failed, so the connection handler never runs.
+		feed.sub.Close()
+	}
+	return err
+}
+
+func streamWebSocket(conn *websocket.Conn, feed *eventFeed) {
+	// Clients only ever send control frames; reading notices them leaving.
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	send := func(event *types.UserEvent) error {
+		conn.SetWriteDeadline(time.Now().Add(websocketWriteWait))
+		return conn.WriteJSON(event)
+	}
+	for _, event := range feed.backlog {
+		if err := send(event); err != nil {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case event, ok := <-feed.sub.Events():
+			if !ok {
+				conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "resume with lastEventId"), time.Now().Add(websocketWriteWait))
+				return
+			}
+			if !feed.send(event) {
+				continue
+			}
+			if err := send(event); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(websocketWriteWait)); err != nil {
+				return
+			}
+		case <-gone:
+			return
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fiber/stream"
+	"fiber/types"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fasthttp/websocket"
+	"github.com/gofiber/fiber/v2"
+)
+
+// memEventLog is a store.UserEventStore over a slice.
+type memEventLog struct {
+	mu  sync.Mutex
+	log []*types.UserEvent
+}
+
+func (l *memEventLog) UserEventsAfter(_ context.Context, after int64, limit int) ([]*types.UserEvent, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var events []*types.UserEvent
+	for _, event := range l.log {
+		if event.ID > after && len(events) < limit {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (l *memEventLog) UserEventBounds(context.Context) (int64, int64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.log) == 0 {
+		return 0, 0, nil
+	}
+	return l.log[0].ID, l.log[len(l.log)-1].ID, nil
+}
+
+func (l *memEventLog) ListenUserEvents(context.Context, func(context.Context) error, func(*types.UserEvent)) error {
+	return nil
+}
+
+func (l *memEventLog) TrimUserEvents(_ context.Context, keep int) (int64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	trimmed := max(len(l.log)-keep, 0)
+	l.log = l.log[trimmed:]
+	return int64(trimmed), nil
+}
+
+func userEvent(id int64, eventType string, userID int) *types.UserEvent {
+	return &types.UserEvent{ID: id, Type: eventType, User: &types.User{ID: userID, Email: "u" + strconv.Itoa(userID) + "@foo.com"}}
+}
+
+// newEventsServer serves the change streams on a real listener. Requests are
+// authenticated as the user whose id is in the X-User header, user 1 being an
+// admin.
+func newEventsServer(t *testing.T, log *memEventLog) (string, *stream.Broker) {
+	broker := stream.NewBroker()
+	h := NewEventsHandler(broker, log)
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	auth := func(c *fiber.Ctx) error {
+		id, _ := strconv.Atoi(c.Get("X-User"))
+		SetAuthUser(c, &types.User{ID: id, IsAdmin: id == 1})
+		return c.Next()
+	}
+	app.Get("/events", auth, h.HandleUserEvents)
+	app.Get("/events/ws", auth, h.HandleUserEventsWebSocket)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go app.Listener(ln)
+	t.Cleanup(func() {
+		broker.Close()
+		app.Shutdown()
+	})
+	return ln.Addr().String(), broker
+}
+
+// readSSE returns the ids and types of the next n events of an SSE stream.
+func readSSE(t *testing.T, r *bufio.Reader, n int) []string {
+	var got []string
+	for len(got) < n {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("stream ended after %v: %v", got, err)
+		}
+		data, ok := strings.CutPrefix(strings.TrimSpace(line), "data: ")
+		if !ok {
+			continue
+		}
+		var event types.UserEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, strconv.FormatInt(event.ID, 10)+":"+event.Type)
+	}
+	return got
+}
+
+// waitForSubscribers gives streams time to subscribe before publishing.
+func waitForSubscribers() {
+	time.Sleep(50 * time.Millisecond)
+}
+
+func TestUserEventsSSE(t *testing.T) {
+	log := &memEventLog{log: []*types.UserEvent{
+		userEvent(1, types.UserEventCreated, 2),
+		userEvent(2, types.UserEventUpdated, 3),
+		userEvent(3, types.UserEventUpdated, 2),
+	}}
+	addr, broker := newEventsServer(t, log)
+
+	open := func(user, lastEventID string) *bufio.Reader {
+		req, err := http.NewRequest(http.MethodGet, "http://"+addr+"/events", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("X-User", user)
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+			t.Fatalf("expected text/event-stream, got %q", ct)
+		}
+		return bufio.NewReader(resp.Body)
+	}
+
+	admin := open("1", "1")
+	user := open("2", "")
+	waitForSubscribers()
+	// Event 3 is in the replay and published, and is only sent once.
+	broker.Publish(log.log[2])
+	broker.Publish(userEvent(4, types.UserEventDeleted, 3))
+	broker.Publish(userEvent(5, types.UserEventDeleted, 2))
+
+	// Event 1 is within the replay window, which is sent again.
+	if got := strings.Join(readSSE(t, admin, 5), ","); got != "1:created,2:updated,3:updated,4:deleted,5:deleted" {
+		t.Errorf("unexpected admin events %s", got)
+	}
+	if got := strings.Join(readSSE(t, user, 2), ","); got != "3:updated,5:deleted" {
+		t.Errorf("unexpected user events %s", got)
+	}
+}
+
+func TestUserEventsResetWhenTrimmed(t *testing.T) {
+	log := &memEventLog{log: []*types.UserEvent{userEvent(5, types.UserEventCreated, 2)}}
+	addr, _ := newEventsServer(t, log)
+
+	req, err := http.NewRequest(http.MethodGet, "http://"+addr+"/events?lastEventId=2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-User", "1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if got := readSSE(t, bufio.NewReader(resp.Body), 1); got[0] != "0:reset" {
+		t.Errorf("expected a reset, got %v", got)
+	}
+}
+
+func TestUserEventsInvalidLastEventID(t *testing.T) {
+	addr, _ := newEventsServer(t, &memEventLog{})
+
+	req, err := http.NewRequest(http.MethodGet, "http://"+addr+"/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-User", "1")
+	req.Header.Set("Last-Event-ID", "abc")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != fiber.StatusUnprocessableEntity {
+		t.Errorf("expected %d, got %d", fiber.StatusUnprocessableEntity, resp.StatusCode)
+	}
+}
+
+func TestUserEventsWebSocket(t *testing.T) {
+	log := &memEventLog{log: []*types.UserEvent{
+		userEvent(1, types.UserEventCreated, 2),
+		userEvent(2, types.UserEventCreated, 3),
+	}}
+	addr, broker := newEventsServer(t, log)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws://"+addr+"/events/ws?lastEventId=0", http.Header{"X-User": {"2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	waitForSubscribers()
+	broker.Publish(userEvent(3, types.UserEventUpdated, 3))
+	broker.Publish(userEvent(4, types.UserEventUpdated, 2))
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var got []int64
+	for len(got) < 2 {
+		var event types.UserEvent
+		if err := conn.ReadJSON(&event); err != nil {
+			t.Fatalf("read failed after %v: %v", got, err)
+		}
+		got = append(got, event.ID)
+	}
+	if got[0] != 1 || got[1] != 4 {
+		t.Errorf("expected events 1 and 4, got %v", got)
+	}
+
+	resp, err := http.Get("http://" + addr + "/events/ws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != fiber.StatusUpgradeRequired {
+		t.Errorf("expected %d without an upgrade, got %d", fiber.StatusUpgradeRequired, resp.StatusCode)
+	}
+}
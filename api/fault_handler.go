@@ -0,0 +1,47 @@
+package api
+
+import (
+	"fiber/fault"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type FaultHandler struct {
+	injector *fault.Injector
+}
+
+func NewFaultHandler(injector *fault.Injector) *FaultHandler {
+	return &FaultHandler{
+		injector: injector,
+	}
+}
+
+func (h *FaultHandler) HandleGetFaults(c *fiber.Ctx) error {
+	return c.JSON(h.injector.Rules())
+}
+
+func (h *FaultHandler) HandlePutFault(c *fiber.Ctx) error {
+	var rule fault.Rule
+	if err := c.BodyParser(&rule); err != nil {
+		return ErrBadRequest()
+	}
+	if errors := rule.Validate(); len(errors) > 0 {
+		return NewValidationError(errors)
+	}
+	h.injector.SetRule(rule)
+	return c.JSON(h.injector.Rules())
+}
+
+// HandleDeleteFault removes the rule given by the method and path query params,
+// or every rule when both are omitted.
+func (h *FaultHandler) HandleDeleteFault(c *fiber.Ctx) error {
+	method, path := c.Query("method"), c.Query("path")
+	if method == "" && path == "" {
+		h.injector.Reset()
+		return c.JSON(h.injector.Rules())
+	}
+	if !h.injector.RemoveRule(method, path) {
+		return ErrNotFound(method+" "+path, "Fault rule")
+	}
+	return c.JSON(h.injector.Rules())
+}
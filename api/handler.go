@@ -1,12 +1,16 @@
 package api
 
 import (
+	"bytes"
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"fiber/patch"
 	"fiber/store"
+	"fiber/tracing"
 	"fiber/types"
 	"fmt"
-	"reflect"
+	"net/url"
 	"strconv"
 	"strings"
 
@@ -31,12 +35,14 @@ func (h *UserHandler) HandlePostUser(c *fiber.Ctx) error {
 	if errors := params.Validate(); len(errors) > 0 {
 		return NewValidationError(errors)
 	}
+	_, span := tracing.Start(c.UserContext(), "bcrypt.hash")
 	user, err := types.NewUserFromParams(params)
+	tracing.End(span, &err)
 	if err != nil {
 		return err
 	}
 
-	insertedUser, err := h.UserStore.InsertUser(c.Context(), user)
+	insertedUser, err := h.UserStore.InsertUser(c.UserContext(), user)
 	if err != nil {
 		return err
 	}
@@ -52,7 +58,7 @@ func (h *UserHandler) HandleGetUserByID(c *fiber.Ctx) error {
 	if err != nil {
 		return ErrInvalidID()
 	}
-	user, err := h.UserStore.GetUserByID(c.Context(), id)
+	user, err := h.UserStore.GetUserByID(c.UserContext(), id)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return ErrNotFound(id, "User")
@@ -60,9 +66,15 @@ func (h *UserHandler) HandleGetUserByID(c *fiber.Ctx) error {
 		return err
 	}
 
+	etag := ETag(user)
+	c.Set(fiber.HeaderETag, etag)
+	if header := c.Get(fiber.HeaderIfNoneMatch); header != "" && matchesETag(header, etag, true) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
 	return c.JSON(user)
 }
 
+// HandlePutUser replaces the editable fields of a user as a whole.
 func (h *UserHandler) HandlePutUser(c *fiber.Ctx) error {
 	par := c.Params("id")
 	id, err := strconv.Atoi(par)
@@ -77,33 +89,104 @@ func (h *UserHandler) HandlePutUser(c *fiber.Ctx) error {
 		return NewValidationError(errors)
 	}
 
-	v := reflect.ValueOf(params)
-	t := reflect.TypeOf(params)
-	querySet := make(map[string]any)
-	for i := range v.NumField() {
-		//fieldName := t.Field(i).Name
-		jsonTag := t.Field(i).Tag.Get("db")
-		fieldValue := v.Field(i).Interface()
-		//fmt.Printf("Field: %s (json: %s), Value: %v\n", fieldName, jsonTag, fieldValue)
+	version, err := h.expectedVersion(c, id, false)
+	if err != nil {
+		return err
+	}
+	res, err := h.UserStore.UpdateUser(c.UserContext(), id, params.Columns(), version)
+	if err != nil {
+		return versionError(err, id, version != 0)
+	}
+	c.Set(fiber.HeaderETag, ETag(&res))
+	return c.JSON(res)
 
-		key := strings.Split(jsonTag, ",")[0]
-		if value, ok := fieldValue.(string); ok && value != "" {
-			querySet[key] = value
-		}
+}
+
+// patchAttempts bounds how often an unconditional PATCH is reapplied when the
+// user changes between reading it and writing the result.
+const patchAttempts = 3
+
+// HandlePatchUser applies a JSON Merge Patch or JSON Patch document to the
+// editable fields of a user.
+func (h *UserHandler) HandlePatchUser(c *fiber.Ctx) error {
+	par := c.Params("id")
+	id, err := strconv.Atoi(par)
+	if err != nil {
+		return ErrInvalidID()
 	}
-	if len(querySet) == 0 {
-		return ErrBadRequest()
+
+	var apply func(doc, patch []byte) ([]byte, error)
+	switch strings.ToLower(strings.TrimSpace(strings.Split(c.Get(fiber.HeaderContentType), ";")[0])) {
+	case patch.MergePatchType:
+		apply = patch.MergePatch
+	case patch.JSONPatchType:
+		apply = patch.JSONPatch
+	default:
+		return ErrUnsupportedMediaType(patch.MergePatchType, patch.JSONPatchType)
 	}
+	ifMatch := c.Get(fiber.HeaderIfMatch)
 
-	res, err := h.UserStore.UpdateUser(c.Context(), id, querySet)
+	for attempt := 1; ; attempt++ {
+		user, err := h.UserStore.GetUserByID(c.UserContext(), id)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				if ifMatch != "" {
+					return ErrPreconditionFailed()
+				}
+				return ErrNotFound(id, "User")
+			}
+			return err
+		}
+		// The patch is applied to this snapshot, so the write is always
+		// conditional on its version.
+		if ifMatch != "" && !matchesETag(ifMatch, ETag(user), false) {
+			return ErrPreconditionFailed()
+		}
+
+		params, err := patchUserParams(user, c.Body(), apply)
+		if err != nil {
+			return err
+		}
+		res, err := h.UserStore.UpdateUser(c.UserContext(), id, params.Columns(), user.Version)
+		if errors.Is(err, store.ErrVersionMismatch) && ifMatch == "" && attempt < patchAttempts {
+			continue
+		}
+		if err != nil {
+			return versionError(err, id, ifMatch != "")
+		}
+		c.Set(fiber.HeaderETag, ETag(&res))
+		return c.JSON(res)
+	}
+}
+
+// patchUserParams applies body to the editable fields of user and validates
+// the result against the user schema.
+func patchUserParams(user *types.User, body []byte, apply func(doc, patch []byte) ([]byte, error)) (types.UpdateUserParams, error) {
+	var params types.UpdateUserParams
+	doc, err := json.Marshal(types.UpdateUserParamsFromUser(user))
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return ErrNotFound(id, "User")
+		return params, err
+	}
+	patched, err := apply(doc, body)
+	if err != nil {
+		if errors.Is(err, patch.ErrTestFailed) {
+			return params, NewError(fiber.StatusConflict, err.Error())
 		}
-		return err
+		if errors.Is(err, patch.ErrInvalidPatch) {
+			return params, NewError(fiber.StatusBadRequest, err.Error())
+		}
+		return params, err
 	}
-	return c.JSON(res)
 
+	dec := json.NewDecoder(bytes.NewReader(patched))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&params); err != nil {
+		return params, NewValidationError(map[string]string{"patch": err.Error()})
+	}
+	if errors := params.Validate(); len(errors) > 0 {
+		return params, NewValidationError(errors)
+	}
+	return params, nil
 }
 
 func (h *UserHandler) HandleDeleteUser(c *fiber.Ctx) error {
@@ -113,23 +196,87 @@ func (h *UserHandler) HandleDeleteUser(c *fiber.Ctx) error {
 		return ErrInvalidID()
 	}
 
-	deletedID, err := h.UserStore.DeleteUser(c.Context(), id)
+	if c.QueryBool("hard") {
+		if user, ok := AuthUser(c); !ok || !user.IsAdmin {
+			return ErrForbidden()
+		}
+		version, err := h.expectedVersion(c, id, true)
+		if err != nil {
+			return err
+		}
+		purgedID, err := h.UserStore.PurgeUser(c.UserContext(), id, version)
+		if err != nil {
+			return versionError(err, id, version != 0)
+		}
+		return c.JSON(map[string]string{"purged": fmt.Sprintf("user with id %d", purgedID)})
+	}
+
+	version, err := h.expectedVersion(c, id, false)
+	if err != nil {
+		return err
+	}
+	deletedID, err := h.UserStore.DeleteUser(c.UserContext(), id, version)
+	if err != nil {
+		return versionError(err, id, version != 0)
+	}
+	return c.JSON(map[string]string{"deleted": fmt.Sprintf("user with id %d", deletedID)})
+}
+
+func (h *UserHandler) HandleRestoreUser(c *fiber.Ctx) error {
+	par := c.Params("id")
+	id, err := strconv.Atoi(par)
+	if err != nil {
+		return ErrInvalidID()
+	}
+
+	user, err := h.UserStore.RestoreUser(c.UserContext(), id)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return ErrNotFound(id, "User")
+			return ErrNotFound(id, "Deleted user")
 		}
 		return err
 	}
-	return c.JSON(map[string]string{"deleted": fmt.Sprintf("user with id %d", deletedID)})
+	c.Set(fiber.HeaderETag, ETag(user))
+	return c.JSON(user)
 }
 
+// HandleGetUsers lists users in id order. With a limit it returns one page
+// and links the next one in the Link header while there may be more.
 func (h *UserHandler) HandleGetUsers(c *fiber.Ctx) error {
-	users, err := h.UserStore.GetUsers(c.Context())
+	var page types.UserPage
+	if err := c.QueryParser(&page); err != nil {
+		return NewError(fiber.StatusBadRequest, "invalid query parameters")
+	}
+	if errors := page.Validate(); len(errors) > 0 {
+		return NewValidationError(errors)
+	}
+	users, err := h.UserStore.GetUsers(c.UserContext(), page)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return ErrNotFound("Users", "no condition")
 		}
 		return err
 	}
+	if page.Limit > 0 && len(users) == page.Limit {
+		page.After = users[len(users)-1].ID
+		c.Set(fiber.HeaderLink, fmt.Sprintf(`<%s?%s>; rel="next"`, c.Path(), pageQuery(page).Encode()))
+	}
 	return c.JSON(users)
 }
+
+// pageQuery is the query string selecting page, filters included.
+func pageQuery(page types.UserPage) url.Values {
+	q := url.Values{}
+	q.Set("after", strconv.Itoa(page.After))
+	q.Set("limit", strconv.Itoa(page.Limit))
+	if page.Email != "" {
+		q.Set("email", page.Email)
+	}
+	if page.Name != "" {
+		q.Set("name", page.Name)
+	}
+	if page.IsAdmin != nil {
+		q.Set("isAdmin", strconv.FormatBool(*page.IsAdmin))
+	}
+	return q
+}
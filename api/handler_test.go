@@ -5,10 +5,12 @@ import (
 	"context"
 	"encoding/json"
 	"fiber/store"
+	"fiber/store/storetest"
 	"fiber/types"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/gofiber/fiber/v2"
@@ -47,7 +49,9 @@ func (tdb *testdb) teardown(t *testing.T) {
 
 func setup(t *testing.T) *testdb {
 	connStr := "host=postgres port=5432 user=postgres password=postgres dbname=test sslmode=disable"
-	db, err := store.NewPostgresStore(connStr)
+	poolConfig := store.DefaultPoolConfig()
+	poolConfig.ConnectRetries = 0
+	db, err := store.NewPostgresStore(connStr, poolConfig)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -217,3 +221,178 @@ func TestHandleGetUserByIDNotFound(t *testing.T) {
 		t.Errorf("expected status code %d but got %d", http.StatusNotFound, resp.StatusCode)
 	}
 }
+
+func TestHandleGetUsersFilters(t *testing.T) {
+	s := storetest.NewMemStore()
+	for _, name := range []string{"Ann", "Bob", "Anna"} {
+		if _, err := s.InsertUser(context.Background(), &types.User{FirstName: name, LastName: "Foo", Email: strings.ToLower(name) + "@foo.com"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Get("/users", NewUserHandler(s).HandleGetUsers)
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/users?limit=1&name=ann&isAdmin=false", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var users []types.User
+	if err := json.NewDecoder(resp.Body).Decode(&users); err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].FirstName != "Ann" {
+		t.Fatalf("expected Ann, got %+v", users)
+	}
+	want := `</users?after=1&isAdmin=false&limit=1&name=ann>; rel="next"`
+	if link := resp.Header.Get(fiber.HeaderLink); link != want {
+		t.Errorf("expected Link %s, got %s", want, link)
+	}
+}
+
+func newDeleteApp(s store.UserStore, admin bool) *fiber.App {
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	h := NewUserHandler(s)
+	app.Use(func(c *fiber.Ctx) error {
+		SetAuthUser(c, &types.User{ID: 1, IsAdmin: admin})
+		return c.Next()
+	})
+	app.Delete("/user/:id", h.HandleDeleteUser)
+	app.Post("/user/:id/restore", h.HandleRestoreUser)
+	return app
+}
+
+func TestHandleRestoreUser(t *testing.T) {
+	s := storetest.NewMemStore()
+	user, err := s.InsertUser(context.Background(), &types.User{FirstName: "James", LastName: "Foo", Email: "james@foo.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := newDeleteApp(s, false)
+
+	resp, err := app.Test(httptest.NewRequest("POST", fmt.Sprintf("/user/%d/restore", user.ID), nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected a live user not to be restorable, got %d", resp.StatusCode)
+	}
+
+	if _, err := s.DeleteUser(context.Background(), user.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	resp, err = app.Test(httptest.NewRequest("POST", fmt.Sprintf("/user/%d/restore", user.ID), nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200 got %d", resp.StatusCode)
+	}
+	var restored types.User
+	if err := json.NewDecoder(resp.Body).Decode(&restored); err != nil {
+		t.Fatal(err)
+	}
+	if restored.DeletedAt != nil || restored.Version != 3 {
+		t.Errorf("expected a live user at version 3, got %+v", restored)
+	}
+	if etag := resp.Header.Get(fiber.HeaderETag); etag != `"v3"` {
+		t.Errorf("expected ETag \"v3\" got %s", etag)
+	}
+	if _, err := s.GetUserByID(context.Background(), user.ID); err != nil {
+		t.Errorf("expected the user to be live again: %v", err)
+	}
+}
+
+func TestHandleDeleteUserHard(t *testing.T) {
+	s := storetest.NewMemStore()
+	user, err := s.InsertUser(context.Background(), &types.User{FirstName: "James", LastName: "Foo", Email: "james@foo.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := fmt.Sprintf("/user/%d?hard=true", user.ID)
+
+	resp, err := newDeleteApp(s, false).Test(httptest.NewRequest("DELETE", target, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected non-admins to be forbidden, got %d", resp.StatusCode)
+	}
+
+	app := newDeleteApp(s, true)
+	resp, err = app.Test(httptest.NewRequest("DELETE", target, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200 got %d", resp.StatusCode)
+	}
+	if _, err := s.RestoreUser(context.Background(), user.ID); err == nil {
+		t.Error("expected a purged user not to be restorable")
+	}
+
+	resp, err = app.Test(httptest.NewRequest("DELETE", target, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected purging twice to return 404, got %d", resp.StatusCode)
+	}
+}
+
+func TestHandleDeleteUserHardIfMatchDeleted(t *testing.T) {
+	s := storetest.NewMemStore()
+	user, err := s.InsertUser(context.Background(), &types.User{FirstName: "James", LastName: "Foo", Email: "james@foo.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.DeleteUser(context.Background(), user.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	app := newDeleteApp(s, true)
+	target := fmt.Sprintf("/user/%d?hard=true", user.ID)
+
+	for header, status := range map[string]int{
+		`"v1", "v3"`: http.StatusPreconditionFailed,
+		`"v1", "v2"`: http.StatusOK,
+	} {
+		req := httptest.NewRequest("DELETE", target, nil)
+		req.Header.Set(fiber.HeaderIfMatch, header)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != status {
+			t.Errorf("If-Match %s: expected status %d got %d", header, status, resp.StatusCode)
+		}
+	}
+}
+
+func TestHandleIfMatchMissingUser(t *testing.T) {
+	app := newDeleteApp(storetest.NewMemStore(), true)
+	h := NewUserHandler(storetest.NewMemStore())
+	app.Put("/user/:id", h.HandlePutUser)
+
+	for _, tc := range []struct {
+		method, target, ifMatch string
+		want                    int
+	}{
+		{"PUT", "/user/7", `"v1"`, http.StatusPreconditionFailed},
+		{"PUT", "/user/7", "", http.StatusNotFound},
+		{"DELETE", "/user/7", `"v1"`, http.StatusPreconditionFailed},
+		{"DELETE", "/user/7?hard=true", `"v1"`, http.StatusPreconditionFailed},
+		{"DELETE", "/user/7", "", http.StatusNotFound},
+	} {
+		req := httptest.NewRequest(tc.method, tc.target, strings.NewReader(`{"firstName":"James","lastName":"Foo","email":"james@foo.com"}`))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		if tc.ifMatch != "" {
+			req.Header.Set(fiber.HeaderIfMatch, tc.ifMatch)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tc.want {
+			t.Errorf("%s %s with If-Match %q: expected status %d got %d", tc.method, tc.target, tc.ifMatch, tc.want, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,323 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fiber/store"
+	"fiber/tracing"
+	"fiber/types"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	csvType    = "text/csv"
+	ndjsonType = "application/x-ndjson"
+
+	// maxImportRows bounds a single import request.
+	maxImportRows = 10000
+	// MaxImportBytes bounds the body of an import, which is buffered whole
+	// rather than streamed. It is fiber's default BodyLimit, which applies to
+	// every request: streaming would lift it for all routes.
+	MaxImportBytes = fiber.DefaultBodyLimit
+)
+
+// csvColumns are the columns of an import CSV, in the JSON spelling of CreateUserParams.
+var csvColumns = []string{"firstName", "lastName", "email", "password"}
+
+// exportColumns are the columns of an export CSV.
+var exportColumns = []string{"id", "firstName", "lastName", "email", "isAdmin", "createdAt", "version"}
+
+type ImportHandler struct {
+	importer store.UserImporter
+}
+
+func NewImportHandler(importer store.UserImporter) *ImportHandler {
+	return &ImportHandler{
+		importer: importer,
+	}
+}
+
+// importRow is a decoded row of an import with the errors found so far.
+type importRow struct {
+	params types.CreateUserParams
+	errors map[string]string
+}
+
+// HandleImportUsers creates users from a CSV or NDJSON body, one user per row.
+// With atomic=true either every row is imported or none; otherwise valid rows
+// are imported and the others reported. dryRun=true checks everything and
+// imports nothing. The body is buffered whole and bounded by MaxImportBytes.
+func (h *ImportHandler) HandleImportUsers(c *fiber.Ctx) error {
+	opts := store.ImportOptions{
+		Atomic: c.QueryBool("atomic"),
+		DryRun: c.QueryBool("dryRun"),
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(c.Get(fiber.HeaderContentType))
+	var (
+		rows []importRow
+		err  error
+	)
+	switch mediaType {
+	case csvType:
+		rows, err = decodeCSVRows(c.Body())
+	case ndjsonType:
+		rows, err = decodeNDJSONRows(c.Body())
+	default:
+		return ErrUnsupportedMediaType(csvType, ndjsonType)
+	}
+	if err != nil {
+		return err
+	}
+
+	report := &types.ImportReport{Total: len(rows), Atomic: opts.Atomic, DryRun: opts.DryRun, Errors: []types.ImportRowError{}}
+	validateImportRows(rows)
+
+	// Only valid rows reach the store; they keep their position in rows through index.
+	var (
+		users []*types.User
+		index []int
+	)
+	for i, row := range rows {
+		if len(row.errors) == 0 {
+			users = append(users, &types.User{
+				FirstName: row.params.FirstName,
+				LastName:  row.params.LastName,
+				Email:     row.params.Email,
+				CreatedAt: time.Now().UTC(),
+			})
+			index = append(index, i)
+		}
+	}
+	failed := len(users) < len(rows)
+	if !(opts.Atomic && failed) && len(users) > 0 {
+		if !opts.DryRun {
+			if err := hashPasswords(c, rows, index, users); err != nil {
+				return err
+			}
+		}
+		rowErrs, err := h.importer.ImportUsers(c.UserContext(), users, opts)
+		if err != nil {
+			return err
+		}
+		for i, err := range rowErrs {
+			if err != nil {
+				slog.WarnContext(c.UserContext(), "error to import user", "row", index[i]+1, "error", err.Error())
+				rows[index[i]].errors = map[string]string{"row": "user could not be stored"}
+				failed = true
+			}
+		}
+	}
+
+	for i, row := range rows {
+		if len(row.errors) > 0 {
+			report.Errors = append(report.Errors, types.ImportRowError{Row: i + 1, Email: row.params.Email, Errors: row.errors})
+		}
+	}
+	report.Failed = len(report.Errors)
+	if !(opts.Atomic && failed) {
+		report.Imported = len(rows) - report.Failed
+	}
+	if opts.Atomic && failed {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(report)
+	}
+	return c.JSON(report)
+}
+
+func decodeCSVRows(body []byte) ([]importRow, error) {
+	r := csv.NewReader(bytes.NewReader(body))
+	r.TrimLeadingSpace = true
+	header, err := r.Read()
+	if err != nil {
+		return nil, NewError(fiber.StatusBadRequest, "CSV import needs a header row")
+	}
+	position := map[string]int{}
+	for i, name := range header {
+		position[strings.TrimSpace(name)] = i
+	}
+	for _, name := range csvColumns {
+		if _, ok := position[name]; !ok {
+			return nil, NewError(fiber.StatusBadRequest, fmt.Sprintf("CSV header should have the columns %s", strings.Join(csvColumns, ",")))
+		}
+	}
+	r.FieldsPerRecord = len(header)
+
+	var rows []importRow
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if len(rows) == maxImportRows {
+			return nil, errTooManyRows()
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return nil, err
+			}
+			rows = append(rows, importRow{errors: map[string]string{"row": parseErr.Err.Error()}})
+			continue
+		}
+		rows = append(rows, importRow{params: types.CreateUserParams{
+			FirstName: record[position["firstName"]],
+			LastName:  record[position["lastName"]],
+			Email:     record[position["email"]],
+			Password:  record[position["password"]],
+		}})
+	}
+}
+
+func decodeNDJSONRows(body []byte) ([]importRow, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	var rows []importRow
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if len(rows) == maxImportRows {
+			return nil, errTooManyRows()
+		}
+		var row importRow
+		dec := json.NewDecoder(bytes.NewReader(line))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&row.params); err != nil {
+			row.errors = map[string]string{"row": err.Error()}
+		}
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, NewError(fiber.StatusBadRequest, err.Error())
+	}
+	return rows, nil
+}
+
+func errTooManyRows() Error {
+	return NewError(fiber.StatusRequestEntityTooLarge, fmt.Sprintf("an import can have at most %d rows", maxImportRows))
+}
+
+// validateImportRows runs Validate on every decoded row and rejects emails
+// that appear more than once in the import.
+func validateImportRows(rows []importRow) {
+	seen := map[string]int{}
+	for i := range rows {
+		row := &rows[i]
+		if row.errors != nil {
+			continue
+		}
+		row.errors = row.params.Validate()
+		if first, ok := seen[row.params.Email]; ok {
+			row.errors["email"] = fmt.Sprintf("email is already used by row %d", first+1)
+		} else {
+			seen[row.params.Email] = i
+		}
+	}
+}
+
+// hashPasswords hashes the passwords of users in parallel; bcrypt dominates
+// the cost of an import.
+func hashPasswords(c *fiber.Ctx, rows []importRow, index []int, users []*types.User) (err error) {
+	_, span := tracing.Start(c.UserContext(), "bcrypt.hash")
+	defer tracing.End(span, &err)
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		jobs   = make(chan int)
+		failed error
+	)
+	for range runtime.GOMAXPROCS(0) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				user, err := types.NewUserFromParams(rows[index[i]].params)
+				if err != nil {
+					mu.Lock()
+					failed = err
+					mu.Unlock()
+					continue
+				}
+				users[i].EncryptedPassword = user.EncryptedPassword
+			}
+		}()
+	}
+	for i := range users {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return failed
+}
+
+// HandleExportUsers streams every user as CSV or NDJSON (format=csv|ndjson,
+// default ndjson) while reading them from the store.
+func (h *ImportHandler) HandleExportUsers(c *fiber.Ctx) error {
+	format := c.Query("format", "ndjson")
+	var encode func(w *bufio.Writer) func(*types.User) error
+	switch format {
+	case "csv":
+		c.Set(fiber.HeaderContentType, csvType)
+		encode = encodeCSV
+	case "ndjson":
+		c.Set(fiber.HeaderContentType, ndjsonType)
+		encode = encodeNDJSON
+	default:
+		return NewValidationError(map[string]string{"format": "format should be csv or ndjson"})
+	}
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="users.%s"`, format))
+
+	// The writer runs after the handler has returned, so it must not use c.
+	ctx := c.UserContext()
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		if err := h.importer.ExportUsers(ctx, encode(w)); err != nil {
+			slog.ErrorContext(ctx, "error to export users", "error", err.Error())
+		}
+		w.Flush()
+	})
+	return nil
+}
+
+// The encoders leave flushing to w, which writes to the client whenever its
+// buffer fills up.
+
+func encodeCSV(w *bufio.Writer) func(*types.User) error {
+	cw := csv.NewWriter(w)
+	cw.Write(exportColumns)
+	cw.Flush()
+	return func(u *types.User) error {
+		cw.Write([]string{
+			strconv.Itoa(u.ID),
+			u.FirstName,
+			u.LastName,
+			u.Email,
+			strconv.FormatBool(u.IsAdmin),
+			u.CreatedAt.Format(time.RFC3339),
+			strconv.Itoa(u.Version),
+		})
+		cw.Flush()
+		return cw.Error()
+	}
+}
+
+func encodeNDJSON(w *bufio.Writer) func(*types.User) error {
+	enc := json.NewEncoder(w)
+	return func(u *types.User) error {
+		return enc.Encode(u)
+	}
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fiber/store"
+	"fiber/types"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type fakeImporter struct {
+	imported []*types.User
+	opts     store.ImportOptions
+	// failEmail makes the store reject the user with that email.
+	failEmail string
+	exported  []*types.User
+}
+
+func (f *fakeImporter) ImportUsers(_ context.Context, users []*types.User, opts store.ImportOptions) ([]error, error) {
+	f.imported, f.opts = users, opts
+	rowErrs := make([]error, len(users))
+	for i, u := range users {
+		if u.Email == f.failEmail {
+			rowErrs[i] = errors.New("insert failed")
+		}
+	}
+	return rowErrs, nil
+}
+
+func (f *fakeImporter) ExportUsers(_ context.Context, fn func(*types.User) error) error {
+	for _, u := range f.exported {
+		if err := fn(u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func postImport(t *testing.T, importer *fakeImporter, query, contentType, body string) (int, types.ImportReport) {
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Post("/users/import", NewImportHandler(importer).HandleImportUsers)
+
+	req := httptest.NewRequest("POST", "/users/import"+query, strings.NewReader(body))
+	req.Header.Set(fiber.HeaderContentType, contentType)
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report types.ImportReport
+	json.NewDecoder(resp.Body).Decode(&report)
+	return resp.StatusCode, report
+}
+
+const importCSV = `firstName,lastName,email,password
+James,Foo,james@foo.com,supersecure
+Jo,Bar,jo@foo.com,supersecure
+Anna,Baz,james@foo.com,supersecure
+`
+
+func TestHandleImportUsersReportsRows(t *testing.T) {
+	importer := &fakeImporter{}
+	status, report := postImport(t, importer, "?dryRun=true", "text/csv", importCSV)
+	if status != fiber.StatusOK {
+		t.Fatalf("expected status code %d but got %d", fiber.StatusOK, status)
+	}
+	if report.Total != 3 || report.Imported != 1 || report.Failed != 2 || !report.DryRun {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if report.Errors[0].Row != 2 || report.Errors[0].Errors["firstName"] == "" {
+		t.Errorf("expected row 2 to fail on firstName but got %+v", report.Errors[0])
+	}
+	if report.Errors[1].Row != 3 || report.Errors[1].Errors["email"] == "" {
+		t.Errorf("expected row 3 to fail on a duplicate email but got %+v", report.Errors[1])
+	}
+	if len(importer.imported) != 1 || !importer.opts.DryRun {
+		t.Errorf("expected one user in a dry run to reach the store but got %d (%+v)", len(importer.imported), importer.opts)
+	}
+}
+
+func TestHandleImportUsersAtomic(t *testing.T) {
+	importer := &fakeImporter{}
+	status, report := postImport(t, importer, "?atomic=true", "text/csv", importCSV)
+	if status != fiber.StatusUnprocessableEntity {
+		t.Fatalf("expected status code %d but got %d", fiber.StatusUnprocessableEntity, status)
+	}
+	if report.Imported != 0 || report.Failed != 2 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if importer.imported != nil {
+		t.Errorf("expected an invalid atomic import not to reach the store")
+	}
+}
+
+func TestHandleImportUsersNDJSON(t *testing.T) {
+	importer := &fakeImporter{failEmail: "jo@foo.com"}
+	body := `{"firstName":"James","lastName":"Foo","email":"james@foo.com","password":"supersecure"}
+
+{"firstName":"Joanna","lastName":"Bar","email":"jo@foo.com","password":"supersecure"}
+{"firstName":"Anna","isAdmin":true}
+`
+	status, report := postImport(t, importer, "?dryRun=true", "application/x-ndjson", body)
+	if status != fiber.StatusOK {
+		t.Fatalf("expected status code %d but got %d", fiber.StatusOK, status)
+	}
+	if report.Total != 3 || report.Imported != 1 || report.Failed != 2 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if report.Errors[0].Row != 2 || report.Errors[1].Row != 3 {
+		t.Errorf("expected rows 2 and 3 to fail but got %+v", report.Errors)
+	}
+}
+
+func TestHandleImportUsersContentType(t *testing.T) {
+	if status, _ := postImport(t, &fakeImporter{}, "", "application/json", "[]"); status != fiber.StatusUnsupportedMediaType {
+		t.Fatalf("expected status code %d but got %d", fiber.StatusUnsupportedMediaType, status)
+	}
+	if status, _ := postImport(t, &fakeImporter{}, "", "text/csv", "name,email\n"); status != fiber.StatusBadRequest {
+		t.Fatalf("expected status code %d but got %d", fiber.StatusBadRequest, status)
+	}
+}
+
+func TestHandleExportUsersCSV(t *testing.T) {
+	importer := &fakeImporter{exported: []*types.User{
+		{ID: 1, FirstName: "James", LastName: "Foo", Email: "james@foo.com", Version: 2},
+	}}
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Get("/users/export", NewImportHandler(importer).HandleExportUsers)
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/users/export?format=csv", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	want := "id,firstName,lastName,email,isAdmin,createdAt,version\n1,James,Foo,james@foo.com,false,0001-01-01T00:00:00Z,2\n"
+	if string(body) != want {
+		t.Fatalf("expected %q but got %q", want, body)
+	}
+	if ct := resp.Header.Get(fiber.HeaderContentType); ct != "text/csv" {
+		t.Errorf("expected text/csv but got %s", ct)
+	}
+}
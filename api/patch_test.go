@@ -0,0 +1,55 @@
+package api
+
+import (
+	"fiber/patch"
+	"fiber/types"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestPatchUserParams(t *testing.T) {
+	user := &types.User{FirstName: "James", LastName: "Foo", Email: "james@foo.com"}
+
+	params, err := patchUserParams(user, []byte(`{"lastName":"Bar"}`), patch.MergePatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params.FirstName != "James" || params.LastName != "Bar" || params.Email != "james@foo.com" {
+		t.Fatalf("unexpected params %+v", params)
+	}
+
+	params, err = patchUserParams(user, []byte(`[{"op":"replace","path":"/email","value":"new@foo.com"}]`), patch.JSONPatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params.Email != "new@foo.com" {
+		t.Fatalf("expected new@foo.com got %s", params.Email)
+	}
+}
+
+func TestPatchUserParamsRejects(t *testing.T) {
+	user := &types.User{FirstName: "James", LastName: "Foo", Email: "james@foo.com"}
+
+	tests := map[string]struct {
+		body   string
+		apply  func(doc, patch []byte) ([]byte, error)
+		status int
+	}{
+		"cleared field": {`{"firstName":null}`, patch.MergePatch, fiber.StatusUnprocessableEntity},
+		"unknown field": {`{"isAdmin":true}`, patch.MergePatch, fiber.StatusUnprocessableEntity},
+		"invalid email": {`[{"op":"replace","path":"/email","value":"nope"}]`, patch.JSONPatch, fiber.StatusUnprocessableEntity},
+		"failed test":   {`[{"op":"test","path":"/email","value":"x@foo.com"}]`, patch.JSONPatch, fiber.StatusConflict},
+		"bad patch":     {`[{"op":"remove","path":"/missing"}]`, patch.JSONPatch, fiber.StatusBadRequest},
+	}
+	for name, tt := range tests {
+		_, err := patchUserParams(user, []byte(tt.body), tt.apply)
+		if err == nil {
+			t.Errorf("%s: expected an error", name)
+			continue
+		}
+		if status := StatusCode(err); status != tt.status {
+			t.Errorf("%s: expected status %d got %d (%v)", name, tt.status, status, err)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fiber/store"
+	"fiber/types"
+	"fiber/webhook"
+	"fmt"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type WebhookHandler struct {
+	webhookStore store.WebhookStore
+	targets      webhook.TargetPolicy
+}
+
+func NewWebhookHandler(webhookStore store.WebhookStore, targets webhook.TargetPolicy) *WebhookHandler {
+	return &WebhookHandler{
+		webhookStore: webhookStore,
+		targets:      targets,
+	}
+}
+
+// validateWebhook checks params and that their URL is a target deliveries
+// may be sent to.
+func (h *WebhookHandler) validateWebhook(c *fiber.Ctx, params types.WebhookParams) error {
+	if errors := params.Validate(); len(errors) > 0 {
+		return NewValidationError(errors)
+	}
+	if err := h.targets.CheckURL(c.UserContext(), params.URL); err != nil {
+		if errors.Is(err, webhook.ErrForbiddenTarget) {
+			return NewValidationError(map[string]string{"url": "url should not point to a loopback, private or link-local address"})
+		}
+		return NewValidationError(map[string]string{"url": "url host could not be resolved"})
+	}
+	return nil
+}
+
+func (h *WebhookHandler) HandlePostWebhook(c *fiber.Ctx) error {
+	var params types.WebhookParams
+	if err := c.BodyParser(&params); err != nil {
+		return ErrBadRequest()
+	}
+	if err := h.validateWebhook(c, params); err != nil {
+		return err
+	}
+	hook, err := h.webhookStore.CreateWebhook(c.UserContext(), params.Webhook())
+	if err != nil {
+		return err
+	}
+	return c.JSON(hook)
+}
+
+func (h *WebhookHandler) HandleGetWebhooks(c *fiber.Ctx) error {
+	webhooks, err := h.webhookStore.GetWebhooks(c.UserContext())
+	if err != nil {
+		return err
+	}
+	return c.JSON(webhooks)
+}
+
+func (h *WebhookHandler) HandleGetWebhook(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return ErrInvalidID()
+	}
+	hook, err := h.webhookStore.GetWebhookByID(c.UserContext(), id)
+	if err != nil {
+		return webhookError(err, id)
+	}
+	return c.JSON(hook)
+}
+
+// HandlePutWebhook replaces a webhook as a whole, secret included.
+func (h *WebhookHandler) HandlePutWebhook(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return ErrInvalidID()
+	}
+	var params types.WebhookParams
+	if err := c.BodyParser(&params); err != nil {
+		return ErrBadRequest()
+	}
+	if err := h.validateWebhook(c, params); err != nil {
+		return err
+	}
+	hook, err := h.webhookStore.UpdateWebhook(c.UserContext(), id, params.Webhook())
+	if err != nil {
+		return webhookError(err, id)
+	}
+	return c.JSON(hook)
+}
+
+func (h *WebhookHandler) HandleDeleteWebhook(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return ErrInvalidID()
+	}
+	if err := h.webhookStore.DeleteWebhook(c.UserContext(), id); err != nil {
+		return webhookError(err, id)
+	}
+	return c.JSON(map[string]string{"deleted": fmt.Sprintf("webhook with id %d", id)})
+}
+
+// HandleGetWebhookDeliveries lists deliveries, newest first. status=dead lists
+// the dead letters.
+func (h *WebhookHandler) HandleGetWebhookDeliveries(c *fiber.Ctx) error {
+	var filter types.WebhookDeliveryFilter
+	if err := c.QueryParser(&filter); err != nil {
+		return NewError(fiber.StatusBadRequest, "invalid query parameters")
+	}
+	if errors := filter.Validate(); len(errors) > 0 {
+		return NewValidationError(errors)
+	}
+	deliveries, err := h.webhookStore.GetWebhookDeliveries(c.UserContext(), filter)
+	if err != nil {
+		return err
+	}
+	return c.JSON(deliveries)
+}
+
+// HandleRedeliverWebhook sends a dead or delivered delivery again.
+func (h *WebhookHandler) HandleRedeliverWebhook(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return ErrInvalidID()
+	}
+	delivery, err := h.webhookStore.RedeliverWebhook(c.UserContext(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound(id, "Finished webhook delivery")
+		}
+		return err
+	}
+	return c.JSON(delivery)
+}
+
+func webhookError(err error, id int) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound(id, "Webhook")
+	}
+	return err
+}
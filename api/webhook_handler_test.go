@@ -0,0 +1,192 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fiber/types"
+	"fiber/webhook"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// memWebhookStore keeps webhooks in a map; it has no deliveries.
+type memWebhookStore struct {
+	webhooks map[int]*types.Webhook
+	filter   types.WebhookDeliveryFilter
+}
+
+func (s *memWebhookStore) CreateWebhook(_ context.Context, webhook *types.Webhook) (*types.Webhook, error) {
+	webhook.ID = len(s.webhooks) + 1
+	s.webhooks[webhook.ID] = webhook
+	return webhook, nil
+}
+
+func (s *memWebhookStore) GetWebhooks(context.Context) ([]*types.Webhook, error) {
+	webhooks := []*types.Webhook{}
+	for _, webhook := range s.webhooks {
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, nil
+}
+
+func (s *memWebhookStore) GetWebhookByID(_ context.Context, id int) (*types.Webhook, error) {
+	webhook, ok := s.webhooks[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return webhook, nil
+}
+
+func (s *memWebhookStore) UpdateWebhook(_ context.Context, id int, webhook *types.Webhook) (*types.Webhook, error) {
+	if _, ok := s.webhooks[id]; !ok {
+		return nil, sql.ErrNoRows
+	}
+	webhook.ID = id
+	s.webhooks[id] = webhook
+	return webhook, nil
+}
+
+func (s *memWebhookStore) DeleteWebhook(_ context.Context, id int) error {
+	if _, ok := s.webhooks[id]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(s.webhooks, id)
+	return nil
+}
+
+func (s *memWebhookStore) GetWebhookDeliveries(_ context.Context, filter types.WebhookDeliveryFilter) ([]*types.WebhookDelivery, error) {
+	s.filter = filter
+	return []*types.WebhookDelivery{}, nil
+}
+
+func (s *memWebhookStore) RedeliverWebhook(context.Context, int64) (*types.WebhookDelivery, error) {
+	return nil, sql.ErrNoRows
+}
+
+func newWebhookApp() (*fiber.App, *memWebhookStore) {
+	s := &memWebhookStore{webhooks: map[int]*types.Webhook{}}
+	// Host names resolve to a public address, except internal.example.com.
+	h := NewWebhookHandler(s, webhook.TargetPolicy{LookupIP: func(_ context.Context, host string) ([]net.IP, error) {
+		if host == "internal.example.com" {
+			return []net.IP{net.ParseIP("10.0.0.5")}, nil
+		}
+		return []net.IP{net.ParseIP("93.184.216.34")}, nil
+	}})
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Post("/webhooks", h.HandlePostWebhook)
+	app.Get("/webhooks/deliveries", h.HandleGetWebhookDeliveries)
+	app.Post("/webhooks/deliveries/:id/redeliver", h.HandleRedeliverWebhook)
+	app.Get("/webhooks/:id", h.HandleGetWebhook)
+	app.Put("/webhooks/:id", h.HandlePutWebhook)
+	return app, s
+}
+
+func sendJSON(t *testing.T, app *fiber.App, method, path string, body any) (int, map[string]any) {
+	b, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, path, bytes.NewReader(b))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out map[string]any
+	json.NewDecoder(resp.Body).Decode(&out)
+	return resp.StatusCode, out
+}
+
+func TestHandlePostWebhook(t *testing.T) {
+	app, s := newWebhookApp()
+
+	params := types.WebhookParams{
+		URL:    "https://crm.example.com/hooks",
+		Events: []string{types.WebhookUserDeleted, types.WebhookUserCreated, types.WebhookUserCreated},
+		Secret: "a very secret secret",
+	}
+	status, body := sendJSON(t, app, fiber.MethodPost, "/webhooks", params)
+	if status != fiber.StatusOK {
+		t.Fatalf("expected status code %d but got %d: %v", fiber.StatusOK, status, body)
+	}
+	if _, ok := body["secret"]; ok {
+		t.Error("expected the secret not to be returned")
+	}
+	created := s.webhooks[1]
+	if !created.Active || created.Secret != params.Secret || strings.Join(created.Events, ",") != "user.created,user.deleted" {
+		t.Errorf("unexpected webhook %+v", created)
+	}
+
+	inactive := false
+	params.Active = &inactive
+	if status, _ := sendJSON(t, app, fiber.MethodPut, "/webhooks/1", params); status != fiber.StatusOK || s.webhooks[1].Active {
+		t.Errorf("expected the webhook to be deactivated, got status %d", status)
+	}
+	if status, _ := sendJSON(t, app, fiber.MethodPut, "/webhooks/2", params); status != fiber.StatusNotFound {
+		t.Errorf("expected status code %d for a missing webhook but got %d", fiber.StatusNotFound, status)
+	}
+}
+
+func TestHandlePostWebhookInvalid(t *testing.T) {
+	app, s := newWebhookApp()
+
+	status, body := sendJSON(t, app, fiber.MethodPost, "/webhooks", types.WebhookParams{URL: "crm", Events: []string{"user.renamed"}})
+	if status != fiber.StatusUnprocessableEntity {
+		t.Fatalf("expected status code %d but got %d", fiber.StatusUnprocessableEntity, status)
+	}
+	errors, _ := body["errors"].(map[string]any)
+	for _, field := range []string{"url", "events", "secret"} {
+		if _, ok := errors[field]; !ok {
+			t.Errorf("expected an error for %s, got %v", field, errors)
+		}
+	}
+	if len(s.webhooks) != 0 {
+		t.Error("expected no webhook to be created")
+	}
+}
+
+func TestHandlePostWebhookPrivateTarget(t *testing.T) {
+	app, s := newWebhookApp()
+
+	for _, url := range []string{"http://127.0.0.1:9091/metrics", "http://169.254.169.254/latest", "https://internal.example.com/hooks"} {
+		params := types.WebhookParams{URL: url, Events: []string{types.WebhookUserCreated}, Secret: "a very secret secret"}
+		status, body := sendJSON(t, app, fiber.MethodPost, "/webhooks", params)
+		if status != fiber.StatusUnprocessableEntity {
+			t.Errorf("%s: expected status code %d but got %d", url, fiber.StatusUnprocessableEntity, status)
+			continue
+		}
+		if errors, _ := body["errors"].(map[string]any); errors["url"] == nil {
+			t.Errorf("%s: expected an error for url, got %v", url, body)
+		}
+	}
+	if len(s.webhooks) != 0 {
+		t.Error("expected no webhook to be created")
+	}
+}
+
+func TestHandleWebhookDeliveries(t *testing.T) {
+	app, s := newWebhookApp()
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/webhooks/deliveries?status=dead&webhookId=3", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusOK || s.filter.Status != types.WebhookDead || s.filter.WebhookID != 3 {
+		t.Errorf("expected dead deliveries of webhook 3, got status %d and filter %+v", resp.StatusCode, s.filter)
+	}
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/webhooks/deliveries?status=lost", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusUnprocessableEntity {
+		t.Errorf("expected status code %d but got %d", fiber.StatusUnprocessableEntity, resp.StatusCode)
+	}
+
+	if status, _ := sendJSON(t, app, fiber.MethodPost, "/webhooks/deliveries/9/redeliver", nil); status != fiber.StatusNotFound {
+		t.Errorf("expected status code %d but got %d", fiber.StatusNotFound, status)
+	}
+}
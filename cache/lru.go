@@ -0,0 +1,48 @@
+// Package cache holds the backends of store.CachedStore: an LRU of this
+// process and Redis, shared by all replicas.
+package cache
+
+import (
+	"context"
+	"fiber/types"
+	"time"
+
+	"github.com/hashicorp/golang-lru/v2/expirable"
+)
+
+// LRU keeps up to size users in memory for ttl each. Users are copied in and
+// out, so callers may change the ones they get.
+type LRU struct {
+	users *expirable.LRU[int, types.User]
+}
+
+func NewLRU(size int, ttl time.Duration) *LRU {
+	return &LRU{users: expirable.NewLRU[int, types.User](size, nil, ttl)}
+}
+
+func (c *LRU) Get(_ context.Context, id int) (*types.User, bool, error) {
+	user, ok := c.users.Get(id)
+	if !ok {
+		return nil, false, nil
+	}
+	return &user, true, nil
+}
+
+func (c *LRU) Set(_ context.Context, user *types.User) error {
+	c.users.Add(user.ID, *user)
+	return nil
+}
+
+func (c *LRU) Delete(_ context.Context, id int) error {
+	c.users.Remove(id)
+	return nil
+}
+
+func (c *LRU) Clear(context.Context) error {
+	c.users.Purge()
+	return nil
+}
+
+func (c *LRU) Len() int {
+	return c.users.Len()
+}
@@ -0,0 +1,53 @@
+package cache
+
+import (
+	"context"
+	"fiber/types"
+	"testing"
+	"time"
+)
+
+func TestLRU(t *testing.T) {
+	ctx := context.Background()
+	c := NewLRU(2, time.Minute)
+
+	for id := 1; id <= 3; id++ {
+		if err := c.Set(ctx, &types.User{ID: id, EncryptedPassword: "hash"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok, _ := c.Get(ctx, 1); ok {
+		t.Error("expected the least recently used user to be evicted")
+	}
+	user, ok, err := c.Get(ctx, 3)
+	if err != nil || !ok {
+		t.Fatalf("expected user 3 to be cached, got %v %v", ok, err)
+	}
+	if user.EncryptedPassword != "hash" {
+		t.Errorf("expected the password hash to be kept, got %+v", user)
+	}
+
+	user.FirstName = "changed"
+	if cached, _, _ := c.Get(ctx, 3); cached.FirstName != "" {
+		t.Error("expected the cached user not to share memory with the callers")
+	}
+
+	if err := c.Delete(ctx, 3); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := c.Get(ctx, 3); ok {
+		t.Error("expected user 3 to be deleted")
+	}
+}
+
+func TestLRUExpires(t *testing.T) {
+	ctx := context.Background()
+	c := NewLRU(10, 10*time.Millisecond)
+	if err := c.Set(ctx, &types.User{ID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, ok, _ := c.Get(ctx, 1); ok {
+		t.Error("expected the user to expire")
+	}
+}
@@ -0,0 +1,84 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fiber/types"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis keeps users as JSON under <prefix><id> for ttl each.
+type Redis struct {
+	client redis.UniversalClient
+	prefix string
+	ttl    time.Duration
+}
+
+func NewRedis(client redis.UniversalClient, prefix string, ttl time.Duration) *Redis {
+	return &Redis{client: client, prefix: prefix, ttl: ttl}
+}
+
+// cachedUser is types.User with the password hash, which the JSON of User
+// leaves out but authentication needs.
+type cachedUser struct {
+	types.User
+	EncryptedPassword string `json:"pass"`
+}
+
+func (c *Redis) key(id int) string {
+	return c.prefix + strconv.Itoa(id)
+}
+
+func (c *Redis) Get(ctx context.Context, id int) (*types.User, bool, error) {
+	data, err := c.client.Get(ctx, c.key(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	var cached cachedUser
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return nil, false, err
+	}
+	cached.User.EncryptedPassword = cached.EncryptedPassword
+	return &cached.User, true, nil
+}
+
+func (c *Redis) Set(ctx context.Context, user *types.User) error {
+	data, err := json.Marshal(cachedUser{User: *user, EncryptedPassword: user.EncryptedPassword})
+	if err != nil {
+		return err
+	}
+	return c.client.Set(ctx, c.key(user.ID), data, c.ttl).Err()
+}
+
+func (c *Redis) Delete(ctx context.Context, id int) error {
+	return c.client.Del(ctx, c.key(id)).Err()
+}
+
+// Clear deletes every key with the prefix of c.
+func (c *Redis) Clear(ctx context.Context) error {
+	iter := c.client.Scan(ctx, 0, c.prefix+"*", 100).Iterator()
+	var keys []string
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+		if len(keys) == 100 {
+			if err := c.client.Del(ctx, keys...).Err(); err != nil {
+				return err
+			}
+			keys = keys[:0]
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	if len(keys) > 0 {
+		return c.client.Del(ctx, keys...).Err()
+	}
+	return nil
+}
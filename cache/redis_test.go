@@ -0,0 +1,58 @@
+package cache
+
+import (
+	"context"
+	"fiber/types"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRedis(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	c := NewRedis(client, "test:user:", time.Minute)
+	ctx := context.Background()
+
+	if _, ok, err := c.Get(ctx, 1); ok || err != nil {
+		t.Fatalf("expected a miss, got %v %v", ok, err)
+	}
+	for id := 1; id <= 2; id++ {
+		if err := c.Set(ctx, &types.User{ID: id, Email: "ada@example.com", EncryptedPassword: "hash", Version: 3}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	user, ok, err := c.Get(ctx, 1)
+	if err != nil || !ok {
+		t.Fatalf("expected a hit, got %v %v", ok, err)
+	}
+	if user.Email != "ada@example.com" || user.EncryptedPassword != "hash" || user.Version != 3 {
+		t.Errorf("unexpected user %+v", user)
+	}
+
+	if err := c.Delete(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := c.Get(ctx, 1); ok {
+		t.Error("expected user 1 to be deleted")
+	}
+
+	mr.FastForward(2 * time.Minute)
+	if _, ok, _ := c.Get(ctx, 2); ok {
+		t.Error("expected user 2 to expire")
+	}
+
+	mr.Set("other", "kept")
+	if err := c.Set(ctx, &types.User{ID: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Clear(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if keys := mr.Keys(); len(keys) != 1 || keys[0] != "other" {
+		t.Errorf("expected only the keys of the cache to be cleared, got %v", keys)
+	}
+}
@@ -0,0 +1,246 @@
+// Package client is a typed Go client for the user API.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fiber/requestid"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Client calls the user API. It logs in with the credentials it was given and
+// logs in again when the token is rejected, so callers never handle tokens.
+// A Client is safe for concurrent use.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	timeout    time.Duration
+	retries    int
+	backoff    time.Duration
+
+	mu       sync.Mutex
+	email    string
+	password string
+	token    string
+}
+
+type Option func(*Client)
+
+// WithHTTPClient sets the http.Client requests are sent with.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithTimeout bounds every attempt of a request; 0 disables it.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = timeout
+	}
+}
+
+// WithRetries retries a request up to retries times after a network error or
+// a 429, 502, 503 or 504, waiting backoff before the first retry and doubling
+// it after each one.
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = retries
+		c.backoff = backoff
+	}
+}
+
+// WithCredentials makes the client log in as email on its first request.
+func WithCredentials(email, password string) Option {
+	return func(c *Client) {
+		c.email = email
+		c.password = password
+	}
+}
+
+// New returns a client for the API at baseURL, such as http://localhost:3000.
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: http.DefaultClient,
+		timeout:    10 * time.Second,
+		retries:    2,
+		backoff:    100 * time.Millisecond,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// request is an API call. Mutations other than PUT and DELETE get an
+// Idempotency-Key, so every request can be retried safely.
+type request struct {
+	method      string
+	path        string
+	body        any
+	contentType string
+	header      http.Header
+	// public requests are sent without a token.
+	public bool
+}
+
+// response is a successful API response whose body has been read.
+type response struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// do sends req, logging in first if needed and once more if the token was
+// rejected, and decodes a successful JSON response into out when it is not nil.
+func (c *Client) do(ctx context.Context, req request, out any) (*response, error) {
+	var body []byte
+	if req.body != nil {
+		var err error
+		if body, err = json.Marshal(req.body); err != nil {
+			return nil, err
+		}
+		if req.contentType == "" {
+			req.contentType = "application/json"
+		}
+	}
+	if req.header == nil {
+		req.header = http.Header{}
+	}
+	if req.method == http.MethodPost || req.method == http.MethodPatch {
+		if req.header.Get("Idempotency-Key") == "" {
+			req.header.Set("Idempotency-Key", uuid.NewString())
+		}
+	}
+
+	resp, err := c.send(ctx, req, body, false)
+	if err != nil {
+		return nil, err
+	}
+	if out != nil && len(resp.body) > 0 {
+		if err := json.Unmarshal(resp.body, out); err != nil {
+			return nil, fmt.Errorf("decode %s %s response: %w", req.method, req.path, err)
+		}
+	}
+	return resp, nil
+}
+
+func (c *Client) send(ctx context.Context, req request, body []byte, relogin bool) (*response, error) {
+	var token string
+	if !req.public {
+		var err error
+		if token, err = c.currentToken(ctx, relogin); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := c.sendWithRetries(ctx, req, body, token)
+	if err != nil {
+		return nil, err
+	}
+	if resp.status == http.StatusUnauthorized && !req.public && !relogin && c.hasCredentials() {
+		return c.send(ctx, req, body, true)
+	}
+	if resp.status >= http.StatusBadRequest {
+		return nil, decodeError(resp)
+	}
+	return resp, nil
+}
+
+func (c *Client) sendWithRetries(ctx context.Context, req request, body []byte, token string) (*response, error) {
+	backoff := c.backoff
+	for attempt := 0; ; attempt++ {
+		resp, err := c.attempt(ctx, req, body, token)
+		if attempt == c.retries || !retryable(resp, err) || ctx.Err() != nil {
+			return resp, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (c *Client) attempt(ctx context.Context, req request, body []byte, token string) (*response, error) {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, c.baseURL+req.path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range req.header {
+		httpReq.Header[name] = values
+	}
+	if req.contentType != "" {
+		httpReq.Header.Set("Content-Type", req.contentType)
+	}
+	if token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+token)
+	}
+	if id := requestid.FromContext(ctx); id != "" {
+		httpReq.Header.Set(requestid.Header, id)
+	}
+
+	httpResp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+	respBody, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &response{status: httpResp.StatusCode, header: httpResp.Header, body: respBody}, nil
+}
+
+func retryable(resp *response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled)
+	}
+	switch resp.status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func (c *Client) hasCredentials() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.email != ""
+}
+
+// currentToken returns the token to send, logging in when there is none yet
+// or when refresh is set.
+func (c *Client) currentToken(ctx context.Context, refresh bool) (string, error) {
+	c.mu.Lock()
+	token, email, password := c.token, c.email, c.password
+	c.mu.Unlock()
+	if token != "" && !refresh {
+		return token, nil
+	}
+	if email == "" {
+		return token, nil
+	}
+	if _, err := c.Login(ctx, email, password); err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.token, nil
+}
@@ -0,0 +1,183 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fiber/api"
+	"fiber/middleware"
+	"fiber/store/storetest"
+	"fiber/types"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gofiber/adaptor/v2"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	adminEmail    = "admin@foo.com"
+	adminPassword = "supersecure"
+)
+
+// newServer runs the real handlers over a storetest.MemStore. unavailable makes that
+// many requests fail with 503 before they reach the handlers.
+func newServer(t *testing.T, unavailable int32) (*httptest.Server, *storetest.MemStore) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	s := storetest.NewMemStore()
+	admin, err := types.NewUserFromParams(types.CreateUserParams{FirstName: "Admin", LastName: "Admin", Email: adminEmail, Password: adminPassword})
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin.IsAdmin = true
+	s.InsertUser(context.Background(), admin)
+
+	var failures atomic.Int32
+	failures.Store(unavailable)
+	userHandler := api.NewUserHandler(s)
+	authHandler := api.NewAuthHandler(s, storetest.NopAuditStore{})
+	withAuth := func(h fiber.Handler) fiber.Handler {
+		return middleware.JWTAuthentication(h, s)
+	}
+
+	app := fiber.New(fiber.Config{ErrorHandler: api.ErrorHandler})
+	app.Use(func(c *fiber.Ctx) error {
+		if failures.Add(-1) >= 0 {
+			return api.NewError(fiber.StatusServiceUnavailable, "unavailable")
+		}
+		return c.Next()
+	})
+	app.Post("/api/auth", authHandler.HandleAuthenticate)
+	app.Post("/api/v1/user", withAuth(userHandler.HandlePostUser))
+	app.Get("/api/v1/user/:id", withAuth(userHandler.HandleGetUserByID))
+	app.Put("/api/v1/user/:id", withAuth(userHandler.HandlePutUser))
+	app.Patch("/api/v1/user/:id", withAuth(userHandler.HandlePatchUser))
+	app.Delete("/api/v1/user/:id", withAuth(userHandler.HandleDeleteUser))
+	app.Post("/api/v1/user/:id/restore", withAuth(middleware.AdminOnly(userHandler.HandleRestoreUser)))
+	app.Get("/api/v1/users", withAuth(userHandler.HandleGetUsers))
+
+	server := httptest.NewServer(adaptor.FiberApp(app))
+	t.Cleanup(server.Close)
+	return server, s
+}
+
+func TestClientUserLifecycle(t *testing.T) {
+	server, _ := newServer(t, 0)
+	ctx := context.Background()
+	c := New(server.URL, WithCredentials(adminEmail, adminPassword))
+
+	created, err := c.CreateUser(ctx, types.CreateUserParams{FirstName: "James", LastName: "Foo", Email: "james@foo.com", Password: "supersecure"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := c.GetUser(ctx, created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Email != "james@foo.com" || got.Version != 1 {
+		t.Fatalf("unexpected user %+v", got)
+	}
+
+	updated, err := c.UpdateUser(ctx, got.ID, types.UpdateUserParams{FirstName: "Jimmy", LastName: "Foo", Email: "james@foo.com"}, IfVersion(got.Version))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.PatchUser(ctx, got.ID, map[string]any{"lastName": "Bar"}, IfVersion(got.Version)); !IsPreconditionFailed(err) {
+		t.Fatalf("expected a precondition failure for a stale version but got %v", err)
+	}
+	patched, err := c.PatchUser(ctx, got.ID, map[string]any{"lastName": "Bar"}, IfVersion(updated.Version))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if patched.FirstName != "Jimmy" || patched.LastName != "Bar" {
+		t.Fatalf("unexpected user %+v", patched)
+	}
+
+	if err := c.DeleteUser(ctx, got.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetUser(ctx, got.ID); !IsNotFound(err) {
+		t.Fatalf("expected a deleted user to be not found but got %v", err)
+	}
+	if _, err := c.RestoreUser(ctx, got.ID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClientTypedErrors(t *testing.T) {
+	server, _ := newServer(t, 0)
+	ctx := context.Background()
+
+	if _, err := New(server.URL).GetUser(ctx, 1); StatusCode(err) != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without credentials but got %v", err)
+	}
+
+	c := New(server.URL, WithCredentials(adminEmail, adminPassword))
+	_, err := c.CreateUser(ctx, types.CreateUserParams{FirstName: "J", LastName: "Foo", Email: "nope", Password: "supersecure"})
+	var valErr *ValidationError
+	if !errors.As(err, &valErr) || valErr.Errors["firstName"] == "" || valErr.Errors["email"] == "" {
+		t.Fatalf("expected a validation error but got %v", err)
+	}
+
+	_, err = c.GetUser(ctx, 42)
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.Code != http.StatusNotFound || apiErr.Message == "" {
+		t.Fatalf("expected a not found error but got %v", err)
+	}
+}
+
+func TestClientRefreshesToken(t *testing.T) {
+	server, _ := newServer(t, 0)
+	ctx := context.Background()
+	c := New(server.URL, WithCredentials(adminEmail, adminPassword))
+	if _, err := c.GetUser(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	c.mu.Lock()
+	c.token = "expired"
+	c.mu.Unlock()
+	if _, err := c.GetUser(ctx, 1); err != nil {
+		t.Fatalf("expected the client to log in again but got %v", err)
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+	server, _ := newServer(t, 2)
+	ctx := context.Background()
+
+	c := New(server.URL, WithCredentials(adminEmail, adminPassword), WithRetries(2, time.Millisecond))
+	if _, err := c.GetUser(ctx, 1); err != nil {
+		t.Fatalf("expected the retries to get through but got %v", err)
+	}
+
+	server, _ = newServer(t, 1)
+	c = New(server.URL, WithCredentials(adminEmail, adminPassword), WithRetries(0, 0))
+	if _, err := c.GetUser(ctx, 1); StatusCode(err) != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 without retries but got %v", err)
+	}
+}
+
+func TestClientUsersIterator(t *testing.T) {
+	server, _ := newServer(t, 0)
+	ctx := context.Background()
+	c := New(server.URL, WithCredentials(adminEmail, adminPassword), WithHTTPClient(&http.Client{}))
+	for _, email := range []string{"a@foo.com", "b@foo.com", "c@foo.com"} {
+		if _, err := c.CreateUser(ctx, types.CreateUserParams{FirstName: "James", LastName: "Foo", Email: email, Password: "supersecure"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var ids []int
+	for user, err := range c.Users(ctx, 2) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, user.ID)
+	}
+	if len(ids) != 4 || ids[0] != 1 || ids[3] != 4 {
+		t.Fatalf("expected users 1 to 4 but got %v", ids)
+	}
+}
@@ -0,0 +1,69 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Error mirrors api.Error, the body of every failed request other than a
+// validation failure.
+type Error struct {
+	Code      int    `json:"code"`
+	Message   string `json:"error"`
+	RequestID string `json:"requestId,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("api error %d: %s", e.Code, e.Message)
+}
+
+// ValidationError mirrors api.ValidationError; Errors holds a message per field.
+type ValidationError struct {
+	Status    int               `json:"status"`
+	Errors    map[string]string `json:"errors"`
+	RequestID string            `json:"requestId,omitempty"`
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("api validation failed: %v", e.Errors)
+}
+
+// StatusCode returns the HTTP status of an API error, or 0 for other errors.
+func StatusCode(err error) int {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code
+	}
+	var valErr *ValidationError
+	if errors.As(err, &valErr) {
+		return valErr.Status
+	}
+	return 0
+}
+
+func IsNotFound(err error) bool {
+	return StatusCode(err) == http.StatusNotFound
+}
+
+// IsPreconditionFailed reports whether a conditional request lost to a
+// concurrent change.
+func IsPreconditionFailed(err error) bool {
+	return StatusCode(err) == http.StatusPreconditionFailed
+}
+
+func decodeError(resp *response) error {
+	if resp.status == http.StatusUnprocessableEntity {
+		var valErr ValidationError
+		if err := json.Unmarshal(resp.body, &valErr); err == nil && valErr.Errors != nil {
+			return &valErr
+		}
+	}
+	apiErr := Error{Code: resp.status}
+	if err := json.Unmarshal(resp.body, &apiErr); err != nil || apiErr.Message == "" {
+		apiErr.Message = http.StatusText(resp.status)
+	}
+	apiErr.Code = resp.status
+	return &apiErr
+}
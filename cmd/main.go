@@ -1,8 +1,12 @@
 package main
 
 import (
+	"context"
+	"fiber/logging"
 	"fiber/server"
+	"fiber/tracing"
 	"log"
+	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
@@ -14,9 +18,15 @@ const listenAddr = "0.0.0.0:3000"
 
 func init() {
 	mustLoadEnvVariables()
+	slog.SetDefault(slog.New(logging.NewContextHandler(slog.NewTextHandler(os.Stderr, nil))))
 }
 
 func main() {
+	shutdownTracing, err := tracing.Setup(context.Background(), "fiber_crud")
+	if err != nil {
+		log.Fatal("Error setting up tracing: ", err)
+	}
+
 	s := server.NewServer(listenAddr)
 
 	go s.Run()
@@ -26,6 +36,9 @@ func main() {
 	<-sigch
 	log.Println("Received shutdown signal, shutting down server...")
 	s.Stop()
+	if err := shutdownTracing(context.Background()); err != nil {
+		log.Println("Error flushing traces:", err)
+	}
 }
 
 func mustLoadEnvVariables() {
@@ -0,0 +1,158 @@
+package fault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInjectedDBFailure is returned by the store when a rule asks for a database failure.
+var ErrInjectedDBFailure = errors.New("injected database failure")
+
+type Rule struct {
+	Method        string  `json:"method"`
+	Path          string  `json:"path"`
+	LatencyMS     int     `json:"latencyMs"`
+	JitterMS      int     `json:"jitterMs"`
+	ErrorRate     float64 `json:"errorRate"`
+	ErrorStatus   int     `json:"errorStatus"`
+	PanicRate     float64 `json:"panicRate"`
+	DBFailureRate float64 `json:"dbFailureRate"`
+}
+
+func (r Rule) Validate() map[string]string {
+	errors := map[string]string{}
+	if r.Method == "" {
+		errors["method"] = "method is required"
+	}
+	if !strings.HasPrefix(r.Path, "/") {
+		errors["path"] = "path should be a route template starting with /"
+	}
+	if r.LatencyMS < 0 || r.JitterMS < 0 {
+		errors["latencyMs"] = "latency and jitter should not be negative"
+	}
+	for name, rate := range map[string]float64{
+		"errorRate":     r.ErrorRate,
+		"panicRate":     r.PanicRate,
+		"dbFailureRate": r.DBFailureRate,
+	} {
+		if rate < 0 || rate > 1 {
+			errors[name] = fmt.Sprintf("%s should be between 0 and 1", name)
+		}
+	}
+	if r.ErrorStatus != 0 && (r.ErrorStatus < 400 || r.ErrorStatus > 599) {
+		errors["errorStatus"] = "errorStatus should be a 4xx or 5xx code"
+	}
+	return errors
+}
+
+func (r Rule) key() string {
+	return ruleKey(r.Method, r.Path)
+}
+
+func ruleKey(method, path string) string {
+	return strings.ToUpper(method) + " " + path
+}
+
+// Decision is what the injector decided to do with a single request.
+type Decision struct {
+	Delay       time.Duration
+	ErrorStatus int
+	Panic       bool
+	DBFailure   bool
+}
+
+type Injector struct {
+	mu    sync.RWMutex
+	rules map[string]Rule
+}
+
+func NewInjector() *Injector {
+	return &Injector{
+		rules: make(map[string]Rule),
+	}
+}
+
+func (i *Injector) SetRule(r Rule) {
+	r.Method = strings.ToUpper(r.Method)
+	if r.ErrorStatus == 0 {
+		r.ErrorStatus = http.StatusServiceUnavailable
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.rules[r.key()] = r
+}
+
+func (i *Injector) RemoveRule(method, path string) bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	key := ruleKey(method, path)
+	_, ok := i.rules[key]
+	delete(i.rules, key)
+	return ok
+}
+
+func (i *Injector) Reset() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.rules = make(map[string]Rule)
+}
+
+func (i *Injector) Rules() []Rule {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	rules := make([]Rule, 0, len(i.rules))
+	for _, r := range i.rules {
+		rules = append(rules, r)
+	}
+	sort.Slice(rules, func(a, b int) bool {
+		return rules[a].key() < rules[b].key()
+	})
+	return rules
+}
+
+// Decide rolls the dice for the rule registered on method and path, if any.
+func (i *Injector) Decide(method, path string) (Decision, bool) {
+	i.mu.RLock()
+	r, ok := i.rules[ruleKey(method, path)]
+	i.mu.RUnlock()
+	if !ok {
+		return Decision{}, false
+	}
+
+	d := Decision{
+		Delay: time.Duration(r.LatencyMS) * time.Millisecond,
+	}
+	if r.JitterMS > 0 {
+		d.Delay += time.Duration(rand.IntN(r.JitterMS+1)) * time.Millisecond
+	}
+	if roll(r.PanicRate) {
+		d.Panic = true
+	} else if roll(r.ErrorRate) {
+		d.ErrorStatus = r.ErrorStatus
+	}
+	d.DBFailure = roll(r.DBFailureRate)
+	return d, true
+}
+
+func roll(rate float64) bool {
+	return rate > 0 && rand.Float64() < rate
+}
+
+type dbFailureKey struct{}
+
+// WithDBFailure marks ctx so that store calls made with it fail.
+func WithDBFailure(ctx context.Context) context.Context {
+	return context.WithValue(ctx, dbFailureKey{}, true)
+}
+
+func DBFailure(ctx context.Context) bool {
+	failed, _ := ctx.Value(dbFailureKey{}).(bool)
+	return failed
+}
@@ -0,0 +1,56 @@
+package fault
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDecideWithoutRule(t *testing.T) {
+	i := NewInjector()
+	if _, ok := i.Decide("GET", "/api/v1/users"); ok {
+		t.Errorf("expected no decision for a route without rules")
+	}
+}
+
+func TestDecideAlwaysPanics(t *testing.T) {
+	i := NewInjector()
+	i.SetRule(Rule{Method: "get", Path: "/api/v1/users", PanicRate: 1, DBFailureRate: 1})
+
+	d, ok := i.Decide("GET", "/api/v1/users")
+	if !ok {
+		t.Fatal("expected a decision for a route with a rule")
+	}
+	if !d.Panic {
+		t.Errorf("expected a panic to be injected")
+	}
+	if !d.DBFailure {
+		t.Errorf("expected a db failure to be injected")
+	}
+
+	if !i.RemoveRule("GET", "/api/v1/users") {
+		t.Errorf("expected the rule to be removed")
+	}
+	if len(i.Rules()) != 0 {
+		t.Errorf("expected no rules but got %d", len(i.Rules()))
+	}
+}
+
+func TestRuleValidate(t *testing.T) {
+	errors := Rule{Method: "GET", Path: "users", ErrorRate: 2}.Validate()
+	if _, ok := errors["path"]; !ok {
+		t.Errorf("expected path validation error")
+	}
+	if _, ok := errors["errorRate"]; !ok {
+		t.Errorf("expected errorRate validation error")
+	}
+}
+
+func TestDBFailureContext(t *testing.T) {
+	ctx := context.Background()
+	if DBFailure(ctx) {
+		t.Errorf("expected a plain context not to be marked")
+	}
+	if !DBFailure(WithDBFailure(ctx)) {
+		t.Errorf("expected the context to be marked")
+	}
+}
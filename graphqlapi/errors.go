@@ -0,0 +1,67 @@
+package graphqlapi
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fiber/api"
+	"fiber/store"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// Error is a resolver error. Code, Status and Fields are sent as the
+// extensions of the GraphQL error.
+type Error struct {
+	Message string
+	// Code is the HTTP status text in upper snake case, such as NOT_FOUND.
+	Code   string
+	Status int
+	// Fields lists the invalid fields of a VALIDATION_FAILED error.
+	Fields map[string]string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Extensions() map[string]any {
+	ext := map[string]any{"code": e.Code, "status": e.Status}
+	if len(e.Fields) > 0 {
+		ext["fields"] = e.Fields
+	}
+	return ext
+}
+
+func newError(status int, message string) *Error {
+	code := strings.ToUpper(strings.ReplaceAll(http.StatusText(status), " ", "_"))
+	return &Error{Message: message, Code: code, Status: status}
+}
+
+// resolverError is the GraphQL counterpart of api.ErrorHandler: api errors
+// keep their message and status, validation errors list the invalid fields and
+// anything else is an internal error whose message is not sent to the client.
+func resolverError(ctx context.Context, err error) error {
+	switch e := err.(type) {
+	case *Error:
+		return e
+	case api.Error:
+		return newError(e.Code, e.Message)
+	case api.ValidationError:
+		gqlErr := newError(e.Status, e.Error())
+		gqlErr.Code = "VALIDATION_FAILED"
+		gqlErr.Fields = e.Errors
+		return gqlErr
+	}
+
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return newError(http.StatusNotFound, "user not found")
+	case errors.Is(err, store.ErrVersionMismatch):
+		return newError(http.StatusPreconditionFailed, api.ErrPreconditionFailed().Message)
+	}
+
+	slog.ErrorContext(ctx, "graphql resolver failed", "error", err.Error())
+	return newError(http.StatusInternalServerError, api.ErrInternal().Message)
+}
@@ -0,0 +1,83 @@
+package graphqlapi
+
+import (
+	"fiber/api"
+	"fiber/store"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+)
+
+type Handler struct {
+	schema graphql.Schema
+	limits Limits
+}
+
+func NewHandler(userStore store.UserStore, limits Limits) (*Handler, error) {
+	schema, err := NewSchema(userStore)
+	if err != nil {
+		return nil, err
+	}
+	return &Handler{
+		schema: schema,
+		limits: limits,
+	}, nil
+}
+
+// Request is the body of a GraphQL request.
+type Request struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName,omitempty"`
+	Variables     map[string]any `json:"variables,omitempty"`
+}
+
+func (r Request) Validate() map[string]string {
+	errors := map[string]string{}
+	if r.Query == "" {
+		errors["query"] = "query is required"
+	}
+	return errors
+}
+
+// HandleGraphQL executes a query or mutation as the authenticated user. A
+// document that does not parse, validate or stay within the limits is answered
+// with 400; errors raised while resolving it come back with 200 next to the
+// data, as GraphQL clients expect.
+func (h *Handler) HandleGraphQL(c *fiber.Ctx) error {
+	var req Request
+	if err := c.BodyParser(&req); err != nil {
+		return api.ErrBadRequest()
+	}
+	if errors := req.Validate(); len(errors) > 0 {
+		return api.NewValidationError(errors)
+	}
+
+	doc, err := parser.Parse(parser.ParseParams{
+		Source: source.NewSource(&source.Source{Body: []byte(req.Query), Name: "GraphQL request"}),
+	})
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(graphql.Result{Errors: gqlerrors.FormatErrors(err)})
+	}
+	if res := graphql.ValidateDocument(&h.schema, doc, nil); !res.IsValid {
+		return c.Status(fiber.StatusBadRequest).JSON(graphql.Result{Errors: res.Errors})
+	}
+	if err := h.limits.check(doc, req.OperationName, req.Variables); err != nil {
+		located := gqlerrors.NewError(err.Error(), nil, "", nil, nil, err)
+		return c.Status(fiber.StatusBadRequest).JSON(graphql.Result{Errors: gqlerrors.FormatErrors(located)})
+	}
+
+	ctx := c.UserContext()
+	if user, ok := api.AuthUser(c); ok {
+		ctx = withAuthUser(ctx, user)
+	}
+	return c.JSON(graphql.Execute(graphql.ExecuteParams{
+		Schema:        h.schema,
+		AST:           doc,
+		OperationName: req.OperationName,
+		Args:          req.Variables,
+		Context:       ctx,
+	}))
+}
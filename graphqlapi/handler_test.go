@@ -0,0 +1,214 @@
+package graphqlapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fiber/api"
+	"fiber/store/storetest"
+	"fiber/types"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type response struct {
+	Data   map[string]any `json:"data"`
+	Errors []struct {
+		Message    string         `json:"message"`
+		Extensions map[string]any `json:"extensions"`
+	} `json:"errors"`
+}
+
+// newApp serves a Handler over a storetest.MemStore holding an admin and the
+// users named in emails, as the admin.
+func newApp(t *testing.T, limits Limits, emails ...string) (*fiber.App, *storetest.MemStore) {
+	s := storetest.NewMemStore()
+	admin, err := s.InsertUser(context.Background(), &types.User{FirstName: "Admin", LastName: "Admin", Email: "admin@foo.com", IsAdmin: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, email := range emails {
+		name, _, _ := strings.Cut(email, "@")
+		if _, err := s.InsertUser(context.Background(), &types.User{FirstName: name, LastName: "Foo", Email: email}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h, err := NewHandler(s, limits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := fiber.New(fiber.Config{ErrorHandler: api.ErrorHandler})
+	app.Post("/graphql", func(c *fiber.Ctx) error {
+		api.SetAuthUser(c, admin)
+		return h.HandleGraphQL(c)
+	})
+	return app, s
+}
+
+func do(t *testing.T, app *fiber.App, query string, variables map[string]any) (int, response) {
+	body, err := json.Marshal(Request{Query: query, Variables: variables})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(fiber.MethodPost, "/graphql", bytes.NewReader(body))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res response
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, res
+}
+
+func TestUsersQuery(t *testing.T) {
+	app, _ := newApp(t, DefaultLimits(), "ann@foo.com", "bob@foo.com", "anna@foo.com")
+
+	query := `query($after: String) {
+		users(first: 1, after: $after, filter: {name: "ANN", isAdmin: false}) {
+			nodes { email }
+			pageInfo { endCursor hasNextPage }
+		}
+	}`
+	var emails []string
+	var after any
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatal("paging does not end")
+		}
+		status, res := do(t, app, query, map[string]any{"after": after})
+		if status != fiber.StatusOK || len(res.Errors) > 0 {
+			t.Fatalf("unexpected response %d %+v", status, res)
+		}
+		users := res.Data["users"].(map[string]any)
+		for _, node := range users["nodes"].([]any) {
+			emails = append(emails, node.(map[string]any)["email"].(string))
+		}
+		pageInfo := users["pageInfo"].(map[string]any)
+		if !pageInfo["hasNextPage"].(bool) {
+			break
+		}
+		after = pageInfo["endCursor"]
+	}
+	if strings.Join(emails, ",") != "ann@foo.com,anna@foo.com" {
+		t.Errorf("expected ann and anna, got %v", emails)
+	}
+}
+
+func TestMeAndUser(t *testing.T) {
+	app, _ := newApp(t, DefaultLimits(), "ann@foo.com")
+
+	status, res := do(t, app, `{ me { email isAdmin } user(id: 2) { firstName version createdAt } missing: user(id: 99) { id } }`, nil)
+	if status != fiber.StatusOK || len(res.Errors) > 0 {
+		t.Fatalf("unexpected response %d %+v", status, res)
+	}
+	if me := res.Data["me"].(map[string]any); me["email"] != "admin@foo.com" || me["isAdmin"] != true {
+		t.Errorf("unexpected me %v", me)
+	}
+	if user := res.Data["user"].(map[string]any); user["firstName"] != "ann" || user["version"] != float64(1) {
+		t.Errorf("unexpected user %v", user)
+	}
+	if res.Data["missing"] != nil {
+		t.Errorf("expected null for a missing user, got %v", res.Data["missing"])
+	}
+}
+
+func TestMutations(t *testing.T) {
+	app, s := newApp(t, DefaultLimits())
+
+	status, res := do(t, app, `mutation($input: CreateUserInput!) { createUser(input: $input) { id email } }`,
+		map[string]any{"input": map[string]any{"firstName": "James", "lastName": "Foo", "email": "james@foo.com", "password": "supersecure"}})
+	if status != fiber.StatusOK || len(res.Errors) > 0 {
+		t.Fatalf("unexpected response %d %+v", status, res)
+	}
+	id := res.Data["createUser"].(map[string]any)["id"]
+
+	_, res = do(t, app, `mutation($id: Int!) {
+		updateUser(id: $id, version: 1, input: {firstName: "Jimmy", lastName: "Foo", email: "james@foo.com"}) { firstName version }
+	}`, map[string]any{"id": id})
+	if len(res.Errors) > 0 || res.Data["updateUser"].(map[string]any)["version"] != float64(2) {
+		t.Fatalf("unexpected update %+v", res)
+	}
+
+	_, res = do(t, app, `mutation($id: Int!) { deleteUser(id: $id, version: 1) }`, map[string]any{"id": id})
+	if len(res.Errors) != 1 || res.Errors[0].Extensions["code"] != "PRECONDITION_FAILED" || res.Errors[0].Extensions["status"] != float64(412) {
+		t.Fatalf("expected a precondition failure, got %+v", res)
+	}
+	_, res = do(t, app, `mutation($id: Int!) { deleteUser(id: $id) }`, map[string]any{"id": id})
+	if len(res.Errors) > 0 || res.Data["deleteUser"] != id {
+		t.Fatalf("unexpected delete %+v", res)
+	}
+	if _, err := s.GetUserByID(context.Background(), int(id.(float64))); err == nil {
+		t.Error("expected the user to be deleted")
+	}
+}
+
+func TestValidationErrorExtensions(t *testing.T) {
+	app, _ := newApp(t, DefaultLimits())
+
+	status, res := do(t, app, `mutation { createUser(input: {firstName: "J", lastName: "Foo", email: "bad", password: "supersecure"}) { id } }`, nil)
+	if status != fiber.StatusOK || len(res.Errors) != 1 {
+		t.Fatalf("expected one error, got %d %+v", status, res)
+	}
+	ext := res.Errors[0].Extensions
+	if ext["code"] != "VALIDATION_FAILED" || ext["status"] != float64(422) {
+		t.Errorf("unexpected extensions %v", ext)
+	}
+	fields, _ := ext["fields"].(map[string]any)
+	if _, ok := fields["firstName"]; !ok {
+		t.Errorf("expected firstName to be invalid, got %v", fields)
+	}
+	if _, ok := fields["email"]; !ok {
+		t.Errorf("expected email to be invalid, got %v", fields)
+	}
+}
+
+func TestDocumentErrors(t *testing.T) {
+	limits := Limits{MaxDepth: 3, MaxComplexity: 50}
+	app, _ := newApp(t, limits)
+
+	tests := []struct {
+		name  string
+		query string
+		vars  map[string]any
+		code  string
+	}{
+		{name: "syntax", query: `{ users {`},
+		{name: "unknown field", query: `{ users { nodes { password } } }`},
+		{name: "unused fragment", query: `{ me { id } } fragment f on Query { me { id } }`},
+		{name: "too complex", query: `{ users(first: 20) { nodes { id email firstName } } }`, code: "QUERY_TOO_COMPLEX"},
+		{name: "too complex through a variable", query: `query($n: Int) { users(first: $n) { nodes { ...f } } } fragment f on User { id email firstName }`,
+			vars: map[string]any{"n": 20}, code: "QUERY_TOO_COMPLEX"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, res := do(t, app, tt.query, tt.vars)
+			if status != fiber.StatusBadRequest || len(res.Errors) == 0 {
+				t.Fatalf("expected 400 with errors, got %d %+v", status, res)
+			}
+			if tt.code != "" && res.Errors[0].Extensions["code"] != tt.code {
+				t.Errorf("expected %s, got %+v", tt.code, res.Errors[0])
+			}
+		})
+	}
+}
+
+func TestDepthLimit(t *testing.T) {
+	app, _ := newApp(t, Limits{MaxDepth: 2, MaxComplexity: 1000})
+
+	status, res := do(t, app, `{ users { nodes { id } } }`, nil)
+	if status != fiber.StatusBadRequest || len(res.Errors) != 1 || res.Errors[0].Extensions["code"] != "QUERY_TOO_DEEP" {
+		t.Fatalf("expected QUERY_TOO_DEEP, got %d %+v", status, res)
+	}
+
+	// Introspection is not counted.
+	status, res = do(t, app, `{ __schema { types { name fields { name type { name ofType { name } } } } } }`, nil)
+	if status != fiber.StatusOK || len(res.Errors) > 0 {
+		t.Fatalf("expected introspection to run, got %d %+v", status, res)
+	}
+}
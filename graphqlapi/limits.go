@@ -0,0 +1,137 @@
+package graphqlapi
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// Limits bound the queries the endpoint executes. Introspection fields are
+// not counted, so tooling can always load the schema.
+type Limits struct {
+	// MaxDepth is how deeply selections may nest; { users { nodes { id } } } has depth 3.
+	MaxDepth int
+	// MaxComplexity bounds the number of fields a query may resolve. Every field
+	// costs 1, and the selections of users count once per requested user.
+	MaxComplexity int
+}
+
+func DefaultLimits() Limits {
+	return Limits{
+		MaxDepth:      8,
+		MaxComplexity: 1000,
+	}
+}
+
+// analysis walks the operation of a document, with its fragments and variables.
+type analysis struct {
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]any
+}
+
+// check returns a *Error when the operation named operationName, or the only
+// operation of doc, exceeds the limits.
+func (l Limits) check(doc *ast.Document, operationName string, variables map[string]any) error {
+	a := analysis{fragments: map[string]*ast.FragmentDefinition{}, variables: variables}
+	var operation *ast.OperationDefinition
+	for _, def := range doc.Definitions {
+		switch def := def.(type) {
+		case *ast.FragmentDefinition:
+			a.fragments[def.Name.Value] = def
+		case *ast.OperationDefinition:
+			if operationName == "" || (def.Name != nil && def.Name.Value == operationName) {
+				operation = def
+			}
+		}
+	}
+	if operation == nil {
+		// Execution reports the unknown operation.
+		return nil
+	}
+
+	if depth := a.depth(operation.SelectionSet); depth > l.MaxDepth {
+		return newLimitError("QUERY_TOO_DEEP", fmt.Sprintf("query depth %d exceeds the limit of %d", depth, l.MaxDepth))
+	}
+	if complexity := a.complexity(operation.SelectionSet); complexity > l.MaxComplexity {
+		return newLimitError("QUERY_TOO_COMPLEX", fmt.Sprintf("query complexity %d exceeds the limit of %d", complexity, l.MaxComplexity))
+	}
+	return nil
+}
+
+func newLimitError(code, message string) *Error {
+	return &Error{Message: message, Code: code, Status: http.StatusBadRequest}
+}
+
+// fields flattens the fragments of set into the fields they select.
+func (a analysis) fields(set *ast.SelectionSet) []*ast.Field {
+	if set == nil {
+		return nil
+	}
+	var fields []*ast.Field
+	for _, sel := range set.Selections {
+		switch sel := sel.(type) {
+		case *ast.Field:
+			if !strings.HasPrefix(sel.Name.Value, "__") {
+				fields = append(fields, sel)
+			}
+		case *ast.InlineFragment:
+			fields = append(fields, a.fields(sel.SelectionSet)...)
+		case *ast.FragmentSpread:
+			// Validation has already rejected unknown and cyclic fragments.
+			if def, ok := a.fragments[sel.Name.Value]; ok {
+				fields = append(fields, a.fields(def.SelectionSet)...)
+			}
+		}
+	}
+	return fields
+}
+
+func (a analysis) depth(set *ast.SelectionSet) int {
+	depth := 0
+	for _, field := range a.fields(set) {
+		depth = max(depth, 1+a.depth(field.SelectionSet))
+	}
+	return depth
+}
+
+func (a analysis) complexity(set *ast.SelectionSet) int {
+	complexity := 0
+	for _, field := range a.fields(set) {
+		children := a.complexity(field.SelectionSet)
+		if n, ok := a.first(field); ok {
+			children *= n
+		}
+		complexity += 1 + children
+	}
+	return complexity
+}
+
+// first returns the page size asked for by a users field, defaultPageSize
+// when its first argument is omitted.
+func (a analysis) first(field *ast.Field) (int, bool) {
+	if field.Name.Value != "users" {
+		return 0, false
+	}
+	for _, arg := range field.Arguments {
+		if arg.Name.Value != "first" {
+			continue
+		}
+		switch v := arg.Value.(type) {
+		case *ast.IntValue:
+			if n, err := strconv.Atoi(v.Value); err == nil {
+				return max(n, 1), true
+			}
+		case *ast.Variable:
+			switch n := a.variables[v.Name.Value].(type) {
+			case float64:
+				return max(int(n), 1), true
+			case int:
+				return max(n, 1), true
+			}
+		}
+	}
+	return defaultPageSize, true
+}
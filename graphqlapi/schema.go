@@ -0,0 +1,310 @@
+// Package graphqlapi serves the user API over GraphQL, on top of the same
+// store, validation and JWT authentication as the REST API.
+package graphqlapi
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fiber/api"
+	"fiber/store"
+	"fiber/tracing"
+	"fiber/types"
+	"strconv"
+
+	"github.com/graphql-go/graphql"
+)
+
+// defaultPageSize is the page size of users when first is not given.
+const defaultPageSize = 20
+
+type authUserKey struct{}
+
+func withAuthUser(ctx context.Context, user *types.User) context.Context {
+	return context.WithValue(ctx, authUserKey{}, user)
+}
+
+func authUser(ctx context.Context) (*types.User, bool) {
+	user, ok := ctx.Value(authUserKey{}).(*types.User)
+	return user, ok
+}
+
+var userType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "User",
+	// Fields are resolved from the json tags of types.User.
+	Fields: graphql.Fields{
+		"id":        &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		"firstName": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"lastName":  &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"email":     &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"isAdmin":   &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+		"createdAt": &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+		"version":   &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+	},
+})
+
+// pageInfo follows the Relay connection spec: endCursor is the after argument
+// of the next page.
+type pageInfo struct {
+	EndCursor   *string `json:"endCursor"`
+	HasNextPage bool    `json:"hasNextPage"`
+}
+
+type userConnection struct {
+	Nodes    []*types.User `json:"nodes"`
+	PageInfo pageInfo      `json:"pageInfo"`
+}
+
+var pageInfoType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "PageInfo",
+	Fields: graphql.Fields{
+		"endCursor":   &graphql.Field{Type: graphql.String},
+		"hasNextPage": &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+	},
+})
+
+var userConnectionType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "UserConnection",
+	Fields: graphql.Fields{
+		"nodes":    &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(userType)))},
+		"pageInfo": &graphql.Field{Type: graphql.NewNonNull(pageInfoType)},
+	},
+})
+
+var userFilterType = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name:        "UserFilter",
+	Description: "email matches exactly, name is a case-insensitive part of the first or last name.",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"email":   &graphql.InputObjectFieldConfig{Type: graphql.String},
+		"name":    &graphql.InputObjectFieldConfig{Type: graphql.String},
+		"isAdmin": &graphql.InputObjectFieldConfig{Type: graphql.Boolean},
+	},
+})
+
+var createUserInputType = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "CreateUserInput",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"firstName": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+		"lastName":  &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+		"email":     &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+		"password":  &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+	},
+})
+
+var updateUserInputType = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "UpdateUserInput",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"firstName": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+		"lastName":  &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+		"email":     &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+	},
+})
+
+// resolvers implements the root fields on top of a store.UserStore.
+type resolvers struct {
+	userStore store.UserStore
+}
+
+// resolve maps the errors of fn to GraphQL errors with extensions.
+func resolve(fn graphql.FieldResolveFn) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (any, error) {
+		res, err := fn(p)
+		if err != nil {
+			return nil, resolverError(p.Context, err)
+		}
+		return res, nil
+	}
+}
+
+// NewSchema builds the user schema on top of userStore.
+func NewSchema(userStore store.UserStore) (graphql.Schema, error) {
+	r := &resolvers{userStore: userStore}
+	versionArg := &graphql.ArgumentConfig{
+		Type:        graphql.Int,
+		Description: "only apply the change to this version of the user",
+	}
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"me": &graphql.Field{
+				Type:        userType,
+				Description: "The authenticated user.",
+				Resolve:     resolve(r.me),
+			},
+			"user": &graphql.Field{
+				Type:        userType,
+				Description: "A user by id, null when there is none.",
+				Args:        graphql.FieldConfigArgument{"id": {Type: graphql.NewNonNull(graphql.Int)}},
+				Resolve:     resolve(r.user),
+			},
+			"users": &graphql.Field{
+				Type:        graphql.NewNonNull(userConnectionType),
+				Description: "Users in id order, a page at a time.",
+				Args: graphql.FieldConfigArgument{
+					"filter": {Type: userFilterType},
+					"first":  {Type: graphql.Int, DefaultValue: defaultPageSize},
+					"after":  {Type: graphql.String},
+				},
+				Resolve: resolve(r.users),
+			},
+		},
+	})
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createUser": &graphql.Field{
+				Type:    graphql.NewNonNull(userType),
+				Args:    graphql.FieldConfigArgument{"input": {Type: graphql.NewNonNull(createUserInputType)}},
+				Resolve: resolve(r.createUser),
+			},
+			"updateUser": &graphql.Field{
+				Type:        graphql.NewNonNull(userType),
+				Description: "Replaces the editable fields of a user.",
+				Args: graphql.FieldConfigArgument{
+					"id":      {Type: graphql.NewNonNull(graphql.Int)},
+					"input":   {Type: graphql.NewNonNull(updateUserInputType)},
+					"version": versionArg,
+				},
+				Resolve: resolve(r.updateUser),
+			},
+			"deleteUser": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.Int),
+				Description: "Soft-deletes a user and returns its id.",
+				Args: graphql.FieldConfigArgument{
+					"id":      {Type: graphql.NewNonNull(graphql.Int)},
+					"version": versionArg,
+				},
+				Resolve: resolve(r.deleteUser),
+			},
+		},
+	})
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query, Mutation: mutation})
+}
+
+func (r *resolvers) me(p graphql.ResolveParams) (any, error) {
+	user, ok := authUser(p.Context)
+	if !ok {
+		return nil, api.ErrUnAuthorized("unauthorized")
+	}
+	return user, nil
+}
+
+func (r *resolvers) user(p graphql.ResolveParams) (any, error) {
+	user, err := r.userStore.GetUserByID(p.Context, p.Args["id"].(int))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return user, err
+}
+
+func (r *resolvers) users(p graphql.ResolveParams) (any, error) {
+	page := types.UserPage{Limit: p.Args["first"].(int)}
+	errors := map[string]string{}
+	if page.Limit <= 0 {
+		errors["first"] = "first should be positive"
+	}
+	if after, ok := p.Args["after"].(string); ok {
+		id, err := strconv.Atoi(after)
+		if err != nil {
+			errors["after"] = "invalid cursor"
+		}
+		page.After = id
+	}
+	if filter, ok := p.Args["filter"].(map[string]any); ok {
+		page.Email, _ = filter["email"].(string)
+		page.Name, _ = filter["name"].(string)
+		if isAdmin, ok := filter["isAdmin"].(bool); ok {
+			page.IsAdmin = &isAdmin
+		}
+	}
+	for k, v := range page.Validate() {
+		if k == "limit" {
+			k = "first"
+		}
+		errors[k] = v
+	}
+	if len(errors) > 0 {
+		return nil, api.NewValidationError(errors)
+	}
+
+	// One more user than asked for tells whether there is a next page.
+	page.Limit++
+	users, err := r.userStore.GetUsers(p.Context, page)
+	if err != nil && !isNoRows(err) {
+		return nil, err
+	}
+	conn := userConnection{Nodes: users}
+	if len(users) == page.Limit {
+		conn.Nodes = users[:len(users)-1]
+		conn.PageInfo.HasNextPage = true
+	}
+	if conn.Nodes == nil {
+		conn.Nodes = []*types.User{}
+	}
+	if len(conn.Nodes) > 0 {
+		cursor := strconv.Itoa(conn.Nodes[len(conn.Nodes)-1].ID)
+		conn.PageInfo.EndCursor = &cursor
+	}
+	return conn, nil
+}
+
+func (r *resolvers) createUser(p graphql.ResolveParams) (any, error) {
+	input := p.Args["input"].(map[string]any)
+	params := types.CreateUserParams{
+		FirstName: input["firstName"].(string),
+		LastName:  input["lastName"].(string),
+		Email:     input["email"].(string),
+		Password:  input["password"].(string),
+	}
+	if errors := params.Validate(); len(errors) > 0 {
+		return nil, api.NewValidationError(errors)
+	}
+	_, span := tracing.Start(p.Context, "bcrypt.hash")
+	user, err := types.NewUserFromParams(params)
+	tracing.End(span, &err)
+	if err != nil {
+		return nil, err
+	}
+	return r.userStore.InsertUser(p.Context, user)
+}
+
+func (r *resolvers) updateUser(p graphql.ResolveParams) (any, error) {
+	id := p.Args["id"].(int)
+	input := p.Args["input"].(map[string]any)
+	params := types.UpdateUserParams{
+		FirstName: input["firstName"].(string),
+		LastName:  input["lastName"].(string),
+		Email:     input["email"].(string),
+	}
+	if errors := params.Validate(); len(errors) > 0 {
+		return nil, api.NewValidationError(errors)
+	}
+	version, _ := p.Args["version"].(int)
+	user, err := r.userStore.UpdateUser(p.Context, id, params.Columns(), version)
+	if err != nil {
+		return nil, notFound(err, id)
+	}
+	return &user, nil
+}
+
+func (r *resolvers) deleteUser(p graphql.ResolveParams) (any, error) {
+	id := p.Args["id"].(int)
+	version, _ := p.Args["version"].(int)
+	deletedID, err := r.userStore.DeleteUser(p.Context, id, version)
+	if err != nil {
+		return nil, notFound(err, id)
+	}
+	return deletedID, nil
+}
+
+// notFound names the missing user the way the REST handlers do.
+func notFound(err error, id int) error {
+	if isNoRows(err) {
+		return api.ErrNotFound(id, "User")
+	}
+	return err
+}
+
+func isNoRows(err error) bool {
+	return errors.Is(err, sql.ErrNoRows)
+}
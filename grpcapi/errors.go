@@ -0,0 +1,93 @@
+package grpcapi
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fiber/api"
+	"fiber/store"
+	"log/slog"
+	"net/http"
+	"sort"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// statusCodes maps the HTTP codes of api errors to gRPC codes.
+var statusCodes = map[int]codes.Code{
+	http.StatusBadRequest:          codes.InvalidArgument,
+	http.StatusUnauthorized:        codes.Unauthenticated,
+	http.StatusForbidden:           codes.PermissionDenied,
+	http.StatusNotFound:            codes.NotFound,
+	http.StatusConflict:            codes.Aborted,
+	http.StatusPreconditionFailed:  codes.FailedPrecondition,
+	http.StatusUnprocessableEntity: codes.InvalidArgument,
+	http.StatusTooManyRequests:     codes.ResourceExhausted,
+	http.StatusServiceUnavailable:  codes.Unavailable,
+	http.StatusGatewayTimeout:      codes.DeadlineExceeded,
+}
+
+// toStatus is the gRPC counterpart of api.ErrorHandler: api errors keep their
+// message, validation errors list the invalid fields as BadRequest details and
+// anything else is an internal error whose message is not sent to the client.
+func toStatus(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	switch e := err.(type) {
+	case api.Error:
+		return status.Error(statusCode(e.Code), e.Message)
+	case api.ValidationError:
+		return validationStatus(e)
+	}
+
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return status.Error(codes.NotFound, "user not found")
+	case errors.Is(err, store.ErrVersionMismatch):
+		return status.Error(codes.FailedPrecondition, api.ErrPreconditionFailed().Message)
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	}
+
+	slog.ErrorContext(ctx, "rpc failed", "error", err.Error())
+	return status.Error(codes.Internal, api.ErrInternal().Message)
+}
+
+func statusCode(httpStatus int) codes.Code {
+	if code, ok := statusCodes[httpStatus]; ok {
+		return code
+	}
+	if httpStatus >= 500 {
+		return codes.Internal
+	}
+	return codes.Unknown
+}
+
+func validationStatus(e api.ValidationError) error {
+	fields := make([]string, 0, len(e.Errors))
+	for field := range e.Errors {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	details := &errdetails.BadRequest{}
+	for _, field := range fields {
+		details.FieldViolations = append(details.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       field,
+			Description: e.Errors[field],
+		})
+	}
+	st, err := status.New(codes.InvalidArgument, e.Error()).WithDetails(details)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, e.Error())
+	}
+	return st.Err()
+}
@@ -0,0 +1,96 @@
+package grpcapi
+
+import (
+	"context"
+	"fiber/grpcapi/userpb"
+	"fiber/middleware"
+	"fiber/requestid"
+	"fiber/store"
+	"fiber/types"
+	"log/slog"
+	"runtime/debug"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// publicMethods are the UserService methods that can be called without a
+// token. Health checking and reflection are always public.
+var publicMethods = map[string]bool{
+	userpb.UserService_Authenticate_FullMethodName: true,
+}
+
+type authUserKey struct{}
+
+// AuthUser returns the user authenticated by the auth interceptor, if any.
+func AuthUser(ctx context.Context) (*types.User, bool) {
+	user, ok := ctx.Value(authUserKey{}).(*types.User)
+	return user, ok
+}
+
+// firstMetadata returns the first value of a metadata key, which gRPC always
+// lower-cases.
+func firstMetadata(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// requestMeta is the gRPC counterpart of WithRequestID and WithAuditMeta: it
+// picks the request ID, sends it back as a header and records who is calling
+// for the audit log.
+func requestMeta(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	id := requestid.FromHeaders(firstMetadata(md, strings.ToLower(requestid.Header)), firstMetadata(md, requestid.TraceparentHeader))
+	ctx = requestid.NewContext(ctx, id)
+	_ = grpc.SetHeader(ctx, metadata.Pairs(strings.ToLower(requestid.Header), id))
+
+	meta := store.AuditMeta{
+		UserAgent: firstMetadata(md, "user-agent"),
+		RequestID: id,
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		meta.IP = p.Addr.String()
+	}
+	return handler(store.WithAuditMeta(ctx, meta), req)
+}
+
+// recoverPanics answers a panicking call with Internal instead of bringing
+// the server down.
+func recoverPanics(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.ErrorContext(ctx, "rpc panicked", "method", info.FullMethod, "panic", r, "stack", string(debug.Stack()))
+			err = status.Error(codes.Internal, "internal server error")
+		}
+	}()
+	return handler(ctx, req)
+}
+
+// errorStatus turns the errors of the store and the api package into statuses.
+func errorStatus(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	resp, err := handler(ctx, req)
+	return resp, toStatus(ctx, err)
+}
+
+// authenticate validates the "authorization: Bearer <token>" metadata of
+// UserService calls but the public ones, like middleware.JWTAuthentication does for REST.
+func authenticate(userStore store.UserStore) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if publicMethods[info.FullMethod] || !strings.HasPrefix(info.FullMethod, "/"+userpb.UserService_ServiceDesc.ServiceName+"/") {
+			return handler(ctx, req)
+		}
+		md, _ := metadata.FromIncomingContext(ctx)
+		user, err := middleware.UserFromAuthorization(ctx, userStore, firstMetadata(md, "authorization"))
+		if err != nil {
+			return nil, err
+		}
+		ctx = context.WithValue(ctx, authUserKey{}, user)
+		return handler(store.WithAuditActor(ctx, user.ID), req)
+	}
+}
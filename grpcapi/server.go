@@ -0,0 +1,64 @@
+// Package grpcapi serves the user API over gRPC, next to the REST API and on
+// top of the same store, validation and tokens.
+package grpcapi
+
+import (
+	"database/sql"
+	"errors"
+	"fiber/api"
+	"fiber/grpcapi/userpb"
+	"fiber/store"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+)
+
+// Server serves userpb.UserService together with the gRPC health checking
+// and server reflection services.
+type Server struct {
+	grpc   *grpc.Server
+	health *health.Server
+}
+
+func NewServer(userStore store.UserStore, auditStore store.AuditStore) *Server {
+	s := &Server{
+		grpc: grpc.NewServer(grpc.ChainUnaryInterceptor(
+			recoverPanics,
+			requestMeta,
+			errorStatus,
+			authenticate(userStore),
+		)),
+		health: health.NewServer(),
+	}
+	userpb.RegisterUserServiceServer(s.grpc, &userService{
+		userStore: userStore,
+		auth:      api.NewAuthHandler(userStore, auditStore),
+	})
+	healthpb.RegisterHealthServer(s.grpc, s.health)
+	reflection.Register(s.grpc)
+
+	s.health.SetServingStatus(userpb.UserService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	return s
+}
+
+// Serve accepts connections on lis until Stop is called.
+func (s *Server) Serve(lis net.Listener) error {
+	err := s.grpc.Serve(lis)
+	if errors.Is(err, grpc.ErrServerStopped) {
+		return nil
+	}
+	return err
+}
+
+// Stop reports the server as not serving and waits for running calls to finish.
+func (s *Server) Stop() {
+	s.health.Shutdown()
+	s.grpc.GracefulStop()
+}
+
+func isNoRows(err error) bool {
+	return errors.Is(err, sql.ErrNoRows)
+}
@@ -0,0 +1,230 @@
+package grpcapi
+
+import (
+	"context"
+	"fiber/grpcapi/userpb"
+	"fiber/store/storetest"
+	"fiber/types"
+	"net"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const (
+	adminEmail    = "admin@foo.com"
+	adminPassword = "supersecure"
+)
+
+// newClient serves a Server over an in-memory listener.
+func newClient(t *testing.T) (*grpc.ClientConn, *storetest.MemStore) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	s := storetest.NewMemStore()
+	admin, err := types.NewUserFromParams(types.CreateUserParams{FirstName: "Admin", LastName: "Admin", Email: adminEmail, Password: adminPassword})
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin.IsAdmin = true
+	if _, err := s.InsertUser(context.Background(), admin); err != nil {
+		t.Fatal(err)
+	}
+
+	lis := bufconn.Listen(1 << 20)
+	srv := NewServer(s, storetest.NopAuditStore{})
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn, s
+}
+
+func login(t *testing.T, client userpb.UserServiceClient) context.Context {
+	resp, err := client.Authenticate(context.Background(), &userpb.AuthenticateRequest{Email: adminEmail, Password: adminPassword})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.GetUser().GetIsAdmin() {
+		t.Fatalf("expected the admin, got %v", resp.GetUser())
+	}
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+resp.GetToken())
+}
+
+func TestUserServiceCRUD(t *testing.T) {
+	conn, _ := newClient(t)
+	client := userpb.NewUserServiceClient(conn)
+	ctx := login(t, client)
+
+	var header metadata.MD
+	created, err := client.CreateUser(ctx, &userpb.CreateUserRequest{FirstName: "James", LastName: "Foo", Email: "james@foo.com", Password: "supersecure"}, grpc.Header(&header))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.GetId() == 0 || created.GetEmail() != "james@foo.com" || created.GetCreatedAt() == nil {
+		t.Fatalf("unexpected user %v", created)
+	}
+	if len(header.Get("x-request-id")) != 1 {
+		t.Errorf("expected an x-request-id header, got %v", header)
+	}
+
+	got, err := client.GetUser(ctx, &userpb.GetUserRequest{Id: created.GetId()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.GetFirstName() != "James" {
+		t.Errorf("expected James, got %q", got.GetFirstName())
+	}
+
+	updated, err := client.UpdateUser(ctx, &userpb.UpdateUserRequest{Id: created.GetId(), FirstName: "Jimmy", LastName: "Foo", Email: "james@foo.com", Version: got.GetVersion()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.GetFirstName() != "Jimmy" || updated.GetVersion() != got.GetVersion()+1 {
+		t.Errorf("unexpected update %v", updated)
+	}
+
+	deleted, err := client.DeleteUser(ctx, &userpb.DeleteUserRequest{Id: created.GetId()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted.GetId() != created.GetId() {
+		t.Errorf("expected id %d, got %d", created.GetId(), deleted.GetId())
+	}
+	_, err = client.GetUser(ctx, &userpb.GetUserRequest{Id: created.GetId()})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("expected NotFound after delete, got %v", err)
+	}
+}
+
+func TestUserServiceListUsers(t *testing.T) {
+	conn, s := newClient(t)
+	client := userpb.NewUserServiceClient(conn)
+	ctx := login(t, client)
+	for _, email := range []string{"a@foo.com", "b@foo.com", "c@foo.com", "d@foo.com"} {
+		if _, err := s.InsertUser(context.Background(), &types.User{FirstName: "Foo", LastName: "Bar", Email: email}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var ids []int64
+	token := ""
+	for pages := 0; ; pages++ {
+		if pages > 5 {
+			t.Fatal("paging does not end")
+		}
+		resp, err := client.ListUsers(ctx, &userpb.ListUsersRequest{PageSize: 2, PageToken: token})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, user := range resp.GetUsers() {
+			ids = append(ids, user.GetId())
+		}
+		if token = resp.GetNextPageToken(); token == "" {
+			break
+		}
+	}
+	if len(ids) != 5 {
+		t.Fatalf("expected 5 users, got %v", ids)
+	}
+	for i := 1; i < len(ids); i++ {
+		if ids[i] <= ids[i-1] {
+			t.Fatalf("users are not in id order: %v", ids)
+		}
+	}
+
+	_, err := client.ListUsers(ctx, &userpb.ListUsersRequest{PageToken: "nope"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument for a bad token, got %v", err)
+	}
+}
+
+func TestUserServiceErrors(t *testing.T) {
+	conn, _ := newClient(t)
+	client := userpb.NewUserServiceClient(conn)
+
+	_, err := client.GetUser(context.Background(), &userpb.GetUserRequest{Id: 1})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("expected Unauthenticated without a token, got %v", err)
+	}
+	_, err = client.Authenticate(context.Background(), &userpb.AuthenticateRequest{Email: adminEmail, Password: "wrong"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument for bad credentials, got %v", err)
+	}
+
+	ctx := login(t, client)
+	_, err = client.CreateUser(ctx, &userpb.CreateUserRequest{FirstName: "J", LastName: "Foo", Email: "bad", Password: "supersecure"})
+	st := status.Convert(err)
+	if st.Code() != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument, got %v", err)
+	}
+	var fields []string
+	for _, detail := range st.Details() {
+		if br, ok := detail.(*errdetails.BadRequest); ok {
+			for _, v := range br.GetFieldViolations() {
+				fields = append(fields, v.GetField())
+			}
+		}
+	}
+	if len(fields) != 2 || fields[0] != "email" || fields[1] != "firstName" {
+		t.Errorf("expected email and firstName violations, got %v", fields)
+	}
+
+	_, err = client.UpdateUser(ctx, &userpb.UpdateUserRequest{Id: 1, FirstName: "Admin", LastName: "Admin", Email: adminEmail, Version: 42})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("expected FailedPrecondition for a stale version, got %v", err)
+	}
+	_, err = client.GetUser(ctx, &userpb.GetUserRequest{Id: 999})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("expected NotFound, got %v", err)
+	}
+	_, err = client.GetUser(ctx, &userpb.GetUserRequest{})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument for a missing id, got %v", err)
+	}
+}
+
+func TestHealthAndReflection(t *testing.T) {
+	conn, _ := newClient(t)
+	ctx := context.Background()
+
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: userpb.UserService_ServiceDesc.ServiceName})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("expected SERVING, got %v", resp.GetStatus())
+	}
+
+	stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = stream.Send(&reflectionpb.ServerReflectionRequest{MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, svc := range reply.GetListServicesResponse().GetService() {
+		found = found || svc.GetName() == userpb.UserService_ServiceDesc.ServiceName
+	}
+	if !found {
+		t.Errorf("UserService is not listed by reflection: %v", reply)
+	}
+}
@@ -0,0 +1,164 @@
+package grpcapi
+
+import (
+	"context"
+	"fiber/api"
+	"fiber/grpcapi/userpb"
+	"fiber/store"
+	"fiber/tracing"
+	"fiber/types"
+	"strconv"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// defaultPageSize is the ListUsers page size when the request sets none.
+const defaultPageSize = 100
+
+// userService implements userpb.UserServiceServer on top of the same store
+// and validation as the REST handlers.
+type userService struct {
+	userpb.UnimplementedUserServiceServer
+
+	userStore store.UserStore
+	auth      *api.AuthHandler
+}
+
+func (s *userService) Authenticate(ctx context.Context, req *userpb.AuthenticateRequest) (*userpb.AuthenticateResponse, error) {
+	resp, err := s.auth.Login(ctx, api.AuthParams{Email: req.GetEmail(), Password: req.GetPassword()})
+	if err != nil {
+		return nil, err
+	}
+	return &userpb.AuthenticateResponse{User: toProto(resp.User), Token: resp.Token}, nil
+}
+
+func (s *userService) CreateUser(ctx context.Context, req *userpb.CreateUserRequest) (*userpb.User, error) {
+	params := types.CreateUserParams{
+		FirstName: req.GetFirstName(),
+		LastName:  req.GetLastName(),
+		Email:     req.GetEmail(),
+		Password:  req.GetPassword(),
+	}
+	if errors := params.Validate(); len(errors) > 0 {
+		return nil, api.NewValidationError(errors)
+	}
+	_, span := tracing.Start(ctx, "bcrypt.hash")
+	user, err := types.NewUserFromParams(params)
+	tracing.End(span, &err)
+	if err != nil {
+		return nil, err
+	}
+
+	inserted, err := s.userStore.InsertUser(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	return toProto(inserted), nil
+}
+
+func (s *userService) GetUser(ctx context.Context, req *userpb.GetUserRequest) (*userpb.User, error) {
+	id, err := userID(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.userStore.GetUserByID(ctx, id)
+	if err != nil {
+		return nil, notFound(err, id)
+	}
+	return toProto(user), nil
+}
+
+// UpdateUser replaces the editable fields of a user, like PUT does.
+func (s *userService) UpdateUser(ctx context.Context, req *userpb.UpdateUserRequest) (*userpb.User, error) {
+	id, err := userID(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	params := types.UpdateUserParams{
+		FirstName: req.GetFirstName(),
+		LastName:  req.GetLastName(),
+		Email:     req.GetEmail(),
+	}
+	if errors := params.Validate(); len(errors) > 0 {
+		return nil, api.NewValidationError(errors)
+	}
+	user, err := s.userStore.UpdateUser(ctx, id, params.Columns(), int(req.GetVersion()))
+	if err != nil {
+		return nil, notFound(err, id)
+	}
+	return toProto(&user), nil
+}
+
+// DeleteUser soft-deletes a user, like DELETE without hard=true does.
+func (s *userService) DeleteUser(ctx context.Context, req *userpb.DeleteUserRequest) (*userpb.DeleteUserResponse, error) {
+	id, err := userID(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	deletedID, err := s.userStore.DeleteUser(ctx, id, int(req.GetVersion()))
+	if err != nil {
+		return nil, notFound(err, id)
+	}
+	return &userpb.DeleteUserResponse{Id: int64(deletedID)}, nil
+}
+
+// ListUsers pages through users in id order. The page token is the id of the
+// last user of the previous page, which clients should treat as opaque.
+func (s *userService) ListUsers(ctx context.Context, req *userpb.ListUsersRequest) (*userpb.ListUsersResponse, error) {
+	page := types.UserPage{Limit: int(req.GetPageSize())}
+	if page.Limit == 0 {
+		page.Limit = defaultPageSize
+	}
+	errors := page.Validate()
+	if token := req.GetPageToken(); token != "" {
+		after, err := strconv.Atoi(token)
+		if err != nil || after < 0 {
+			errors["pageToken"] = "invalid page token"
+		}
+		page.After = after
+	}
+	if len(errors) > 0 {
+		return nil, api.NewValidationError(errors)
+	}
+
+	users, err := s.userStore.GetUsers(ctx, page)
+	if err != nil && !isNoRows(err) {
+		return nil, err
+	}
+	resp := &userpb.ListUsersResponse{Users: make([]*userpb.User, 0, len(users))}
+	for _, user := range users {
+		resp.Users = append(resp.Users, toProto(user))
+	}
+	if len(users) == page.Limit {
+		resp.NextPageToken = strconv.Itoa(users[len(users)-1].ID)
+	}
+	return resp, nil
+}
+
+func userID(id int64) (int, error) {
+	if id <= 0 {
+		return 0, api.ErrInvalidID()
+	}
+	return int(id), nil
+}
+
+// notFound names the missing user the way the REST handlers do; other errors
+// are left to toStatus.
+func notFound(err error, id int) error {
+	if isNoRows(err) {
+		return api.ErrNotFound(id, "User")
+	}
+	return err
+}
+
+func toProto(user *types.User) *userpb.User {
+	return &userpb.User{
+		Id:        int64(user.ID),
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		Email:     user.Email,
+		IsAdmin:   user.IsAdmin,
+		CreatedAt: timestamppb.New(user.CreatedAt),
+		Version:   int64(user.Version),
+	}
+}
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"fiber/api"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// AdminCredentials guard an endpoint of the admin listener with basic auth
+// when User is set, or with a bearer token when Token is. The zero value lets
+// every request through.
+type AdminCredentials struct {
+	User     string
+	Password string
+	Token    string
+}
+
+// WithAdminCredentials answers 401 to requests without creds.
+func WithAdminCredentials(h fiber.Handler, creds AdminCredentials) fiber.Handler {
+	if creds == (AdminCredentials{}) {
+		return h
+	}
+	return func(c *fiber.Ctx) error {
+		if !creds.match(c) {
+			if creds.Token != "" {
+				c.Set(fiber.HeaderWWWAuthenticate, `Bearer realm="admin"`)
+			} else {
+				c.Set(fiber.HeaderWWWAuthenticate, `Basic realm="admin"`)
+			}
+			return api.ErrUnAuthorized("unauthorized")
+		}
+		return h(c)
+	}
+}
+
+func (creds AdminCredentials) match(c *fiber.Ctx) bool {
+	if creds.Token != "" {
+		token, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+		return ok && equal(token, creds.Token)
+	}
+	user, password, ok := basicAuth(c)
+	// Both are compared, so the time taken does not tell which one is wrong.
+	userOK := equal(user, creds.User)
+	return ok && equal(password, creds.Password) && userOK
+}
+
+// basicAuth reads the credentials of a "Basic <base64 of user:password>"
+// Authorization header.
+func basicAuth(c *fiber.Ctx) (user, password string, ok bool) {
+	encoded, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Basic ")
+	if !ok {
+		return "", "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", "", false
+	}
+	return strings.Cut(string(decoded), ":")
+}
+
+func equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"fiber/requestid"
+	"fiber/store"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// WithAuditMeta records who sent the request so audit events written by the
+// store can be traced back to it. The actor is added later by JWTAuthentication.
+func WithAuditMeta(h fiber.Handler) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx := c.UserContext()
+		c.SetUserContext(store.WithAuditMeta(ctx, store.AuditMeta{
+			IP:        c.IP(),
+			UserAgent: c.Get(fiber.HeaderUserAgent),
+			RequestID: requestid.FromContext(ctx),
+		}))
+		return h(c)
+	}
+}
@@ -1,8 +1,11 @@
 package middleware
 
 import (
+	"context"
 	"fiber/api"
 	"fiber/store"
+	"fiber/tracing"
+	"fiber/types"
 	"fmt"
 	"os"
 	"strings"
@@ -14,34 +17,56 @@ import (
 
 func JWTAuthentication(h fiber.Handler, userStore store.UserStore) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		authHeader := c.Get("Authorization")
-		if authHeader == "" {
-			return api.ErrUnAuthorized("unauthorized")
-		}
-		token := strings.TrimPrefix(authHeader, "Bearer ")
-		if token == authHeader {
-			return api.ErrUnAuthorized("unauthorized")
-		}
-
-		claims, err := validateToken(token)
+		user, err := UserFromAuthorization(c.UserContext(), userStore, c.Get("Authorization"))
 		if err != nil {
 			return err
 		}
+		// Set the current authenticated user to the context.
+		api.SetAuthUser(c, user)
+		c.SetUserContext(store.WithAuditActor(c.UserContext(), user.ID))
 
-		// Check token expiration
-		if float64(time.Now().Unix()) > claims["expires"].(float64) {
-			return api.ErrUnAuthorized("token is expired")
-		}
+		return h(c)
+	}
+}
 
-		userID := claims["id"].(float64)
-		user, err := userStore.GetUserByID(c.Context(), int(userID))
-		if err != nil {
-			return api.ErrUnAuthorized("unauthorized")
-		}
-		_ = user
-		// Set the current authenticated user to the context.
-		//c.Context().SetUserValue("user", user)
+// UserFromAuthorization returns the user whose token is carried by a
+// "Bearer <token>" authorization value. Failures are api.ErrUnAuthorized.
+func UserFromAuthorization(ctx context.Context, userStore store.UserStore, authHeader string) (*types.User, error) {
+	if authHeader == "" {
+		return nil, api.ErrUnAuthorized("unauthorized")
+	}
+	token := strings.TrimPrefix(authHeader, "Bearer ")
+	if token == authHeader {
+		return nil, api.ErrUnAuthorized("unauthorized")
+	}
+
+	_, span := tracing.Start(ctx, "jwt.validate")
+	claims, err := validateToken(token)
+	tracing.End(span, &err)
+	if err != nil {
+		return nil, err
+	}
 
+	// Check token expiration
+	if float64(time.Now().Unix()) > claims["expires"].(float64) {
+		return nil, api.ErrUnAuthorized("token is expired")
+	}
+
+	userID := claims["id"].(float64)
+	user, err := userStore.GetUserByID(ctx, int(userID))
+	if err != nil {
+		return nil, api.ErrUnAuthorized("unauthorized")
+	}
+	return user, nil
+}
+
+// AdminOnly must be wrapped by JWTAuthentication so the user is already in the context.
+func AdminOnly(h fiber.Handler) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, ok := api.AuthUser(c)
+		if !ok || !user.IsAdmin {
+			return api.ErrForbidden()
+		}
 		return h(c)
 	}
 }
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"fiber/api"
+	"fiber/fault"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func WithFaults(h fiber.Handler, injector *fault.Injector) fiber.Handler {
+	logger := slog.Default()
+	return func(c *fiber.Ctx) error {
+		d, ok := injector.Decide(c.Method(), c.Route().Path)
+		if !ok {
+			return h(c)
+		}
+
+		if d.Delay > 0 {
+			time.Sleep(d.Delay)
+		}
+		if d.Panic {
+			logger.WarnContext(c.UserContext(), "injecting panic", "method", c.Method(), "path", c.Route().Path)
+			panic("injected fault")
+		}
+		if d.ErrorStatus != 0 {
+			logger.WarnContext(c.UserContext(), "injecting error", "method", c.Method(), "path", c.Route().Path, "status", d.ErrorStatus)
+			return api.NewError(d.ErrorStatus, "injected fault")
+		}
+		if d.DBFailure {
+			c.SetUserContext(fault.WithDBFailure(c.UserContext()))
+		}
+		return h(c)
+	}
+}
@@ -0,0 +1,118 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fiber/api"
+	"fiber/store"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLen = 255
+)
+
+// replayedHeaders are the response headers stored with an idempotent response.
+var replayedHeaders = []string{fiber.HeaderContentType, fiber.HeaderETag, fiber.HeaderLocation}
+
+// WithIdempotency stores the first response to a request carrying an
+// Idempotency-Key for ttl and replays it to retries with the same key. Keys
+// are scoped to the authenticated user, so it must run after JWTAuthentication.
+// Server errors are not stored, so the request can be retried.
+func WithIdempotency(h fiber.Handler, s store.IdempotencyStore, ttl time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := c.Get(IdempotencyKeyHeader)
+		if key == "" {
+			return h(c)
+		}
+		if len(key) > maxIdempotencyKeyLen {
+			return api.NewError(fiber.StatusBadRequest, "Idempotency-Key is too long")
+		}
+
+		rec := &store.IdempotencyRecord{
+			Key:         key,
+			RequestHash: requestHash(c),
+			ExpiresAt:   time.Now().Add(ttl),
+		}
+		if user, ok := api.AuthUser(c); ok {
+			rec.UserID = user.ID
+		}
+		ctx := c.UserContext()
+		existing, err := s.BeginIdempotentRequest(ctx, rec)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			switch {
+			case existing.RequestHash != rec.RequestHash:
+				return api.NewError(fiber.StatusUnprocessableEntity, "Idempotency-Key was already used for a different request")
+			case existing.Status == 0:
+				return api.NewError(fiber.StatusConflict, "a request with this Idempotency-Key is still in progress")
+			}
+			for name, value := range existing.Headers {
+				c.Set(name, value)
+			}
+			c.Set(IdempotentReplayedHeader, "true")
+			return c.Status(existing.Status).Send(existing.Body)
+		}
+
+		completed := false
+		defer func() {
+			if completed {
+				return
+			}
+			// Also runs when h panics; the request may be gone by then.
+			if err := s.ReleaseIdempotentRequest(context.WithoutCancel(ctx), rec.UserID, rec.Key); err != nil {
+				slog.ErrorContext(ctx, "error to release idempotency key", "error", err.Error())
+			}
+		}()
+
+		err = h(c)
+		status := c.Response().StatusCode()
+		if err != nil {
+			status = api.StatusCode(err)
+		}
+		if status >= fiber.StatusInternalServerError {
+			return err
+		}
+		if err != nil {
+			// Renders the response to store it; err is still returned, so the
+			// decorators outside see the failure and the app renders it again.
+			if herr := api.ErrorHandler(c, err); herr != nil {
+				return herr
+			}
+		}
+
+		rec.Status = status
+		rec.Body = append([]byte(nil), c.Response().Body()...)
+		rec.Headers = map[string]string{}
+		for _, name := range replayedHeaders {
+			if value := c.GetRespHeader(name); value != "" {
+				rec.Headers[name] = value
+			}
+		}
+		if cerr := s.CompleteIdempotentRequest(ctx, rec); cerr != nil {
+			// The response is already written; a retry will find the key in
+			// progress until it expires.
+			slog.ErrorContext(ctx, "error to store idempotent response", "error", cerr.Error())
+		}
+		completed = true
+		return err
+	}
+}
+
+// requestHash identifies the payload of a request, so a key reused for a
+// different request can be told apart from a retry.
+func requestHash(c *fiber.Ctx) string {
+	sum := sha256.New()
+	sum.Write([]byte(c.Method() + " " + c.OriginalURL() + "\n"))
+	sum.Write(c.Body())
+	return hex.EncodeToString(sum.Sum(nil))
+}
@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"context"
+	"fiber/api"
+	"fiber/store"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type memIdempotencyStore struct {
+	mu      sync.Mutex
+	records map[string]*store.IdempotencyRecord
+}
+
+func (s *memIdempotencyStore) BeginIdempotentRequest(_ context.Context, rec *store.IdempotencyRecord) (*store.IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, ok := s.records[rec.Key]; ok {
+		copied := *existing
+		return &copied, nil
+	}
+	copied := *rec
+	s.records[rec.Key] = &copied
+	return nil, nil
+}
+
+func (s *memIdempotencyStore) CompleteIdempotentRequest(_ context.Context, rec *store.IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copied := *rec
+	s.records[rec.Key] = &copied
+	return nil
+}
+
+func (s *memIdempotencyStore) ReleaseIdempotentRequest(_ context.Context, _ int, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+	return nil
+}
+
+func (s *memIdempotencyStore) PurgeExpiredIdempotencyKeys(context.Context, time.Time) (int64, error) {
+	return 0, nil
+}
+
+func newIdempotencyApp(status int) (*fiber.App, *int) {
+	calls := 0
+	s := &memIdempotencyStore{records: map[string]*store.IdempotencyRecord{}}
+	app := fiber.New(fiber.Config{ErrorHandler: api.ErrorHandler})
+	app.Post("/user", WithIdempotency(func(c *fiber.Ctx) error {
+		calls++
+		if status >= fiber.StatusBadRequest {
+			return api.NewError(status, "failed")
+		}
+		c.Set(fiber.HeaderLocation, "/user/1")
+		return c.Status(status).JSON(map[string]int{"call": calls})
+	}, s, time.Hour))
+	return app, &calls
+}
+
+func postWithKey(t *testing.T, app *fiber.App, key, body string) (int, string, string) {
+	req := httptest.NewRequest("POST", "/user", strings.NewReader(body))
+	req.Header.Set(IdempotencyKeyHeader, key)
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(b), resp.Header.Get(IdempotentReplayedHeader)
+}
+
+func TestWithIdempotencyReplays(t *testing.T) {
+	app, calls := newIdempotencyApp(fiber.StatusCreated)
+
+	status, body, _ := postWithKey(t, app, "k1", `{"a":1}`)
+	replayStatus, replayBody, replayed := postWithKey(t, app, "k1", `{"a":1}`)
+	if *calls != 1 {
+		t.Fatalf("expected the handler to run once but it ran %d times", *calls)
+	}
+	if replayStatus != status || replayBody != body || replayed != "true" {
+		t.Fatalf("expected replay of %d %s got %d %s (replayed %q)", status, body, replayStatus, replayBody, replayed)
+	}
+
+	if status, _, _ := postWithKey(t, app, "k1", `{"a":2}`); status != fiber.StatusUnprocessableEntity {
+		t.Fatalf("expected %d for a reused key but got %d", fiber.StatusUnprocessableEntity, status)
+	}
+}
+
+func TestWithIdempotencyReplaysClientErrors(t *testing.T) {
+	app, calls := newIdempotencyApp(fiber.StatusConflict)
+
+	postWithKey(t, app, "k1", `{}`)
+	if status, _, replayed := postWithKey(t, app, "k1", `{}`); status != fiber.StatusConflict || replayed != "true" {
+		t.Fatalf("expected a replayed %d but got %d (replayed %q)", fiber.StatusConflict, status, replayed)
+	}
+	if *calls != 1 {
+		t.Fatalf("expected the handler to run once but it ran %d times", *calls)
+	}
+}
+
+func TestWithIdempotencyReleasesServerErrors(t *testing.T) {
+	app, calls := newIdempotencyApp(fiber.StatusServiceUnavailable)
+
+	postWithKey(t, app, "k1", `{}`)
+	postWithKey(t, app, "k1", `{}`)
+	if *calls != 2 {
+		t.Fatalf("expected the handler to run twice but it ran %d times", *calls)
+	}
+}
+
+func TestWithIdempotencyReturnsClientErrors(t *testing.T) {
+	s := &memIdempotencyStore{records: map[string]*store.IdempotencyRecord{}}
+	var got error
+	app := fiber.New(fiber.Config{ErrorHandler: api.ErrorHandler})
+	app.Post("/user", func(c *fiber.Ctx) error {
+		got = WithIdempotency(func(c *fiber.Ctx) error {
+			return api.NewError(fiber.StatusConflict, "failed")
+		}, s, time.Hour)(c)
+		return got
+	})
+
+	status, body, _ := postWithKey(t, app, "k1", `{}`)
+	if api.StatusCode(got) != fiber.StatusConflict {
+		t.Errorf("expected the error to reach the outer decorators, got %v", got)
+	}
+	if rec := s.records["k1"]; rec == nil || rec.Status != status || string(rec.Body) != body {
+		t.Errorf("expected the %d %s response to be stored, got %+v", status, body, rec)
+	}
+}
@@ -37,7 +37,7 @@ func LoggingHandlerDecorator(handler fiber.Handler) fiber.Handler {
 		method := c.Method()
 		path := c.Path()
 
-		logger.Info("New request:", "method", method, "path", path, "status", status, "errors", errors, "message", errorType, "duration", duration)
+		logger.InfoContext(c.UserContext(), "New request:", "method", method, "path", path, "status", status, "errors", errors, "message", errorType, "duration", duration)
 		// fmt.Println(string(c.Response().Body()))
 		// fmt.Println("-----------------------------------------------------")
 		return err
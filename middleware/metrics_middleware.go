@@ -1,62 +1,147 @@
 package middleware
 
 import (
-	"fiber/api"
+	"strconv"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
-func (p *PromMetrics) WithMetrics(h fiber.Handler, handlerName string) fiber.Handler {
+// WithMetrics records RED metrics for h. A failed request is recorded by
+// ErrorHandler once the error is rendered, so that the status and response
+// size are the ones the client receives; the error is returned as is, for
+// the outer decorators to see.
+func (p *PromMetrics) WithMetrics(h fiber.Handler) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		err := h(c)
-		if err != nil {
-			if apiErr, ok := err.(api.Error); ok {
-				p.TotalErrors.WithLabelValues(handlerName).Inc()
-				_ = apiErr.Code
-			}
+		route, method := c.Route().Path, c.Method()
+		inFlight := p.InFlight.WithLabelValues(route, method)
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		if err := h(c); err != nil {
+			c.Locals(pendingMetricsKey{}, pendingMetrics{route: route, method: method})
+			return err
+		}
+		p.observe(c, route, method)
+		return nil
+	}
+}
+
+// ErrorHandler renders errors with h, then records the metrics of the
+// requests WithMetrics left to it.
+func (p *PromMetrics) ErrorHandler(h fiber.ErrorHandler) fiber.ErrorHandler {
+	return func(c *fiber.Ctx, err error) error {
+		herr := h(c, err)
+		if pending, ok := c.Locals(pendingMetricsKey{}).(pendingMetrics); ok {
+			p.observe(c, pending.route, pending.method)
 		}
-		p.TotalRequests.WithLabelValues(handlerName).Inc()
-		time := time.Since(c.Context().Time())
-		p.RequestLatency.WithLabelValues(handlerName).Observe(float64(time.Milliseconds()))
-		return err
+		return herr
 	}
 }
 
+type pendingMetricsKey struct{}
+
+type pendingMetrics struct {
+	route, method string
+}
+
+func (p *PromMetrics) observe(c *fiber.Ctx, route, method string) {
+	status := c.Response().StatusCode()
+	class := statusClass(status)
+	p.TotalRequests.WithLabelValues(route, method, class).Inc()
+	if status >= fiber.StatusBadRequest {
+		p.TotalErrors.WithLabelValues(route, method, class).Inc()
+	}
+	p.RequestLatency.WithLabelValues(route, method, class).Observe(time.Since(c.Context().Time()).Seconds())
+	p.RequestSize.WithLabelValues(route, method).Observe(float64(len(c.Request().Body())))
+	p.ResponseSize.WithLabelValues(route, method, class).Observe(float64(len(c.Response().Body())))
+}
+
+func statusClass(status int) string {
+	return strconv.Itoa(status/100) + "xx"
+}
+
 type PromMetrics struct {
-	TotalRequests  *prometheus.CounterVec   `json:"total_requests"`
-	RequestLatency *prometheus.HistogramVec `json:"request_latency"`
-	TotalErrors    *prometheus.CounterVec   `json:"total_errors"`
+	TotalRequests  *prometheus.CounterVec   `json:"http_requests_total"`
+	RequestLatency *prometheus.HistogramVec `json:"http_request_duration_seconds"`
+	TotalErrors    *prometheus.CounterVec   `json:"http_request_errors_total"`
+	InFlight       *prometheus.GaugeVec     `json:"http_requests_in_flight"`
+	RequestSize    *prometheus.HistogramVec `json:"http_request_size_bytes"`
+	ResponseSize   *prometheus.HistogramVec `json:"http_response_size_bytes"`
+	TotalPanics    *prometheus.CounterVec   `json:"panics_total"`
 }
 
-func NewPromMetrics() *PromMetrics {
-	reqCounter := promauto.NewCounterVec(
+// NewPromMetrics registers the HTTP metrics on reg. Latency buckets are in
+// seconds; prometheus.DefBuckets is used when buckets is empty.
+func NewPromMetrics(reg prometheus.Registerer, buckets []float64) *PromMetrics {
+	if len(buckets) == 0 {
+		buckets = prometheus.DefBuckets
+	}
+	labels := []string{"route", "method", "status_class"}
+	sizeBuckets := prometheus.ExponentialBuckets(64, 4, 8)
+
+	reqCounter := prometheus.NewCounterVec(
 		prometheus.CounterOpts{
-			Name: "total_requests",
+			Name: "http_requests_total",
 			Help: "Total number of requests",
 		},
-		[]string{"handler"})
+		labels)
 
-	reqLatency := promauto.NewHistogramVec(
+	reqLatency := prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
-			Name:    "request_latency",
+			Name:    "http_request_duration_seconds",
 			Help:    "Request latency in seconds",
-			Buckets: []float64{0.1, 0.5, 1.0, 2.0, 5.0},
+			Buckets: buckets,
 		},
-		[]string{"handler"})
+		labels)
+
+	reqErrCounter := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "http_request_errors_total",
+			Help: "Total number of requests answered with a 4xx or 5xx status",
+		},
+		labels)
+
+	inFlight := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "http_requests_in_flight",
+			Help: "Number of requests currently being served",
+		},
+		[]string{"route", "method"})
 
-	reqErrCounter := promauto.NewCounterVec(
+	reqSize := prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "http_request_size_bytes",
+			Help:    "Request body size in bytes",
+			Buckets: sizeBuckets,
+		},
+		[]string{"route", "method"})
+
+	respSize := prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "http_response_size_bytes",
+			Help:    "Response body size in bytes",
+			Buckets: sizeBuckets,
+		},
+		labels)
+
+	panicCounter := prometheus.NewCounterVec(
 		prometheus.CounterOpts{
-			Name: "total_errors",
-			Help: "Total number of errors",
+			Name: "panics_total",
+			Help: "Total number of recovered panics",
 		},
 		[]string{"handler"})
 
+	reg.MustRegister(reqCounter, reqLatency, reqErrCounter, inFlight, reqSize, respSize, panicCounter)
+
 	return &PromMetrics{
 		TotalRequests:  reqCounter,
 		RequestLatency: reqLatency,
 		TotalErrors:    reqErrCounter,
+		InFlight:       inFlight,
+		RequestSize:    reqSize,
+		ResponseSize:   respSize,
+		TotalPanics:    panicCounter,
 	}
 }
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"fiber/api"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func newMetricsApp() (*fiber.App, *PromMetrics) {
+	p := NewPromMetrics(prometheus.NewRegistry(), nil)
+	app := fiber.New(fiber.Config{
+		ErrorHandler: p.ErrorHandler(api.ErrorHandler),
+	})
+	app.Post("/user/:id", p.WithMetrics(func(c *fiber.Ctx) error {
+		return api.NewValidationError(map[string]string{"email": "invalid email present"})
+	}))
+	return app, p
+}
+
+func TestWithMetricsCountsValidationErrors(t *testing.T) {
+	// Two instances must be able to coexist, each with its own registry.
+	app, p := newMetricsApp()
+	newMetricsApp()
+
+	resp, err := app.Test(httptest.NewRequest("POST", "/user/1", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusUnprocessableEntity {
+		t.Errorf("expected status code %d but got %d", fiber.StatusUnprocessableEntity, resp.StatusCode)
+	}
+
+	if got := testutil.ToFloat64(p.TotalRequests.WithLabelValues("/user/:id", "POST", "4xx")); got != 1 {
+		t.Errorf("expected 1 request but got %v", got)
+	}
+	if got := testutil.ToFloat64(p.TotalErrors.WithLabelValues("/user/:id", "POST", "4xx")); got != 1 {
+		t.Errorf("expected 1 error but got %v", got)
+	}
+	if got := testutil.ToFloat64(p.InFlight.WithLabelValues("/user/:id", "POST")); got != 0 {
+		t.Errorf("expected no requests in flight but got %v", got)
+	}
+}
+
+func TestWithMetricsReturnsErrors(t *testing.T) {
+	p := NewPromMetrics(prometheus.NewRegistry(), nil)
+	app := fiber.New(fiber.Config{ErrorHandler: p.ErrorHandler(api.ErrorHandler)})
+	var seen error
+	app.Get("/", func(c *fiber.Ctx) error {
+		seen = p.WithMetrics(func(c *fiber.Ctx) error {
+			return api.ErrForbidden()
+		})(c)
+		return seen
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seen == nil {
+		t.Error("expected the error to reach the outer decorator")
+	}
+	if resp.StatusCode != fiber.StatusForbidden {
+		t.Errorf("expected status code %d but got %d", fiber.StatusForbidden, resp.StatusCode)
+	}
+	if got := testutil.ToFloat64(p.TotalErrors.WithLabelValues("/", "GET", "4xx")); got != 1 {
+		t.Errorf("expected 1 error but got %v", got)
+	}
+	if got := testutil.CollectAndCount(p.ResponseSize); got != 1 {
+		t.Errorf("expected the size of the rendered error to be observed, got %d series", got)
+	}
+}
@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"fiber/api"
+	"fiber/ratelimit"
+	"log/slog"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	RateLimitLimitHeader     = "RateLimit-Limit"
+	RateLimitRemainingHeader = "RateLimit-Remaining"
+	RateLimitResetHeader     = "RateLimit-Reset"
+	RateLimitPolicyHeader    = "RateLimit-Policy"
+)
+
+// RateLimiter enforces rate limit policies with a ratelimit.Limiter and counts
+// its decisions per policy.
+type RateLimiter struct {
+	limiter  ratelimit.Limiter
+	requests *prometheus.CounterVec
+	logger   *slog.Logger
+}
+
+func NewRateLimiter(limiter ratelimit.Limiter, reg prometheus.Registerer) *RateLimiter {
+	requests := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "http_rate_limit_requests_total",
+			Help: "Total number of rate limited requests by policy and result: allowed, limited or error",
+		},
+		[]string{"policy", "result"})
+	reg.MustRegister(requests)
+
+	return &RateLimiter{limiter: limiter, requests: requests, logger: slog.Default()}
+}
+
+// WithRateLimit answers 429 Too Many Requests once the caller is over policy,
+// and sets the RateLimit-* headers on every response. Policies keyed by user
+// must run after JWTAuthentication to see the user. When the
+// limiter fails the request is let through.
+func (r *RateLimiter) WithRateLimit(h fiber.Handler, policy ratelimit.Policy) fiber.Handler {
+	policyHeader := strconv.Itoa(policy.Limit) + ";w=" + strconv.Itoa(int(math.Ceil(policy.Window.Seconds())))
+	return func(c *fiber.Ctx) error {
+		d, err := r.limiter.Allow(c.UserContext(), policy, policy.Name+":"+rateLimitKey(c, policy.KeyBy))
+		if err != nil {
+			r.requests.WithLabelValues(policy.Name, "error").Inc()
+			r.logger.ErrorContext(c.UserContext(), "error to check rate limit", "policy", policy.Name, "error", err.Error())
+			return h(c)
+		}
+
+		c.Set(RateLimitLimitHeader, strconv.Itoa(d.Limit))
+		c.Set(RateLimitRemainingHeader, strconv.Itoa(d.Remaining))
+		c.Set(RateLimitResetHeader, seconds(d.Reset))
+		c.Set(RateLimitPolicyHeader, policyHeader)
+		if !d.Allowed {
+			r.requests.WithLabelValues(policy.Name, "limited").Inc()
+			c.Set(fiber.HeaderRetryAfter, seconds(d.RetryAfter))
+			return api.NewError(fiber.StatusTooManyRequests, "too many requests")
+		}
+		r.requests.WithLabelValues(policy.Name, "allowed").Inc()
+		return h(c)
+	}
+}
+
+// rateLimitKey identifies the caller as keyBy asks, falling back to coarser
+// keys when the request lacks one.
+func rateLimitKey(c *fiber.Ctx, keyBy ratelimit.KeyBy) string {
+	if keyBy == ratelimit.ByUser {
+		if user, ok := api.AuthUser(c); ok {
+			return "user:" + strconv.Itoa(user.ID)
+		}
+	}
+	return "ip:" + c.IP()
+}
+
+// seconds rounds d up to whole seconds, as the headers carry them.
+func seconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fiber/api"
+	"fiber/ratelimit"
+	"fiber/types"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type failingLimiter struct{}
+
+func (failingLimiter) Allow(context.Context, ratelimit.Policy, string) (ratelimit.Decision, error) {
+	return ratelimit.Decision{}, errors.New("connection refused")
+}
+
+// newRateLimitApp authenticates the user with the ID in the X-User header.
+func newRateLimitApp(limiter ratelimit.Limiter, policy ratelimit.Policy) (*fiber.App, *RateLimiter) {
+	r := NewRateLimiter(limiter, prometheus.NewRegistry())
+	app := fiber.New(fiber.Config{ErrorHandler: api.ErrorHandler})
+	handler := r.WithRateLimit(func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	}, policy)
+	app.Get("/", func(c *fiber.Ctx) error {
+		if id, err := strconv.Atoi(c.Get("X-User")); err == nil {
+			api.SetAuthUser(c, &types.User{ID: id})
+		}
+		return handler(c)
+	})
+	return app, r
+}
+
+func getLimited(t *testing.T, app *fiber.App, headers map[string]string) (int, map[string]string) {
+	t.Helper()
+	req := httptest.NewRequest("GET", "/", nil)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	for _, name := range []string{RateLimitLimitHeader, RateLimitRemainingHeader, RateLimitResetHeader, RateLimitPolicyHeader, fiber.HeaderRetryAfter} {
+		got[name] = resp.Header.Get(name)
+	}
+	return resp.StatusCode, got
+}
+
+func TestWithRateLimit(t *testing.T) {
+	policy := ratelimit.Policy{Name: "api", Algorithm: ratelimit.TokenBucket, Limit: 2, Window: time.Minute, KeyBy: ratelimit.ByUser}
+	app, r := newRateLimitApp(ratelimit.NewMemory(), policy)
+
+	status, headers := getLimited(t, app, map[string]string{"X-User": "1"})
+	if status != fiber.StatusOK {
+		t.Fatalf("expected 200 but got %d", status)
+	}
+	if headers[RateLimitLimitHeader] != "2" || headers[RateLimitRemainingHeader] != "1" ||
+		headers[RateLimitResetHeader] != "30" || headers[RateLimitPolicyHeader] != "2;w=60" {
+		t.Errorf("unexpected headers %v", headers)
+	}
+
+	getLimited(t, app, map[string]string{"X-User": "1"})
+	status, headers = getLimited(t, app, map[string]string{"X-User": "1"})
+	if status != fiber.StatusTooManyRequests {
+		t.Fatalf("expected 429 but got %d", status)
+	}
+	if headers[fiber.HeaderRetryAfter] != "30" || headers[RateLimitRemainingHeader] != "0" {
+		t.Errorf("unexpected headers %v", headers)
+	}
+
+	if status, _ := getLimited(t, app, map[string]string{"X-User": "2"}); status != fiber.StatusOK {
+		t.Errorf("expected users to be limited apart but got %d", status)
+	}
+	if got := testutil.ToFloat64(r.requests.WithLabelValues("api", "limited")); got != 1 {
+		t.Errorf("expected 1 limited request but got %v", got)
+	}
+	if got := testutil.ToFloat64(r.requests.WithLabelValues("api", "allowed")); got != 3 {
+		t.Errorf("expected 3 allowed requests but got %v", got)
+	}
+}
+
+func TestWithRateLimitFailsOpen(t *testing.T) {
+	policy := ratelimit.Policy{Name: "api", Algorithm: ratelimit.TokenBucket, Limit: 1, Window: time.Minute, KeyBy: ratelimit.ByIP}
+	app, r := newRateLimitApp(failingLimiter{}, policy)
+
+	if status, headers := getLimited(t, app, nil); status != fiber.StatusOK || headers[RateLimitLimitHeader] != "" {
+		t.Errorf("expected the request through without headers but got %d %v", status, headers)
+	}
+	if got := testutil.ToFloat64(r.requests.WithLabelValues("api", "error")); got != 1 {
+		t.Errorf("expected 1 error but got %v", got)
+	}
+}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"fiber/api"
+	"fiber/requestid"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// WithRecover turns a panic in h into a sanitized 500. The panic value and stack
+// only go to the log, never to the client.
+func (p *PromMetrics) WithRecover(h fiber.Handler, handlerName string) fiber.Handler {
+	logger := slog.Default()
+	return func(c *fiber.Ctx) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				p.TotalPanics.WithLabelValues(handlerName).Inc()
+				logPanic(logger, c, handlerName, r)
+				err = api.ErrInternal()
+			}
+		}()
+		return h(c)
+	}
+}
+
+// RecoverErrorHandler protects the app error handler itself. When it panics the
+// response falls back to a plain 500 body built without any user input.
+func (p *PromMetrics) RecoverErrorHandler(h fiber.ErrorHandler) fiber.ErrorHandler {
+	const handlerName = "ErrorHandler"
+	logger := slog.Default()
+	return func(c *fiber.Ctx, handlerErr error) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				p.TotalPanics.WithLabelValues(handlerName).Inc()
+				logPanic(logger, c, handlerName, r, "error", fmt.Sprint(handlerErr))
+				apiErr := api.ErrInternal()
+				apiErr.RequestID = requestid.FromContext(c.UserContext())
+				err = c.Status(apiErr.Code).JSON(apiErr)
+			}
+		}()
+		return h(c, handlerErr)
+	}
+}
+
+func logPanic(logger *slog.Logger, c *fiber.Ctx, handlerName string, r any, args ...any) {
+	args = append([]any{
+		"handler", handlerName,
+		"method", c.Method(),
+		"path", c.Path(),
+		"panic", fmt.Sprint(r),
+		"stack", string(debug.Stack()),
+	}, args...)
+	logger.ErrorContext(c.UserContext(), "recovered from panic", args...)
+}
@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"fiber/api"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestWithRecover(t *testing.T) {
+	p := NewPromMetrics(prometheus.NewRegistry(), nil)
+	app := fiber.New(fiber.Config{ErrorHandler: api.ErrorHandler})
+	app.Get("/panic", p.WithRecover(func(c *fiber.Ctx) error {
+		panic("secret connection string")
+	}, "HandlePanic"))
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/panic", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusInternalServerError {
+		t.Errorf("expected status code %d but got %d", fiber.StatusInternalServerError, resp.StatusCode)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if strings.Contains(string(body), "secret") {
+		t.Errorf("expected the panic value to stay out of the response, got %s", body)
+	}
+	if got := testutil.ToFloat64(p.TotalPanics.WithLabelValues("HandlePanic")); got != 1 {
+		t.Errorf("expected 1 panic but got %v", got)
+	}
+}
+
+func TestRecoverErrorHandler(t *testing.T) {
+	p := NewPromMetrics(prometheus.NewRegistry(), nil)
+	app := fiber.New(fiber.Config{
+		ErrorHandler: p.RecoverErrorHandler(func(*fiber.Ctx, error) error {
+			panic("broken error handler")
+		}),
+	})
+	app.Get("/", func(c *fiber.Ctx) error {
+		return api.ErrBadRequest()
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusInternalServerError {
+		t.Errorf("expected status code %d but got %d", fiber.StatusInternalServerError, resp.StatusCode)
+	}
+	if got := testutil.ToFloat64(p.TotalPanics.WithLabelValues("ErrorHandler")); got != 1 {
+		t.Errorf("expected 1 panic but got %v", got)
+	}
+}
@@ -0,0 +1,16 @@
+package middleware
+
+import (
+	"fiber/requestid"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func WithRequestID(h fiber.Handler) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id := requestid.FromHeaders(c.Get(requestid.Header), c.Get(requestid.TraceparentHeader))
+		c.Set(requestid.Header, id)
+		c.SetUserContext(requestid.NewContext(c.UserContext(), id))
+		return h(c)
+	}
+}
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"fiber/api"
+	"fiber/requestid"
+	"fiber/tracing"
+
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// WithTracing starts a server span for the request, continuing the trace of an
+// incoming traceparent header, and makes it the parent of every span started
+// from c.UserContext().
+func WithTracing(h fiber.Handler) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx := otel.GetTextMapPropagator().Extract(c.UserContext(), headerCarrier{c})
+		route := c.Route().Path
+		ctx, span := tracing.Start(ctx, c.Method()+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(c.Method()),
+				semconv.HTTPRoute(route),
+				semconv.URLPath(c.Path()),
+				semconv.ClientAddress(c.IP()),
+			))
+		defer span.End()
+		c.SetUserContext(ctx)
+
+		err := h(c)
+		status := c.Response().StatusCode()
+		if err != nil {
+			status = api.StatusCode(err)
+			span.RecordError(err)
+		}
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= fiber.StatusInternalServerError {
+			span.SetStatus(codes.Error, fiber.ErrInternalServerError.Message)
+		}
+		if id := requestid.FromContext(ctx); id != "" {
+			span.SetAttributes(attribute.String("http.request_id", id))
+		}
+		return err
+	}
+}
+
+type headerCarrier struct {
+	c *fiber.Ctx
+}
+
+func (h headerCarrier) Get(key string) string {
+	return h.c.Get(key)
+}
+
+func (h headerCarrier) Set(key, value string) {
+	h.c.Set(key, value)
+}
+
+func (h headerCarrier) Keys() []string {
+	keys := []string{}
+	h.c.Request().Header.VisitAll(func(k, _ []byte) {
+		keys = append(keys, string(k))
+	})
+	return keys
+}
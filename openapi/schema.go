@@ -0,0 +1,165 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fiber/types"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	timeType        = reflect.TypeOf(time.Time{})
+	rawMessageType  = reflect.TypeOf(json.RawMessage{})
+	constrainedType = reflect.TypeOf((*types.Constrained)(nil)).Elem()
+)
+
+// Schemas derives schemas from Go types. Named structs are added to the
+// component schemas once and referenced from everywhere else.
+type Schemas map[string]*Schema
+
+// Of returns the schema of v's type, a reference for named structs.
+func (s Schemas) Of(v any) *Schema {
+	return s.of(reflect.TypeOf(v))
+}
+
+func (s Schemas) of(t reflect.Type) *Schema {
+	switch {
+	case t == nil || t == rawMessageType:
+		return &Schema{}
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		schema := s.of(t.Elem())
+		if schema.Ref != "" {
+			// A $ref cannot be combined with a type, so references stay as they are.
+			return schema
+		}
+		nullable := *schema
+		nullable.Type = []any{schema.Type, "null"}
+		return &nullable
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: s.of(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: s.of(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t, "json")
+		}
+		if _, ok := s[t.Name()]; !ok {
+			s[t.Name()] = &Schema{} // breaks cycles while the struct is being built
+			s[t.Name()] = s.object(t, "json")
+		}
+		return &Schema{Ref: "#/components/schemas/" + t.Name()}
+	}
+	return &Schema{}
+}
+
+// object builds the schema of a struct from the names in its tag fields.
+func (s Schemas) object(t reflect.Type, tag string) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	constraints := constraintsOf(t)
+	for _, field := range fields(t, tag) {
+		prop := s.of(field.typ)
+		if c, ok := constraints[field.name]; ok {
+			prop = constrain(prop, c)
+			if c.Required {
+				schema.Required = append(schema.Required, field.name)
+			}
+		}
+		schema.Properties[field.name] = prop
+	}
+	sort.Strings(schema.Required)
+	return schema
+}
+
+// QueryParams describes the fields of a query params struct such as
+// types.AuditFilter by their query tags.
+func (s Schemas) QueryParams(v any) []Parameter {
+	t := reflect.TypeOf(v)
+	constraints := constraintsOf(t)
+	var params []Parameter
+	for _, field := range fields(t, "query") {
+		schema := s.of(field.typ)
+		c, ok := constraints[field.name]
+		if ok {
+			schema = constrain(schema, c)
+		}
+		params = append(params, Parameter{Name: field.name, In: "query", Required: c.Required, Schema: schema})
+	}
+	return params
+}
+
+type field struct {
+	name string
+	typ  reflect.Type
+}
+
+func fields(t reflect.Type, tag string) []field {
+	var out []field
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get(tag), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		out = append(out, field{name: name, typ: f.Type})
+	}
+	return out
+}
+
+func constraintsOf(t reflect.Type) map[string]types.FieldConstraint {
+	if t.Implements(constrainedType) {
+		return reflect.Zero(t).Interface().(types.Constrained).Constraints()
+	}
+	return nil
+}
+
+func constrain(schema *Schema, c types.FieldConstraint) *Schema {
+	if schema.Ref != "" {
+		return schema
+	}
+	constrained := *schema
+	if c.MinLength > 0 {
+		constrained.MinLength = &c.MinLength
+	}
+	if c.MaxLength > 0 {
+		constrained.MaxLength = &c.MaxLength
+	}
+	if c.MinItems > 0 {
+		constrained.MinItems = &c.MinItems
+	}
+	if c.MaxItems > 0 {
+		constrained.MaxItems = &c.MaxItems
+	}
+	constrained.Minimum, constrained.Maximum = c.Minimum, c.Maximum
+	if c.Format != "" {
+		constrained.Format = c.Format
+	}
+	constrained.Pattern = c.Pattern
+	for _, v := range c.Enum {
+		constrained.Enum = append(constrained.Enum, v)
+	}
+	return &constrained
+}
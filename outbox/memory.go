@@ -0,0 +1,34 @@
+package outbox
+
+import (
+	"context"
+	"fiber/types"
+	"sync"
+)
+
+// MemorySink keeps the events it is given, for tests. Fail, when set, decides
+// which publications fail.
+type MemorySink struct {
+	mu     sync.Mutex
+	events []*types.DomainEvent
+	Fail   func(*types.DomainEvent) error
+}
+
+func (s *MemorySink) Publish(_ context.Context, event *types.DomainEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Fail != nil {
+		if err := s.Fail(event); err != nil {
+			return err
+		}
+	}
+	s.events = append(s.events, event)
+	return nil
+}
+
+// Events returns the events published so far, in order.
+func (s *MemorySink) Events() []*types.DomainEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*types.DomainEvent(nil), s.events...)
+}
@@ -0,0 +1,66 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fiber/types"
+	"fmt"
+	"strconv"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// JetStreamPublisher is the part of jetstream.JetStream NATSSink uses.
+type JetStreamPublisher interface {
+	PublishMsg(ctx context.Context, msg *nats.Msg, opts ...jetstream.PublishOpt) (*jetstream.PubAck, error)
+}
+
+// NATSSink publishes events to JetStream on the subject
+// <prefix>.<user id>.<event type>, so consumers can filter by user or type. A
+// stream must capture the subjects. The outbox ID is the message ID, which lets
+// JetStream drop the duplicates of a retried publication within its
+// deduplication window.
+type NATSSink struct {
+	js     JetStreamPublisher
+	prefix string
+}
+
+func NewNATSSink(js JetStreamPublisher, prefix string) *NATSSink {
+	return &NATSSink{js: js, prefix: prefix}
+}
+
+// DialNATS connects to the NATS server at url and returns a sink publishing
+// to its JetStream, along with the connection to close.
+func DialNATS(url, prefix string) (*NATSSink, *nats.Conn, error) {
+	nc, err := nats.Connect(url, nats.Name("fiber-outbox"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, nil, err
+	}
+	js, err := jetstream.New(nc)
+	if err != nil {
+		nc.Close()
+		return nil, nil, err
+	}
+	return NewNATSSink(js, prefix), nc, nil
+}
+
+// Subject is the subject event is published on.
+func (s *NATSSink) Subject(event *types.DomainEvent) string {
+	return fmt.Sprintf("%s.%d.%s", s.prefix, event.UserID, event.Type)
+}
+
+func (s *NATSSink) Publish(ctx context.Context, event *types.DomainEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	msg := nats.NewMsg(s.Subject(event))
+	msg.Data = data
+	msg.Header.Set("Event-Type", event.Type)
+	if event.RequestID != "" {
+		msg.Header.Set("Request-Id", event.RequestID)
+	}
+	_, err = s.js.PublishMsg(ctx, msg, jetstream.WithMsgID(strconv.FormatInt(event.ID, 10)))
+	return err
+}
@@ -0,0 +1,108 @@
+package outbox
+
+import (
+	"context"
+	"fiber/store"
+	"fiber/types"
+	"log/slog"
+	"time"
+)
+
+// Sink publishes domain events somewhere. An error leaves the event in the
+// outbox to be published again, so sinks must tolerate duplicates.
+type Sink interface {
+	Publish(context.Context, *types.DomainEvent) error
+}
+
+type RelayConfig struct {
+	// PollInterval is how often the outbox is checked for new events.
+	PollInterval time.Duration
+	// BatchSize is how many events are read from the outbox at once.
+	BatchSize int
+}
+
+func DefaultRelayConfig() RelayConfig {
+	return RelayConfig{
+		PollInterval: time.Second,
+		BatchSize:    100,
+	}
+}
+
+// Relay publishes the events of the outbox to sink. Events are published at
+// least once, and those of one user in the order they were recorded.
+type Relay struct {
+	outbox store.OutboxStore
+	sink   Sink
+	cfg    RelayConfig
+	logger *slog.Logger
+}
+
+func NewRelay(outbox store.OutboxStore, sink Sink, cfg RelayConfig) *Relay {
+	return &Relay{
+		outbox: outbox,
+		sink:   sink,
+		cfg:    cfg,
+		logger: slog.Default(),
+	}
+}
+
+// Run publishes the outbox every PollInterval until ctx is done. On replicas
+// that do not hold the outbox lock it only waits for its turn.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		_, err := r.outbox.WithOutboxLock(ctx, r.PublishPending)
+		if err != nil && ctx.Err() == nil {
+			r.logger.ErrorContext(ctx, "error to publish the outbox", "error", err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PublishPending goes through the outbox once, batch by batch. Events that
+// fail to publish stay in the outbox for the next call, and so do the later
+// events of the same user, which must not overtake them.
+func (r *Relay) PublishPending(ctx context.Context) error {
+	held := map[int]bool{}
+	var after int64
+	for {
+		events, err := r.outbox.PendingDomainEvents(ctx, after, r.cfg.BatchSize)
+		if err != nil {
+			return err
+		}
+		if published := r.publish(ctx, events, held); len(published) > 0 {
+			if err := r.outbox.DeleteDomainEvents(ctx, published); err != nil {
+				return err
+			}
+		}
+		if len(events) < r.cfg.BatchSize {
+			return nil
+		}
+		after = events[len(events)-1].ID
+	}
+}
+
+// publish sends events in order, skipping and adding to held the users with
+// an event that failed. It returns the IDs of the published events.
+func (r *Relay) publish(ctx context.Context, events []*types.DomainEvent, held map[int]bool) []int64 {
+	var published []int64
+	for _, event := range events {
+		if held[event.UserID] {
+			continue
+		}
+		if err := r.sink.Publish(ctx, event); err != nil {
+			r.logger.WarnContext(ctx, "error to publish domain event", "event", event.ID, "type", event.Type, "user", event.UserID, "error", err.Error())
+			held[event.UserID] = true
+			continue
+		}
+		published = append(published, event.ID)
+	}
+	return published
+}
@@ -0,0 +1,161 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fiber/types"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// memOutbox is a store.OutboxStore over a slice.
+type memOutbox struct {
+	mu     sync.Mutex
+	events []*types.DomainEvent
+}
+
+func (o *memOutbox) add(eventType string, userID int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	id := int64(len(o.events) + 1)
+	if len(o.events) > 0 {
+		id = o.events[len(o.events)-1].ID + 1
+	}
+	o.events = append(o.events, &types.DomainEvent{ID: id, Type: eventType, UserID: userID, Payload: []byte(`{}`)})
+}
+
+func (o *memOutbox) PendingDomainEvents(_ context.Context, after int64, limit int) ([]*types.DomainEvent, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var events []*types.DomainEvent
+	for _, e := range o.events {
+		if e.ID > after && len(events) < limit {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func (o *memOutbox) DeleteDomainEvents(_ context.Context, ids []int64) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.events = slices.DeleteFunc(o.events, func(e *types.DomainEvent) bool {
+		return slices.Contains(ids, e.ID)
+	})
+	return nil
+}
+
+func (o *memOutbox) WithOutboxLock(ctx context.Context, fn func(context.Context) error) (bool, error) {
+	return true, fn(ctx)
+}
+
+func published(sink *MemorySink) string {
+	var out []string
+	for _, e := range sink.Events() {
+		out = append(out, fmt.Sprintf("%d:%d", e.ID, e.UserID))
+	}
+	return strings.Join(out, ",")
+}
+
+func TestRelayKeepsOrderPerUser(t *testing.T) {
+	outbox := &memOutbox{}
+	for _, userID := range []int{1, 2, 1, 3, 2, 1} {
+		outbox.add(types.DomainUserUpdated, userID)
+	}
+	down := true
+	sink := &MemorySink{Fail: func(e *types.DomainEvent) error {
+		if down && e.ID == 2 {
+			return errors.New("broker unavailable")
+		}
+		return nil
+	}}
+	relay := NewRelay(outbox, sink, RelayConfig{BatchSize: 2})
+
+	if err := relay.PublishPending(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// Event 5 of user 2 waits for event 2 even though it is in a later batch.
+	if got := published(sink); got != "1:1,3:1,4:3,6:1" {
+		t.Fatalf("expected the events of users 1 and 3 only, got %s", got)
+	}
+
+	down = false
+	if err := relay.PublishPending(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := published(sink); got != "1:1,3:1,4:3,6:1,2:2,5:2" {
+		t.Errorf("expected user 2 to catch up in order, got %s", got)
+	}
+	if len(outbox.events) != 0 {
+		t.Errorf("expected the outbox to be empty, got %d events", len(outbox.events))
+	}
+}
+
+func TestBusAndFanout(t *testing.T) {
+	bus := NewBus()
+	var logins []int64
+	bus.Subscribe(func(_ context.Context, e *types.DomainEvent) error {
+		logins = append(logins, e.ID)
+		return nil
+	}, types.DomainUserLoggedIn)
+	bus.Subscribe(func(_ context.Context, e *types.DomainEvent) error {
+		if e.Type == types.DomainUserDeleted {
+			return errors.New("handler failed")
+		}
+		return nil
+	})
+	memory := &MemorySink{}
+	sink := Fanout{bus, memory}
+
+	ctx := context.Background()
+	if err := sink.Publish(ctx, &types.DomainEvent{ID: 1, Type: types.DomainUserLoggedIn}); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Publish(ctx, &types.DomainEvent{ID: 2, Type: types.DomainUserDeleted}); err == nil {
+		t.Error("expected a failing handler to fail the publication")
+	}
+	if !slices.Equal(logins, []int64{1}) {
+		t.Errorf("expected only the login to be handled, got %v", logins)
+	}
+	if len(memory.Events()) != 2 {
+		t.Errorf("expected the other sinks to get every event, got %d", len(memory.Events()))
+	}
+}
+
+type jetStreamFunc func(*nats.Msg, ...jetstream.PublishOpt) error
+
+func (f jetStreamFunc) PublishMsg(_ context.Context, msg *nats.Msg, opts ...jetstream.PublishOpt) (*jetstream.PubAck, error) {
+	return &jetstream.PubAck{}, f(msg, opts...)
+}
+
+func TestNATSSink(t *testing.T) {
+	var got *nats.Msg
+	var opts int
+	sink := NewNATSSink(jetStreamFunc(func(msg *nats.Msg, o ...jetstream.PublishOpt) error {
+		got, opts = msg, len(o)
+		return nil
+	}), "users")
+
+	event := &types.DomainEvent{ID: 9, Type: types.DomainUserCreated, UserID: 4, Payload: []byte(`{"user":{"id":4}}`), RequestID: "req-1"}
+	if err := sink.Publish(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+	if got.Subject != "users.4.UserCreated" {
+		t.Errorf("unexpected subject %s", got.Subject)
+	}
+	if got.Header.Get("Event-Type") != types.DomainUserCreated || got.Header.Get("Request-Id") != "req-1" {
+		t.Errorf("unexpected headers %v", got.Header)
+	}
+	if !strings.Contains(string(got.Data), `"payload":{"user":{"id":4}}`) {
+		t.Errorf("expected the event as JSON, got %s", got.Data)
+	}
+	if opts != 1 {
+		t.Errorf("expected the message ID option, got %d options", opts)
+	}
+}
@@ -0,0 +1,85 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fiber/types"
+	"log/slog"
+	"slices"
+	"sync"
+)
+
+// LogSink writes every event to a logger.
+type LogSink struct {
+	logger *slog.Logger
+}
+
+func NewLogSink(logger *slog.Logger) *LogSink {
+	return &LogSink{logger: logger}
+}
+
+func (s *LogSink) Publish(ctx context.Context, event *types.DomainEvent) error {
+	s.logger.InfoContext(ctx, "domain event",
+		"id", event.ID,
+		"type", event.Type,
+		"user", event.UserID,
+		"payload", string(event.Payload),
+		"requestId", event.RequestID)
+	return nil
+}
+
+// Fanout publishes every event to all of its sinks. When one of them fails
+// the event is retried on all of them.
+type Fanout []Sink
+
+func (f Fanout) Publish(ctx context.Context, event *types.DomainEvent) error {
+	var errs []error
+	for _, sink := range f {
+		if err := sink.Publish(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Handler handles the events a Bus delivers to it. An error fails the
+// publication, so the event is delivered again later.
+type Handler func(context.Context, *types.DomainEvent) error
+
+// Bus delivers events to in-process handlers, synchronously and in order.
+type Bus struct {
+	mu       sync.RWMutex
+	handlers []subscription
+}
+
+type subscription struct {
+	types   []string
+	handler Handler
+}
+
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Subscribe calls handler for the events of the given types, or of every type
+// when none is given.
+func (b *Bus) Subscribe(handler Handler, eventTypes ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, subscription{types: eventTypes, handler: handler})
+}
+
+func (b *Bus) Publish(ctx context.Context, event *types.DomainEvent) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	var errs []error
+	for _, sub := range b.handlers {
+		if len(sub.types) > 0 && !slices.Contains(sub.types, event.Type) {
+			continue
+		}
+		if err := sub.handler(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,60 @@
+package patch
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMergePatch(t *testing.T) {
+	doc := `{"firstName":"foo","lastName":"bar","tags":{"a":1,"b":2}}`
+	got, err := MergePatch([]byte(doc), []byte(`{"lastName":null,"tags":{"a":null,"c":3},"email":"x@y.io"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"email":"x@y.io","firstName":"foo","tags":{"b":2,"c":3}}`
+	if string(got) != want {
+		t.Fatalf("expected %s got %s", want, got)
+	}
+}
+
+func TestJSONPatch(t *testing.T) {
+	doc := `{"firstName":"foo","list":[1,2,3],"nested":{"a":"b"}}`
+	patch := `[
+		{"op":"test","path":"/firstName","value":"foo"},
+		{"op":"replace","path":"/firstName","value":"baz"},
+		{"op":"add","path":"/list/1","value":9},
+		{"op":"remove","path":"/list/0"},
+		{"op":"add","path":"/list/-","value":4},
+		{"op":"copy","from":"/nested/a","path":"/copied"},
+		{"op":"move","from":"/nested","path":"/moved"}
+	]`
+	got, err := JSONPatch([]byte(doc), []byte(patch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"copied":"b","firstName":"baz","list":[9,2,3,4],"moved":{"a":"b"}}`
+	if string(got) != want {
+		t.Fatalf("expected %s got %s", want, got)
+	}
+}
+
+func TestJSONPatchErrors(t *testing.T) {
+	doc := []byte(`{"firstName":"foo"}`)
+	tests := map[string]struct {
+		patch string
+		want  error
+	}{
+		"failed test":     {`[{"op":"test","path":"/firstName","value":"bar"}]`, ErrTestFailed},
+		"missing path":    {`[{"op":"replace","path":"/lastName","value":"bar"}]`, ErrInvalidPatch},
+		"unknown op":      {`[{"op":"frobnicate","path":"/firstName"}]`, ErrInvalidPatch},
+		"missing value":   {`[{"op":"add","path":"/lastName"}]`, ErrInvalidPatch},
+		"not an array":    {`{"op":"add"}`, ErrInvalidPatch},
+		"relative path":   {`[{"op":"remove","path":"firstName"}]`, ErrInvalidPatch},
+		"move into child": {`[{"op":"move","from":"","path":"/x"}]`, ErrInvalidPatch},
+	}
+	for name, tt := range tests {
+		if _, err := JSONPatch(doc, []byte(tt.patch)); !errors.Is(err, tt.want) {
+			t.Errorf("%s: expected %v got %v", name, tt.want, err)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package ratelimit
+
+import (
+	"math"
+	"time"
+)
+
+// bucket is the state of a token bucket.
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// take refills b up to now and takes a token from it if there is one.
+func (b *bucket) take(p Policy, now time.Time) Decision {
+	if b.updated.IsZero() {
+		b.tokens = float64(p.Limit)
+	} else if elapsed := now.Sub(b.updated); elapsed > 0 {
+		b.tokens = math.Min(float64(p.Limit), b.tokens+float64(elapsed)*refillRate(p))
+	}
+	b.updated = now
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	return bucketDecision(p, b.tokens, allowed)
+}
+
+// refillRate is in tokens per nanosecond.
+func refillRate(p Policy) float64 {
+	return float64(p.Limit) / float64(p.Window)
+}
+
+// bucketDecision describes a bucket left with tokens.
+func bucketDecision(p Policy, tokens float64, allowed bool) Decision {
+	rate := refillRate(p)
+	d := Decision{
+		Allowed:   allowed,
+		Limit:     p.Limit,
+		Remaining: int(tokens),
+		Reset:     ceilDuration((float64(p.Limit) - tokens) / rate),
+	}
+	if !allowed {
+		d.RetryAfter = ceilDuration((1 - tokens) / rate)
+	}
+	return d
+}
+
+// ceilDuration rounds ns up, so that waiting for it is always enough.
+func ceilDuration(ns float64) time.Duration {
+	return time.Duration(math.Ceil(ns))
+}
+
+// window is the state of a sliding window: the counts of the fixed window
+// starting at start and of the one before.
+type window struct {
+	start      time.Time
+	prev, curr int
+}
+
+// take moves w to the fixed window of now and counts a request in it if the
+// estimate of the sliding window allows one more.
+func (w *window) take(p Policy, now time.Time) Decision {
+	start := windowStart(p, now)
+	if !w.start.Equal(start) {
+		if w.start.Equal(start.Add(-p.Window)) {
+			w.prev = w.curr
+		} else {
+			w.prev = 0
+		}
+		w.curr = 0
+		w.start = start
+	}
+	allowed := slidingEstimate(p, now, start, w.prev, w.curr)+1 <= float64(p.Limit)
+	if allowed {
+		w.curr++
+	}
+	return windowDecision(p, now, start, w.prev, w.curr, allowed)
+}
+
+// windowStart aligns fixed windows on the Unix epoch, in milliseconds, so that
+// every backend and replica agrees on them.
+func windowStart(p Policy, now time.Time) time.Time {
+	ms, size := now.UnixMilli(), p.Window.Milliseconds()
+	return time.UnixMilli(ms - ms%size)
+}
+
+// slidingEstimate is the number of requests in the Window up to now, assuming
+// those of the previous fixed window were evenly spread.
+func slidingEstimate(p Policy, now, start time.Time, prev, curr int) float64 {
+	overlap := 1 - float64(now.Sub(start))/float64(p.Window)
+	return float64(prev)*overlap + float64(curr)
+}
+
+// windowDecision describes a sliding window with the counts prev and curr
+// after the request.
+func windowDecision(p Policy, now, start time.Time, prev, curr int, allowed bool) Decision {
+	limit := float64(p.Limit)
+	estimate := slidingEstimate(p, now, start, prev, curr)
+	end := start.Add(p.Window)
+	d := Decision{
+		Allowed:   allowed,
+		Limit:     p.Limit,
+		Remaining: max(0, int(limit-estimate)),
+		Reset:     end.Sub(now),
+	}
+	if curr > 0 {
+		// The requests of this window weigh on the whole next one.
+		d.Reset += p.Window
+	}
+	if allowed {
+		return d
+	}
+	if float64(curr)+1 <= limit {
+		// Wait for enough of the previous window to slide out.
+		needed := p.Window.Seconds() * (1 - (limit-float64(curr)-1)/float64(prev))
+		d.RetryAfter = start.Add(ceilDuration(needed * float64(time.Second))).Sub(now)
+	} else {
+		// Wait for the next window, in which this one becomes the previous.
+		needed := p.Window.Seconds() * (1 - (limit-1)/float64(curr))
+		d.RetryAfter = end.Add(ceilDuration(needed * float64(time.Second))).Sub(now)
+	}
+	d.RetryAfter = max(d.RetryAfter, 0)
+	return d
+}
@@ -0,0 +1,73 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepEvery is how many requests Memory counts between removals of the keys
+// that went idle.
+const sweepEvery = 1024
+
+// Memory keeps the counters in this process, so each replica enforces its
+// policies on its own.
+type Memory struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	windows map[string]*window
+	// idle is when each key is back to its full quota and can be forgotten.
+	idle  map[string]time.Time
+	calls int
+	now   func() time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		buckets: map[string]*bucket{},
+		windows: map[string]*window{},
+		idle:    map[string]time.Time{},
+		now:     time.Now,
+	}
+}
+
+func (m *Memory) Allow(_ context.Context, p Policy, key string) (Decision, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.calls++
+	if m.calls%sweepEvery == 0 {
+		m.sweep(now)
+	}
+
+	var d Decision
+	switch p.Algorithm {
+	case SlidingWindow:
+		w, ok := m.windows[key]
+		if !ok {
+			w = &window{}
+			m.windows[key] = w
+		}
+		d = w.take(p, now)
+	default:
+		b, ok := m.buckets[key]
+		if !ok {
+			b = &bucket{}
+			m.buckets[key] = b
+		}
+		d = b.take(p, now)
+	}
+	m.idle[key] = now.Add(d.Reset)
+	return d, nil
+}
+
+func (m *Memory) sweep(now time.Time) {
+	for key, idle := range m.idle {
+		if now.After(idle) {
+			delete(m.buckets, key)
+			delete(m.windows, key)
+			delete(m.idle, key)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+// Package ratelimit decides whether a request is within its rate limit
+// policy. Counters live in memory or, to be shared by replicas, in Redis.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Algorithm string
+
+const (
+	// TokenBucket allows bursts of up to Limit requests and refills Limit
+	// tokens evenly over Window.
+	TokenBucket Algorithm = "token"
+	// SlidingWindow allows Limit requests in any Window, weighting the count
+	// of the previous fixed window by how much of it still overlaps.
+	SlidingWindow Algorithm = "sliding"
+)
+
+// KeyBy is what requests are counted by.
+type KeyBy string
+
+const (
+	ByIP KeyBy = "ip"
+	// ByUser counts anonymous requests by IP.
+	ByUser KeyBy = "user"
+)
+
+// Policy allows each key Limit requests per Window.
+type Policy struct {
+	Name      string
+	Algorithm Algorithm
+	Limit     int
+	Window    time.Duration
+	KeyBy     KeyBy
+}
+
+// ParsePolicy reads a policy written "<algorithm> <limit>/<window> by <key>",
+// such as "sliding 10/1m by ip".
+func ParsePolicy(name, s string) (Policy, error) {
+	p := Policy{Name: name}
+	fields := strings.Fields(s)
+	if len(fields) != 4 || fields[2] != "by" {
+		return p, fmt.Errorf("invalid rate limit %q, expected \"<algorithm> <limit>/<window> by <key>\"", s)
+	}
+	switch algorithm := Algorithm(fields[0]); algorithm {
+	case TokenBucket, SlidingWindow:
+		p.Algorithm = algorithm
+	default:
+		return p, fmt.Errorf("invalid rate limit algorithm %q, expected token or sliding", fields[0])
+	}
+	limit, window, ok := strings.Cut(fields[1], "/")
+	if !ok {
+		return p, fmt.Errorf("invalid rate limit %q, expected <limit>/<window>", fields[1])
+	}
+	var err error
+	if p.Limit, err = strconv.Atoi(limit); err != nil || p.Limit <= 0 {
+		return p, fmt.Errorf("invalid rate limit %q, expected a positive number", limit)
+	}
+	if p.Window, err = time.ParseDuration(window); err != nil || p.Window < time.Millisecond {
+		return p, fmt.Errorf("invalid rate limit window %q, expected a duration of 1ms or more", window)
+	}
+	switch keyBy := KeyBy(fields[3]); keyBy {
+	case ByIP, ByUser:
+		p.KeyBy = keyBy
+	default:
+		return p, fmt.Errorf("invalid rate limit key %q, expected ip or user", fields[3])
+	}
+	return p, nil
+}
+
+func (p Policy) String() string {
+	return fmt.Sprintf("%s %d/%s by %s", p.Algorithm, p.Limit, p.Window, p.KeyBy)
+}
+
+// Decision is the outcome of a request against a policy.
+type Decision struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is how long until the quota is back to Limit.
+	Reset time.Duration
+	// RetryAfter is how long a denied request should wait to be allowed.
+	RetryAfter time.Duration
+}
+
+// Limiter counts a request of key against policy.
+type Limiter interface {
+	Allow(ctx context.Context, policy Policy, key string) (Decision, error)
+}
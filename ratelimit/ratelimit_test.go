@@ -0,0 +1,146 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+type clock struct{ now time.Time }
+
+func (c *clock) Now() time.Time { return c.now }
+
+func (c *clock) advance(d time.Duration) { c.now = c.now.Add(d) }
+
+// limiters returns every backend, all on the same clock.
+func limiters(t *testing.T, c *clock) map[string]Limiter {
+	memory := NewMemory()
+	memory.now = c.Now
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	r := NewRedis(client, "test:")
+	r.now = c.Now
+
+	return map[string]Limiter{"memory": memory, "redis": r}
+}
+
+func allow(t *testing.T, l Limiter, p Policy, key string) Decision {
+	t.Helper()
+	d, err := l.Allow(context.Background(), p, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestTokenBucket(t *testing.T) {
+	c := &clock{now: time.UnixMilli(1_700_000_000_000)}
+	p := Policy{Name: "api", Algorithm: TokenBucket, Limit: 3, Window: 3 * time.Second, KeyBy: ByIP}
+
+	for name, l := range limiters(t, c) {
+		t.Run(name, func(t *testing.T) {
+			for i := 2; i >= 0; i-- {
+				d := allow(t, l, p, "a")
+				if !d.Allowed || d.Remaining != i {
+					t.Fatalf("expected the burst to be allowed with %d remaining, got %+v", i, d)
+				}
+			}
+			d := allow(t, l, p, "a")
+			if d.Allowed || d.RetryAfter != time.Second || d.Reset != 3*time.Second {
+				t.Fatalf("expected a denial for 1s, got %+v", d)
+			}
+			if d := allow(t, l, p, "b"); !d.Allowed {
+				t.Fatal("expected keys to be counted apart")
+			}
+
+			c.advance(time.Second)
+			if d := allow(t, l, p, "a"); !d.Allowed || d.Remaining != 0 {
+				t.Fatalf("expected one token to be refilled, got %+v", d)
+			}
+			c.advance(10 * time.Second)
+			if d := allow(t, l, p, "a"); d.Remaining != 2 {
+				t.Fatalf("expected the bucket to refill up to its limit, got %+v", d)
+			}
+		})
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	p := Policy{Name: "auth", Algorithm: SlidingWindow, Limit: 4, Window: time.Minute, KeyBy: ByIP}
+
+	for _, name := range []string{"memory", "redis"} {
+		t.Run(name, func(t *testing.T) {
+			// Half way through a fixed window.
+			c := &clock{now: time.UnixMilli(1_700_000_040_000).Add(-30 * time.Second)}
+			l := limiters(t, c)[name]
+			if start := windowStart(p, c.now); c.now.Sub(start) != 30*time.Second {
+				t.Fatalf("expected the clock half way through a window, got %s", c.now.Sub(start))
+			}
+
+			for i := 3; i >= 0; i-- {
+				if d := allow(t, l, p, "a"); !d.Allowed || d.Remaining != i {
+					t.Fatalf("expected %d remaining, got %+v", i, d)
+				}
+			}
+			d := allow(t, l, p, "a")
+			if d.Allowed {
+				t.Fatal("expected the fifth request to be denied")
+			}
+			// In the next window the 4 requests weigh 4*(1-e/60s), which drops
+			// to 3 after 15s.
+			if d.RetryAfter != 45*time.Second {
+				t.Errorf("expected to retry in 45s, got %s", d.RetryAfter)
+			}
+
+			c.advance(40 * time.Second)
+			if d := allow(t, l, p, "a"); d.Allowed {
+				t.Fatalf("expected the previous window to still weigh, got %+v", d)
+			}
+			c.advance(5 * time.Second)
+			if d := allow(t, l, p, "a"); !d.Allowed {
+				t.Fatalf("expected a request once enough slid out, got %+v", d)
+			}
+		})
+	}
+}
+
+func TestMemorySweepsIdleKeys(t *testing.T) {
+	c := &clock{now: time.Unix(1_700_000_000, 0)}
+	m := NewMemory()
+	m.now = c.Now
+	p := Policy{Name: "api", Algorithm: TokenBucket, Limit: 10, Window: time.Second}
+
+	allow(t, m, p, "idle")
+	c.advance(time.Minute)
+	for range sweepEvery {
+		allow(t, m, p, "busy")
+	}
+	if _, ok := m.buckets["idle"]; ok {
+		t.Error("expected the idle key to be forgotten")
+	}
+	if _, ok := m.buckets["busy"]; !ok {
+		t.Error("expected the busy key to be kept")
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	p, err := ParsePolicy("auth", "sliding 10/1m by ip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Policy{Name: "auth", Algorithm: SlidingWindow, Limit: 10, Window: time.Minute, KeyBy: ByIP}
+	if p != want {
+		t.Errorf("expected %+v, got %+v", want, p)
+	}
+
+	for _, s := range []string{"", "sliding 10/1m", "leaky 10/1m by ip", "token 0/1s by ip", "token 10/1x by ip", "token 10/1s by email", "token 10 by ip"} {
+		if _, err := ParsePolicy("api", s); err == nil {
+			t.Errorf("expected %q to be rejected", s)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// tokenBucketScript is bucket.take on a hash of KEYS[1].
+// ARGV: limit, window in ms, now in ms.
+var tokenBucketScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'updated')
+local tokens = tonumber(state[1])
+if tokens == nil then
+	tokens = limit
+else
+	local elapsed = math.max(0, now - tonumber(state[2]))
+	tokens = math.min(limit, tokens + elapsed * limit / window)
+end
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'updated', ARGV[3])
+redis.call('PEXPIRE', KEYS[1], window)
+return {allowed, tostring(tokens)}
+`)
+
+// slidingWindowScript is window.take on a hash of KEYS[1].
+// ARGV: limit, window in ms, now in ms, and the starts of the current fixed
+// window and of the previous one in ms.
+var slidingWindowScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local state = redis.call('HMGET', KEYS[1], 'start', 'prev', 'curr')
+local prev = tonumber(state[2]) or 0
+local curr = tonumber(state[3]) or 0
+if state[1] ~= ARGV[4] then
+	if state[1] == ARGV[5] then
+		prev = curr
+	else
+		prev = 0
+	end
+	curr = 0
+end
+local overlap = 1 - (now - tonumber(ARGV[4])) / window
+local allowed = 0
+if prev * overlap + curr + 1 <= limit then
+	curr = curr + 1
+	allowed = 1
+end
+redis.call('HSET', KEYS[1], 'start', ARGV[4], 'prev', prev, 'curr', curr)
+redis.call('PEXPIRE', KEYS[1], 2 * window)
+return {allowed, prev, curr}
+`)
+
+// Redis keeps the counters under <prefix><key> in Redis, so that replicas
+// share them. Each request is a single script run.
+type Redis struct {
+	client redis.UniversalClient
+	prefix string
+	now    func() time.Time
+}
+
+func NewRedis(client redis.UniversalClient, prefix string) *Redis {
+	return &Redis{client: client, prefix: prefix, now: time.Now}
+}
+
+func (r *Redis) Allow(ctx context.Context, p Policy, key string) (Decision, error) {
+	now := r.now()
+	nowMS := strconv.FormatInt(now.UnixMilli(), 10)
+	windowMS := strconv.FormatInt(p.Window.Milliseconds(), 10)
+	keys := []string{r.prefix + key}
+
+	if p.Algorithm == SlidingWindow {
+		start := windowStart(p, now)
+		res, err := slidingWindowScript.Run(ctx, r.client, keys, p.Limit, windowMS, nowMS,
+			start.UnixMilli(), start.Add(-p.Window).UnixMilli()).Int64Slice()
+		if err != nil {
+			return Decision{}, err
+		}
+		return windowDecision(p, now, start, int(res[1]), int(res[2]), res[0] == 1), nil
+	}
+
+	res, err := tokenBucketScript.Run(ctx, r.client, keys, p.Limit, windowMS, nowMS).Slice()
+	if err != nil {
+		return Decision{}, err
+	}
+	tokens, err := strconv.ParseFloat(res[1].(string), 64)
+	if err != nil {
+		return Decision{}, err
+	}
+	return bucketDecision(p, tokens, res[0].(int64) == 1), nil
+}
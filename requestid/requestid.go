@@ -0,0 +1,79 @@
+package requestid
+
+import (
+	"context"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const (
+	Header            = "X-Request-ID"
+	TraceparentHeader = "traceparent"
+	maxLen            = 128
+)
+
+type ctxKey struct{}
+
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(ctxKey{}).(string)
+	return id
+}
+
+// FromHeaders picks the request ID a client sent, preferring X-Request-ID over
+// the trace ID of a W3C traceparent. A new ID is generated when neither is usable.
+func FromHeaders(requestID, traceparent string) string {
+	if IsValid(requestID) {
+		return requestID
+	}
+	if traceID, ok := traceIDFromTraceparent(traceparent); ok {
+		return traceID
+	}
+	return New()
+}
+
+func New() string {
+	return uuid.NewString()
+}
+
+// IsValid reports whether id is safe to echo back in headers, logs and SQL comments.
+func IsValid(id string) bool {
+	if id == "" || len(id) > maxLen {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// traceIDFromTraceparent parses "version-traceid-parentid-flags" as defined by W3C Trace Context.
+func traceIDFromTraceparent(h string) (string, bool) {
+	parts := strings.Split(strings.TrimSpace(h), "-")
+	if len(parts) != 4 || len(parts[1]) != 32 {
+		return "", false
+	}
+	traceID := strings.ToLower(parts[1])
+	if strings.Trim(traceID, "0") == "" || !isHex(traceID) {
+		return "", false
+	}
+	return traceID, true
+}
+
+func isHex(s string) bool {
+	for _, r := range s {
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'f') {
+			return false
+		}
+	}
+	return true
+}
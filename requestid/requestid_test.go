@@ -0,0 +1,35 @@
+package requestid
+
+import (
+	"context"
+	"testing"
+)
+
+func TestFromHeaders(t *testing.T) {
+	tests := []struct {
+		name        string
+		requestID   string
+		traceparent string
+		want        string
+	}{
+		{"request id", "abc-123", "", "abc-123"},
+		{"request id wins", "abc-123", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "abc-123"},
+		{"traceparent", "", "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{"unsafe request id", "*/ drop table users; /*", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "4bf92f3577b34da6a3ce929d0e0e4736"},
+	}
+	for _, tt := range tests {
+		if got := FromHeaders(tt.requestID, tt.traceparent); got != tt.want {
+			t.Errorf("%s: expected %q but got %q", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestFromHeadersGenerates(t *testing.T) {
+	id := FromHeaders("", "00-00000000000000000000000000000000-00f067aa0ba902b7-01")
+	if !IsValid(id) {
+		t.Errorf("expected a generated valid id but got %q", id)
+	}
+	if FromContext(NewContext(context.Background(), id)) != id {
+		t.Errorf("expected id to round trip through the context")
+	}
+}
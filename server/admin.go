@@ -0,0 +1,68 @@
+package server
+
+import (
+	"fiber/api"
+	"fiber/middleware"
+	"net"
+
+	"github.com/gofiber/adaptor/v2"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/pprof"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// newAdminApp serves the operational endpoints: metrics, health checks and
+// pprof. The public app has none of them, so they are only reachable from
+// where the admin address is.
+func newAdminApp(check *api.CheckHandler, gatherer prometheus.Gatherer, cfg adminConfig, deps routeDeps) *fiber.App {
+	config := fiber.Config{
+		ErrorHandler:          deps.metrics.RecoverErrorHandler(api.ErrorHandler),
+		DisableStartupMessage: true,
+	}
+	deps.proxy.apply(&config)
+	app := fiber.New(config)
+	// Panics are recovered and counted as on the public app.
+	app.Use(deps.metrics.WithRecover(func(c *fiber.Ctx) error {
+		return c.Next()
+	}, "admin"))
+	app.Get("/check/healthy", middleware.WithAdminCredentials(check.HandleHealthy, cfg.health))
+	app.Get("/check/ready", middleware.WithAdminCredentials(check.HandleReady, cfg.health))
+	registerMetrics(app, gatherer, cfg.metrics, deps)
+	if !cfg.noPprof {
+		app.Use("/debug/pprof", middleware.WithAdminCredentials(func(c *fiber.Ctx) error {
+			return c.Next()
+		}, cfg.pprof))
+		app.Use(pprof.New())
+	}
+	return app
+}
+
+// registerMetrics serves the metrics of gatherer to creds, under the metrics
+// rate limit so that failed logins count too.
+func registerMetrics(app *fiber.App, gatherer prometheus.Gatherer, creds middleware.AdminCredentials, deps routeDeps) {
+	handler := middleware.WithAdminCredentials(adaptor.HTTPHandler(promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{})), creds)
+	if policy, ok := deps.rateLimit(limitMetrics); ok {
+		handler = deps.rateLimiter.WithRateLimit(handler, policy)
+	}
+	app.Get("/metrics", handler)
+}
+
+// serveAdmin serves the admin app on addr in the background until Stop.
+func (s *Server) serveAdmin(addr string, app *fiber.App) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-s.ctx.Done()
+		app.Shutdown()
+	}()
+	go func() {
+		if err := app.Listener(lis); err != nil {
+			s.logger.Error("admin server failed", "error", err.Error())
+		}
+	}()
+	s.logger.Info("admin server listening", "addr", lis.Addr().String())
+	return nil
+}
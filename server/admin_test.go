@@ -0,0 +1,125 @@
+package server
+
+import (
+	"context"
+	"fiber/api"
+	"fiber/middleware"
+	"fiber/ratelimit"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type pingFunc func(context.Context) error
+
+func (f pingFunc) Ping(ctx context.Context) error { return f(ctx) }
+
+func status(t *testing.T, app *fiber.App, path, authorization string) int {
+	t.Helper()
+	req := httptest.NewRequest(fiber.MethodGet, path, nil)
+	if authorization != "" {
+		req.Header.Set(fiber.HeaderAuthorization, authorization)
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode
+}
+
+// adminDeps are the dependencies newAdminApp needs, as Run passes them.
+func adminDeps() routeDeps {
+	return routeDeps{metrics: middleware.NewPromMetrics(prometheus.NewRegistry(), nil)}
+}
+
+func TestAdminEndpointsAreNotPublic(t *testing.T) {
+	app := newTestApp(t)
+	for _, path := range []string{"/metrics", "/check/healthy", "/check/ready", "/debug/pprof/"} {
+		if got := status(t, app, path, ""); got != fiber.StatusNotFound {
+			t.Errorf("expected %s to be missing from the public app, got %d", path, got)
+		}
+	}
+}
+
+func TestAdminApp(t *testing.T) {
+	check := api.NewCheckHandler(pingFunc(func(context.Context) error { return nil }))
+	cfg := adminConfig{
+		metrics: middleware.AdminCredentials{Token: "scraper-token"},
+		pprof:   middleware.AdminCredentials{User: "ops", Password: "secret"},
+	}
+	app := newAdminApp(check, prometheus.NewRegistry(), cfg, adminDeps())
+
+	for _, tc := range []struct {
+		path, authorization string
+		want                int
+	}{
+		{"/check/healthy", "", fiber.StatusOK},
+		{"/check/ready", "", fiber.StatusOK},
+		{"/metrics", "", fiber.StatusUnauthorized},
+		{"/metrics", "Bearer wrong", fiber.StatusUnauthorized},
+		{"/metrics", "Bearer scraper-token", fiber.StatusOK},
+		{"/debug/pprof/", "", fiber.StatusUnauthorized},
+		{"/debug/pprof/", "Basic b3BzOndyb25n", fiber.StatusUnauthorized}, // ops:wrong
+		{"/debug/pprof/", "Basic b3BzOnNlY3JldA==", fiber.StatusOK},       // ops:secret
+	} {
+		if got := status(t, app, tc.path, tc.authorization); got != tc.want {
+			t.Errorf("GET %s with %q: expected %d, got %d", tc.path, tc.authorization, tc.want, got)
+		}
+	}
+}
+
+func TestAdminMetricsRateLimit(t *testing.T) {
+	deps := adminDeps()
+	deps.rateLimiter = middleware.NewRateLimiter(ratelimit.NewMemory(), prometheus.NewRegistry())
+	deps.rateLimits = map[string]ratelimit.Policy{
+		limitMetrics: {Name: limitMetrics, Algorithm: ratelimit.TokenBucket, Limit: 1, Window: time.Minute, KeyBy: ratelimit.ByIP},
+	}
+	app := newAdminApp(api.NewCheckHandler(nil), prometheus.NewRegistry(), adminConfig{}, deps)
+
+	status(t, app, "/metrics", "")
+	if got := status(t, app, "/metrics", ""); got != fiber.StatusTooManyRequests {
+		t.Errorf("expected the metrics to be limited, got %d", got)
+	}
+}
+
+func TestAdminPprofNeedsCredentialsOffLoopback(t *testing.T) {
+	for _, tc := range []struct {
+		addr, auth string
+		want       int
+	}{
+		{"", "", fiber.StatusOK}, // 127.0.0.1:9091
+		{"localhost:9091", "", fiber.StatusOK},
+		{"[::1]:9091", "", fiber.StatusOK},
+		{":9091", "", fiber.StatusNotFound},
+		{"0.0.0.0:9091", "", fiber.StatusNotFound},
+		{":9091", "bearer:ops-token", fiber.StatusUnauthorized},
+	} {
+		t.Setenv("ADMIN_LISTEN_ADDR", tc.addr)
+		t.Setenv("ADMIN_PPROF_AUTH", tc.auth)
+		cfg, err := adminConfigFromEnv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		app := newAdminApp(api.NewCheckHandler(nil), prometheus.NewRegistry(), cfg, adminDeps())
+		if got := status(t, app, "/debug/pprof/", ""); got != tc.want {
+			t.Errorf("pprof on %q with %q: expected %d, got %d", tc.addr, tc.auth, tc.want, got)
+		}
+	}
+}
+
+func TestAdminAppRecovers(t *testing.T) {
+	deps := adminDeps()
+	app := newAdminApp(api.NewCheckHandler(nil), prometheus.NewRegistry(), adminConfig{}, deps)
+	app.Get("/panic", func(*fiber.Ctx) error { panic("boom") })
+
+	if got := status(t, app, "/panic", ""); got != fiber.StatusInternalServerError {
+		t.Errorf("expected a panic to answer 500, got %d", got)
+	}
+	if got := testutil.ToFloat64(deps.metrics.TotalPanics.WithLabelValues("admin")); got != 1 {
+		t.Errorf("expected the panic to be counted, got %v", got)
+	}
+}
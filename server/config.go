@@ -0,0 +1,481 @@
+package server
+
+import (
+	"fiber/graphqlapi"
+	"fiber/middleware"
+	"fiber/outbox"
+	"fiber/ratelimit"
+	"fiber/store"
+	"fiber/webhook"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// latencyBuckets reads METRICS_LATENCY_BUCKETS, a comma separated list of
+// seconds in increasing order.
+func latencyBuckets() ([]float64, error) {
+	env := os.Getenv("METRICS_LATENCY_BUCKETS")
+	if env == "" {
+		return nil, nil
+	}
+	buckets := []float64{}
+	for _, b := range strings.Split(env, ",") {
+		v, err := strconv.ParseFloat(strings.TrimSpace(b), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid METRICS_LATENCY_BUCKETS value %q: %w", b, err)
+		}
+		if len(buckets) > 0 && v <= buckets[len(buckets)-1] {
+			return nil, fmt.Errorf("METRICS_LATENCY_BUCKETS should be in increasing order without duplicates")
+		}
+		buckets = append(buckets, v)
+	}
+	return buckets, nil
+}
+
+// slowQueryThreshold reads STORE_SLOW_QUERY_THRESHOLD; store calls taking longer are logged.
+func slowQueryThreshold() (time.Duration, error) {
+	threshold := 200 * time.Millisecond
+	err := durationFromEnv("STORE_SLOW_QUERY_THRESHOLD", &threshold)
+	return threshold, err
+}
+
+type retentionConfig struct {
+	period   time.Duration
+	interval time.Duration
+}
+
+// retentionFromEnv reads how long soft-deleted users are kept (USER_RETENTION_PERIOD)
+// and how often expired ones are purged (USER_RETENTION_INTERVAL).
+func retentionFromEnv() (retentionConfig, error) {
+	cfg := retentionConfig{
+		period:   30 * 24 * time.Hour,
+		interval: time.Hour,
+	}
+	if err := durationFromEnv("USER_RETENTION_PERIOD", &cfg.period); err != nil {
+		return cfg, err
+	}
+	if err := durationFromEnv("USER_RETENTION_INTERVAL", &cfg.interval); err != nil {
+		return cfg, err
+	}
+	if cfg.interval <= 0 {
+		return cfg, fmt.Errorf("USER_RETENTION_INTERVAL should be positive")
+	}
+	return cfg, nil
+}
+
+// idempotencyTTL reads how long idempotent responses are replayed (IDEMPOTENCY_KEY_TTL).
+func idempotencyTTL() (time.Duration, error) {
+	ttl := 24 * time.Hour
+	if err := durationFromEnv("IDEMPOTENCY_KEY_TTL", &ttl); err != nil {
+		return 0, err
+	}
+	if ttl <= 0 {
+		return 0, fmt.Errorf("IDEMPOTENCY_KEY_TTL should be positive")
+	}
+	return ttl, nil
+}
+
+// userEventLogSize reads how many user events are kept for resuming change
+// streams (USER_EVENT_LOG_SIZE).
+func userEventLogSize() (int, error) {
+	size := 10000
+	if err := intFromEnv("USER_EVENT_LOG_SIZE", &size); err != nil {
+		return 0, err
+	}
+	if size <= 0 {
+		return 0, fmt.Errorf("USER_EVENT_LOG_SIZE should be positive")
+	}
+	return size, nil
+}
+
+// graphQLLimits overrides graphqlapi.DefaultLimits with GRAPHQL_MAX_DEPTH and
+// GRAPHQL_MAX_COMPLEXITY when they are set.
+func graphQLLimits() (graphqlapi.Limits, error) {
+	limits := graphqlapi.DefaultLimits()
+	if err := intFromEnv("GRAPHQL_MAX_DEPTH", &limits.MaxDepth); err != nil {
+		return limits, err
+	}
+	if err := intFromEnv("GRAPHQL_MAX_COMPLEXITY", &limits.MaxComplexity); err != nil {
+		return limits, err
+	}
+	if limits.MaxDepth <= 0 || limits.MaxComplexity <= 0 {
+		return limits, fmt.Errorf("GRAPHQL_MAX_DEPTH and GRAPHQL_MAX_COMPLEXITY should be positive")
+	}
+	return limits, nil
+}
+
+// webhookConfigFromEnv overrides webhook.DefaultConfig with the WEBHOOK_*
+// variables that are set.
+func webhookConfigFromEnv() (webhook.Config, error) {
+	cfg := webhook.DefaultConfig()
+	if err := intFromEnv("WEBHOOK_MAX_ATTEMPTS", &cfg.MaxAttempts); err != nil {
+		return cfg, err
+	}
+	durations := map[string]*time.Duration{
+		"WEBHOOK_BACKOFF":       &cfg.Backoff,
+		"WEBHOOK_MAX_BACKOFF":   &cfg.MaxBackoff,
+		"WEBHOOK_TIMEOUT":       &cfg.Timeout,
+		"WEBHOOK_POLL_INTERVAL": &cfg.PollInterval,
+	}
+	for name, dst := range durations {
+		if err := durationFromEnv(name, dst); err != nil {
+			return cfg, err
+		}
+		if *dst <= 0 {
+			return cfg, fmt.Errorf("%s should be positive", name)
+		}
+	}
+	if cfg.MaxAttempts <= 0 {
+		return cfg, fmt.Errorf("WEBHOOK_MAX_ATTEMPTS should be positive")
+	}
+	if err := boolFromEnv("WEBHOOK_ALLOW_PRIVATE_TARGETS", &cfg.AllowPrivateTargets); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+type outboxConfig struct {
+	relay outbox.RelayConfig
+	// sinks are the names of the sinks events are published to: log and nats.
+	sinks      []string
+	natsURL    string
+	natsPrefix string
+}
+
+// outboxConfigFromEnv reads where domain events are published (OUTBOX_SINKS,
+// default "log", "none" drops them) and how the relay polls the outbox.
+func outboxConfigFromEnv() (outboxConfig, error) {
+	cfg := outboxConfig{
+		relay:      outbox.DefaultRelayConfig(),
+		sinks:      []string{"log"},
+		natsURL:    os.Getenv("NATS_URL"),
+		natsPrefix: "users",
+	}
+	if env := os.Getenv("OUTBOX_SINKS"); env != "" {
+		cfg.sinks = nil
+		for _, name := range strings.Split(env, ",") {
+			switch name = strings.TrimSpace(name); name {
+			case "none":
+			case "log", "nats":
+				cfg.sinks = append(cfg.sinks, name)
+			default:
+				return cfg, fmt.Errorf("invalid OUTBOX_SINKS sink %q", name)
+			}
+		}
+	}
+	if prefix := os.Getenv("NATS_SUBJECT_PREFIX"); prefix != "" {
+		cfg.natsPrefix = prefix
+	}
+	if slices.Contains(cfg.sinks, "nats") && cfg.natsURL == "" {
+		return cfg, fmt.Errorf("NATS_URL is required by the nats outbox sink")
+	}
+	if err := durationFromEnv("OUTBOX_POLL_INTERVAL", &cfg.relay.PollInterval); err != nil {
+		return cfg, err
+	}
+	if err := intFromEnv("OUTBOX_BATCH_SIZE", &cfg.relay.BatchSize); err != nil {
+		return cfg, err
+	}
+	if cfg.relay.PollInterval <= 0 || cfg.relay.BatchSize <= 0 {
+		return cfg, fmt.Errorf("OUTBOX_POLL_INTERVAL and OUTBOX_BATCH_SIZE should be positive")
+	}
+	return cfg, nil
+}
+
+type userCacheConfig struct {
+	// backend is memory, redis or off.
+	backend  string
+	size     int
+	ttl      time.Duration
+	redisURL string
+}
+
+// userCacheConfigFromEnv reads where users looked up by ID are cached
+// (USER_CACHE, default "memory"), for how long and, in memory, how many.
+func userCacheConfigFromEnv() (userCacheConfig, error) {
+	cfg := userCacheConfig{
+		backend:  "memory",
+		size:     10000,
+		ttl:      30 * time.Second,
+		redisURL: os.Getenv("REDIS_URL"),
+	}
+	if env := os.Getenv("USER_CACHE"); env != "" {
+		cfg.backend = env
+	}
+	switch cfg.backend {
+	case "memory", "off":
+	case "redis":
+		if cfg.redisURL == "" {
+			return cfg, fmt.Errorf("REDIS_URL is required by the redis user cache")
+		}
+	default:
+		return cfg, fmt.Errorf("invalid USER_CACHE backend %q", cfg.backend)
+	}
+	if err := intFromEnv("USER_CACHE_SIZE", &cfg.size); err != nil {
+		return cfg, err
+	}
+	if err := durationFromEnv("USER_CACHE_TTL", &cfg.ttl); err != nil {
+		return cfg, err
+	}
+	if cfg.size <= 0 || cfg.ttl <= 0 {
+		return cfg, fmt.Errorf("USER_CACHE_SIZE and USER_CACHE_TTL should be positive")
+	}
+	return cfg, nil
+}
+
+type rateLimitConfig struct {
+	// backend is memory, redis or off.
+	backend  string
+	redisURL string
+	policies map[string]ratelimit.Policy
+}
+
+// defaultRateLimits are the policies of the route groups, overridden by
+// RATE_LIMIT_<GROUP> in the format of ratelimit.ParsePolicy, or "off".
+var defaultRateLimits = map[string]string{
+	limitAuth:    "sliding 10/1m by ip",
+	limitAPI:     "token 100/1m by user",
+	limitMetrics: "token 30/1m by ip",
+}
+
+// rateLimitConfigFromEnv reads where rate limits are counted
+// (RATE_LIMIT_BACKEND, default "memory") and the policy of each route group.
+func rateLimitConfigFromEnv() (rateLimitConfig, error) {
+	cfg := rateLimitConfig{
+		backend:  "memory",
+		redisURL: os.Getenv("REDIS_URL"),
+		policies: map[string]ratelimit.Policy{},
+	}
+	if env := os.Getenv("RATE_LIMIT_BACKEND"); env != "" {
+		cfg.backend = env
+	}
+	switch cfg.backend {
+	case "memory", "off":
+	case "redis":
+		if cfg.redisURL == "" {
+			return cfg, fmt.Errorf("REDIS_URL is required by the redis rate limiter")
+		}
+	default:
+		return cfg, fmt.Errorf("invalid RATE_LIMIT_BACKEND %q", cfg.backend)
+	}
+	for group, policy := range defaultRateLimits {
+		name := "RATE_LIMIT_" + strings.ToUpper(group)
+		if env := os.Getenv(name); env != "" {
+			policy = env
+		}
+		if policy == "off" {
+			continue
+		}
+		p, err := ratelimit.ParsePolicy(group, policy)
+		if err != nil {
+			return cfg, fmt.Errorf("%s: %w", name, err)
+		}
+		cfg.policies[group] = p
+	}
+	return cfg, nil
+}
+
+// proxyConfig is who may tell the client address: requests from the trusted
+// proxies are attributed to the address in header, the others to their peer.
+type proxyConfig struct {
+	header  string
+	trusted []string
+}
+
+// proxyConfigFromEnv reads the header carrying the client address
+// (PROXY_HEADER, unset to use the peer of the connection) and the addresses or
+// CIDR ranges of the proxies allowed to set it (TRUSTED_PROXIES, comma
+// separated), which are required with the header.
+func proxyConfigFromEnv() (proxyConfig, error) {
+	cfg := proxyConfig{header: os.Getenv("PROXY_HEADER")}
+	if env := os.Getenv("TRUSTED_PROXIES"); env != "" {
+		for _, proxy := range strings.Split(env, ",") {
+			proxy = strings.TrimSpace(proxy)
+			if _, err := netip.ParsePrefix(proxy); err != nil {
+				if _, err := netip.ParseAddr(proxy); err != nil {
+					return cfg, fmt.Errorf("invalid TRUSTED_PROXIES entry %q", proxy)
+				}
+			}
+			cfg.trusted = append(cfg.trusted, proxy)
+		}
+	}
+	if cfg.header != "" && len(cfg.trusted) == 0 {
+		return cfg, fmt.Errorf("TRUSTED_PROXIES is required with PROXY_HEADER")
+	}
+	return cfg, nil
+}
+
+// apply makes c.IP() of the apps built with config follow cfg.
+func (cfg proxyConfig) apply(config *fiber.Config) {
+	if cfg.header == "" {
+		return
+	}
+	config.ProxyHeader = cfg.header
+	config.EnableTrustedProxyCheck = true
+	config.TrustedProxies = cfg.trusted
+	// Takes the first valid address of a list such as X-Forwarded-For.
+	config.EnableIPValidation = true
+}
+
+type adminConfig struct {
+	// addr is where the admin app listens, "off" to not serve it.
+	addr    string
+	metrics middleware.AdminCredentials
+	health  middleware.AdminCredentials
+	pprof   middleware.AdminCredentials
+	// noPprof leaves pprof out, as it has no credentials and addr is not loopback.
+	noPprof bool
+}
+
+// adminConfigFromEnv reads the admin address (ADMIN_LISTEN_ADDR, default
+// "127.0.0.1:9091") and the credentials of its endpoints: ADMIN_AUTH for all of
+// them, overridden by ADMIN_METRICS_AUTH, ADMIN_HEALTH_AUTH and ADMIN_PPROF_AUTH.
+// pprof is only served without credentials on a loopback address.
+func adminConfigFromEnv() (adminConfig, error) {
+	cfg := adminConfig{addr: "127.0.0.1:9091"}
+	if addr := os.Getenv("ADMIN_LISTEN_ADDR"); addr != "" {
+		cfg.addr = addr
+	}
+	all, err := adminCredentials("ADMIN_AUTH", middleware.AdminCredentials{})
+	if err != nil {
+		return cfg, err
+	}
+	if cfg.metrics, err = adminCredentials("ADMIN_METRICS_AUTH", all); err != nil {
+		return cfg, err
+	}
+	if cfg.health, err = adminCredentials("ADMIN_HEALTH_AUTH", all); err != nil {
+		return cfg, err
+	}
+	if cfg.pprof, err = adminCredentials("ADMIN_PPROF_AUTH", all); err != nil {
+		return cfg, err
+	}
+	cfg.noPprof = cfg.pprof == (middleware.AdminCredentials{}) && !isLoopback(cfg.addr)
+	return cfg, nil
+}
+
+// isLoopback reports whether addr only listens on the loopback interface.
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip, err := netip.ParseAddr(host)
+	return err == nil && ip.IsLoopback()
+}
+
+// adminCredentials reads name as "none", "basic:<user>:<password>" or
+// "bearer:<token>", and returns def when it is not set.
+func adminCredentials(name string, def middleware.AdminCredentials) (middleware.AdminCredentials, error) {
+	env := os.Getenv(name)
+	scheme, value, _ := strings.Cut(env, ":")
+	switch scheme {
+	case "":
+		return def, nil
+	case "none":
+		return middleware.AdminCredentials{}, nil
+	case "basic":
+		user, password, _ := strings.Cut(value, ":")
+		if user != "" && password != "" {
+			return middleware.AdminCredentials{User: user, Password: password}, nil
+		}
+	case "bearer":
+		if value != "" {
+			return middleware.AdminCredentials{Token: value}, nil
+		}
+	}
+	return def, fmt.Errorf("invalid %s, expected none, basic:<user>:<password> or bearer:<token>", name)
+}
+
+// poolConfigFromEnv overrides store.DefaultPoolConfig with the PG_* pool variables that are set.
+func poolConfigFromEnv() (store.PoolConfig, error) {
+	cfg := store.DefaultPoolConfig()
+	ints := map[string]*int{
+		"PG_MAX_OPEN_CONNS":  &cfg.MaxOpenConns,
+		"PG_MIN_IDLE_CONNS":  &cfg.MinIdleConns,
+		"PG_CONNECT_RETRIES": &cfg.ConnectRetries,
+	}
+	for name, dst := range ints {
+		if err := intFromEnv(name, dst); err != nil {
+			return cfg, err
+		}
+	}
+	durations := map[string]*time.Duration{
+		"PG_CONN_MAX_LIFETIME":   &cfg.ConnMaxLifetime,
+		"PG_CONN_MAX_IDLE_TIME":  &cfg.ConnMaxIdleTime,
+		"PG_QUERY_TIMEOUT":       &cfg.QueryTimeout,
+		"PG_HEALTH_CHECK_PERIOD": &cfg.HealthCheckPeriod,
+		"PG_CONNECT_BACKOFF":     &cfg.RetryBackoff,
+	}
+	for name, dst := range durations {
+		if err := durationFromEnv(name, dst); err != nil {
+			return cfg, err
+		}
+	}
+	if err := boolFromEnv("PG_LOG_STATEMENTS", &cfg.LogStatements); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+func intFromEnv(name string, dst *int) error {
+	env := os.Getenv(name)
+	if env == "" {
+		return nil
+	}
+	v, err := strconv.Atoi(env)
+	if err != nil {
+		return fmt.Errorf("invalid %s value %q: %w", name, env, err)
+	}
+	*dst = v
+	return nil
+}
+
+func boolFromEnv(name string, dst *bool) error {
+	env := os.Getenv(name)
+	if env == "" {
+		return nil
+	}
+	v, err := strconv.ParseBool(env)
+	if err != nil {
+		return fmt.Errorf("invalid %s value %q: %w", name, env, err)
+	}
+	*dst = v
+	return nil
+}
+
+func durationFromEnv(name string, dst *time.Duration) error {
+	env := os.Getenv(name)
+	if env == "" {
+		return nil
+	}
+	v, err := time.ParseDuration(env)
+	if err != nil {
+		return fmt.Errorf("invalid %s value %q: %w", name, env, err)
+	}
+	*dst = v
+	return nil
+}
+
+// grpcListenAddr reads the address of the gRPC API (GRPC_LISTEN_ADDR, default
+// ":50051"). "off" disables it.
+func grpcListenAddr() string {
+	if addr := os.Getenv("GRPC_LISTEN_ADDR"); addr != "" {
+		return addr
+	}
+	return ":50051"
+}
+
+func faultInjectionEnabled() bool {
+	enabled, _ := strconv.ParseBool(os.Getenv("FAULT_INJECTION_ENABLED"))
+	return enabled
+}
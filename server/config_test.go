@@ -0,0 +1,81 @@
+package server
+
+import (
+	"fiber/store"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestLatencyBuckets(t *testing.T) {
+	t.Setenv("METRICS_LATENCY_BUCKETS", "0.01, 0.1,1")
+	buckets, err := latencyBuckets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(buckets, []float64{0.01, 0.1, 1}) {
+		t.Errorf("unexpected buckets %v", buckets)
+	}
+
+	for _, env := range []string{"0.1,0.01", "0.1,0.1", "0.1,fast"} {
+		t.Setenv("METRICS_LATENCY_BUCKETS", env)
+		if _, err := latencyBuckets(); err == nil {
+			t.Errorf("expected %q to be rejected", env)
+		}
+	}
+}
+
+func TestPoolConfigFromEnv(t *testing.T) {
+	t.Setenv("PG_MAX_OPEN_CONNS", "40")
+	t.Setenv("PG_CONNECT_RETRIES", "2")
+	t.Setenv("PG_QUERY_TIMEOUT", "2s")
+	t.Setenv("PG_CONNECT_BACKOFF", "250ms")
+	t.Setenv("PG_MIN_IDLE_CONNS", "10")
+	t.Setenv("PG_LOG_STATEMENTS", "true")
+	cfg, err := poolConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := store.DefaultPoolConfig()
+	want.MaxOpenConns = 40
+	want.ConnectRetries = 2
+	want.QueryTimeout = 2 * time.Second
+	want.RetryBackoff = 250 * time.Millisecond
+	want.MinIdleConns = 10
+	want.LogStatements = true
+	if cfg != want {
+		t.Errorf("expected %+v but got %+v", want, cfg)
+	}
+
+	for name, value := range map[string]string{
+		"PG_MAX_OPEN_CONNS":    "many",
+		"PG_CONN_MAX_LIFETIME": "30",
+		"PG_LOG_STATEMENTS":    "sometimes",
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(name, value)
+			if _, err := poolConfigFromEnv(); err == nil {
+				t.Errorf("expected %s=%q to be rejected", name, value)
+			}
+		})
+	}
+}
+
+func TestProxyConfigFromEnv(t *testing.T) {
+	t.Setenv("PROXY_HEADER", "X-Forwarded-For")
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8, 192.168.1.1")
+	cfg, err := proxyConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(cfg.trusted, []string{"10.0.0.0/8", "192.168.1.1"}) {
+		t.Errorf("unexpected trusted proxies %v", cfg.trusted)
+	}
+
+	for _, env := range []string{"", "10.0.0.0/33", "proxy.local"} {
+		t.Setenv("TRUSTED_PROXIES", env)
+		if _, err := proxyConfigFromEnv(); err == nil {
+			t.Errorf("expected TRUSTED_PROXIES=%q to be rejected", env)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"fiber/api"
+	"fiber/middleware"
+	"fiber/openapi"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const apiVersion = "1.0.0"
+
+// openAPIDocument describes the route table as an OpenAPI 3.1 document.
+func openAPIDocument(routes []route) *openapi.Document {
+	schemas := openapi.Schemas{}
+	errorSchema := schemas.Of(api.Error{})
+	validationSchema := schemas.Of(api.ValidationError{})
+	errorResponse := func(description string, schema *openapi.Schema) *openapi.Response {
+		return &openapi.Response{
+			Description: description,
+			Content:     map[string]openapi.MediaType{fiber.MIMEApplicationJSON: {Schema: schema}},
+		}
+	}
+
+	doc := &openapi.Document{
+		OpenAPI: openapi.Version,
+		Info: openapi.Info{
+			Title:   "fiber_CRUD API",
+			Version: apiVersion,
+		},
+		Paths: map[string]*openapi.PathItem{},
+	}
+	for _, r := range routes {
+		op := &openapi.Operation{
+			OperationID: r.name,
+			Summary:     r.summary,
+			Tags:        []string{r.tag},
+			Responses:   map[string]*openapi.Response{},
+			Security:    []map[string][]string{},
+		}
+		if r.access != public {
+			op.Security = append(op.Security, map[string][]string{"bearerAuth": {}})
+			op.Responses["401"] = errorResponse("Missing or invalid token", errorSchema)
+		}
+		if r.access == admin {
+			op.Responses["403"] = errorResponse("Caller is not an admin", errorSchema)
+		}
+
+		pathParams := openapi.PathParams(r.path)
+		for _, name := range pathParams {
+			op.Parameters = append(op.Parameters, openapi.Parameter{Name: name, In: "path", Required: true, Schema: &openapi.Schema{Type: "integer"}})
+		}
+		if r.query != nil {
+			op.Parameters = append(op.Parameters, schemas.QueryParams(r.query)...)
+		}
+		op.Parameters = append(op.Parameters, r.params...)
+		if r.idempotent {
+			op.Parameters = append(op.Parameters, headerParam(middleware.IdempotencyKeyHeader, "replay the first response to this key"))
+		}
+		if r.conditional {
+			op.Parameters = append(op.Parameters, headerParam(fiber.HeaderIfMatch, "only apply while the user still has one of these ETags"))
+			op.Responses["412"] = errorResponse("The user was modified", errorSchema)
+		}
+
+		if r.body != nil {
+			op.RequestBody = &openapi.RequestBody{Required: true, Content: content(schemas.Of(r.body), r.bodyTypes)}
+		}
+		if r.body != nil || r.query != nil || len(pathParams) > 0 {
+			op.Responses["400"] = errorResponse("Malformed request", errorSchema)
+			op.Responses["422"] = errorResponse("Validation failed", validationSchema)
+		}
+		if len(pathParams) > 0 {
+			op.Responses["404"] = errorResponse("Not found", errorSchema)
+		}
+		op.Responses["429"] = errorResponse("Rate limit exceeded, retry after Retry-After seconds", errorSchema)
+		op.Responses["200"] = &openapi.Response{Description: "OK", Content: content(schemas.Of(r.response), r.responseTypes)}
+		op.Responses["default"] = errorResponse("Unexpected error", errorSchema)
+
+		path := openapi.Path(r.path)
+		item, ok := doc.Paths[path]
+		if !ok {
+			item = &openapi.PathItem{}
+			doc.Paths[path] = item
+		}
+		(*item)[strings.ToLower(r.method)] = op
+	}
+
+	doc.Components = openapi.Components{
+		Schemas: schemas,
+		SecuritySchemes: map[string]*openapi.SecurityScheme{
+			"bearerAuth": {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+		},
+	}
+	return doc
+}
+
+func content(schema *openapi.Schema, mediaTypes []string) map[string]openapi.MediaType {
+	if len(mediaTypes) == 0 {
+		mediaTypes = []string{fiber.MIMEApplicationJSON}
+	}
+	c := map[string]openapi.MediaType{}
+	for _, mediaType := range mediaTypes {
+		c[mediaType] = openapi.MediaType{Schema: schema}
+	}
+	return c
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"encoding/json"
+	"fiber/api"
+	"fiber/fault"
+	"fiber/graphqlapi"
+	"fiber/middleware"
+	"fiber/openapi"
+	"fiber/store"
+	"fiber/stream"
+	"fiber/webhook"
+	"fmt"
+	"net/http/httptest"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// undocumented are the routes that are not part of the API itself.
+var undocumented = []string{"/openapi.json", "/docs"}
+
+func newTestApp(t *testing.T) *fiber.App {
+	return newTestAppWith(t, nil, routeDeps{})
+}
+
+// newTestAppWith builds the app with the user routes on userStore, and fault
+// injection on unless deps has an injector already.
+func newTestAppWith(t *testing.T, userStore store.UserStore, deps routeDeps) *fiber.App {
+	if deps.injector == nil {
+		deps.injector = fault.NewInjector()
+	}
+	if deps.metrics == nil {
+		deps.metrics = middleware.NewPromMetrics(prometheus.NewRegistry(), nil)
+	}
+	deps.userStore = userStore
+	deps.adminStore = userStore
+	graphqlHandler, err := graphqlapi.NewHandler(nil, graphqlapi.DefaultLimits())
+	if err != nil {
+		t.Fatal(err)
+	}
+	app, err := newApp(handlers{
+		user:    api.NewUserHandler(userStore),
+		auth:    api.NewAuthHandler(nil, nil),
+		audit:   api.NewAuditHandler(nil),
+		bulk:    api.NewImportHandler(nil),
+		batch:   api.NewBatchHandler(nil),
+		events:  api.NewEventsHandler(stream.NewBroker(), nil),
+		webhook: api.NewWebhookHandler(nil, webhook.TargetPolicy{}),
+		graphql: graphqlHandler,
+		faults:  api.NewFaultHandler(deps.injector),
+	}, deps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return app
+}
+
+func fetchSpec(t *testing.T, app *fiber.App) *openapi.Document {
+	resp, err := app.Test(httptest.NewRequest("GET", "/openapi.json", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc openapi.Document
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		t.Fatal(err)
+	}
+	return &doc
+}
+
+func TestOpenAPIMatchesRoutes(t *testing.T) {
+	app := newTestApp(t)
+	doc := fetchSpec(t, app)
+	if doc.OpenAPI != openapi.Version {
+		t.Fatalf("expected OpenAPI %s but got %s", openapi.Version, doc.OpenAPI)
+	}
+
+	var registered []string
+	for _, r := range app.GetRoutes(true) {
+		if r.Method == fiber.MethodHead || slices.Contains(undocumented, r.Path) {
+			continue
+		}
+		registered = append(registered, fmt.Sprintf("%s %s", r.Method, openapi.Path(r.Path)))
+	}
+	sort.Strings(registered)
+
+	var documented []string
+	for path, item := range doc.Paths {
+		for method := range *item {
+			documented = append(documented, fmt.Sprintf("%s %s", strings.ToUpper(method), path))
+		}
+	}
+	sort.Strings(documented)
+
+	for _, r := range registered {
+		if !slices.Contains(documented, r) {
+			t.Errorf("route %s is not in the OpenAPI document", r)
+		}
+	}
+	for _, r := range documented {
+		if !slices.Contains(registered, r) {
+			t.Errorf("operation %s is documented but not registered", r)
+		}
+	}
+}
+
+func TestOpenAPIReferencesResolve(t *testing.T) {
+	doc := fetchSpec(t, newTestApp(t))
+	spec, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ref := range strings.Split(string(spec), `"$ref":"#/components/schemas/`)[1:] {
+		name, _, _ := strings.Cut(ref, `"`)
+		if _, ok := doc.Components.Schemas[name]; !ok {
+			t.Errorf("schema %s is referenced but not defined", name)
+		}
+	}
+
+	user := doc.Components.Schemas["CreateUserParams"]
+	if user == nil || user.Properties["firstName"].MinLength == nil || !slices.Contains(user.Required, "email") {
+		t.Errorf("expected CreateUserParams to carry its validation constraints but got %+v", user)
+	}
+}
@@ -0,0 +1,265 @@
+package server
+
+import (
+	"fiber/api"
+	"fiber/fault"
+	"fiber/graphqlapi"
+	"fiber/middleware"
+	"fiber/openapi"
+	"fiber/ratelimit"
+	"fiber/store"
+	"fiber/types"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/graphql-go/graphql"
+)
+
+type access int
+
+const (
+	public access = iota
+	authenticated
+	admin
+)
+
+// route is an entry of the API route table, which both registers the route
+// and describes it in the OpenAPI document.
+type route struct {
+	method  string
+	path    string
+	name    string
+	handler fiber.Handler
+	access  access
+	// idempotent routes accept an Idempotency-Key.
+	idempotent bool
+	// conditional routes honour If-Match.
+	conditional bool
+	// control routes are never subject to fault injection and authenticate
+	// against the undecorated store, so a bad fault rule can always be removed.
+	control bool
+	// rateLimit is the rate limit policy group of the route; "" is limitAPI.
+	rateLimit string
+
+	summary string
+	tag     string
+	params  []openapi.Parameter
+	// query is a query params struct such as types.AuditFilter.
+	query any
+	// body is the JSON request body; bodyTypes overrides its media types.
+	body      any
+	bodyTypes []string
+	// response is the JSON success body; responseTypes overrides its media types.
+	response      any
+	responseTypes []string
+}
+
+// Rate limit policy groups; limitMetrics is the one of the admin /metrics.
+const (
+	limitAPI     = "api"
+	limitAuth    = "auth"
+	limitMetrics = "metrics"
+)
+
+type handlers struct {
+	user    *api.UserHandler
+	auth    *api.AuthHandler
+	audit   *api.AuditHandler
+	bulk    *api.ImportHandler
+	batch   *api.BatchHandler
+	events  *api.EventsHandler
+	webhook *api.WebhookHandler
+	graphql *graphqlapi.Handler
+	faults  *api.FaultHandler // nil unless fault injection is enabled
+}
+
+func headerParam(name, description string) openapi.Parameter {
+	return openapi.Parameter{Name: name, In: "header", Description: description, Schema: &openapi.Schema{Type: "string"}}
+}
+
+func queryParam(name, typ, description string) openapi.Parameter {
+	return openapi.Parameter{Name: name, In: "query", Description: description, Schema: &openapi.Schema{Type: typ}}
+}
+
+// apiRoutes is the route table of the API.
+func apiRoutes(h handlers) []route {
+	routes := []route{
+		{method: fiber.MethodPost, path: "/api/auth", name: "HandleAuthenticate", handler: h.auth.HandleAuthenticate,
+			rateLimit: limitAuth,
+			summary:   "Log in and get a token", tag: "auth", body: api.AuthParams{}, response: api.AuthResponse{}},
+
+		{method: fiber.MethodPost, path: "/api/v1/user", name: "HandlePostUser", handler: h.user.HandlePostUser,
+			access: authenticated, idempotent: true,
+			summary: "Create a user", tag: "users", body: types.CreateUserParams{}, response: types.User{}},
+		{method: fiber.MethodPut, path: "/api/v1/user/:id", name: "HandlePutUser", handler: h.user.HandlePutUser,
+			access: authenticated, idempotent: true, conditional: true,
+			summary: "Replace a user", tag: "users", body: types.UpdateUserParams{}, response: types.User{}},
+		{method: fiber.MethodPatch, path: "/api/v1/user/:id", name: "HandlePatchUser", handler: h.user.HandlePatchUser,
+			access: authenticated, idempotent: true, conditional: true,
+			summary: "Patch a user", tag: "users", body: map[string]any{}, bodyTypes: []string{"application/merge-patch+json", "application/json-patch+json"},
+			response: types.User{}},
+		{method: fiber.MethodDelete, path: "/api/v1/user/:id", name: "HandleDeleteUser", handler: h.user.HandleDeleteUser,
+			access: authenticated, idempotent: true, conditional: true,
+			summary: "Soft delete a user, or purge it as an admin", tag: "users",
+			params:   []openapi.Parameter{queryParam("hard", "boolean", "purge the user for good (admin only)")},
+			response: map[string]string{}},
+		{method: fiber.MethodGet, path: "/api/v1/user/:id", name: "HandleGetUserByID", handler: h.user.HandleGetUserByID,
+			access:  authenticated,
+			summary: "Get a user", tag: "users",
+			params:   []openapi.Parameter{headerParam(fiber.HeaderIfNoneMatch, "answer 304 when the user still has this ETag")},
+			response: types.User{}},
+		{method: fiber.MethodPost, path: "/api/v1/user/:id/restore", name: "HandleRestoreUser", handler: h.user.HandleRestoreUser,
+			access: admin, idempotent: true,
+			summary: "Restore a soft-deleted user", tag: "users", response: types.User{}},
+
+		{method: fiber.MethodGet, path: "/api/v1/users", name: "HandleGetUsers", handler: h.user.HandleGetUsers,
+			access:  authenticated,
+			summary: "List users, a page at a time with limit", tag: "users", query: types.UserPage{}, response: []types.User{}},
+		{method: fiber.MethodGet, path: "/api/v1/users/events", name: "HandleUserEvents", handler: h.events.HandleUserEvents,
+			access:  authenticated,
+			summary: "Stream user changes as Server-Sent Events", tag: "users",
+			params: []openapi.Parameter{
+				headerParam("Last-Event-ID", "replay the events after this one from the event log"),
+				queryParam("lastEventId", "integer", "same as Last-Event-ID"),
+			},
+			response: types.UserEvent{}, responseTypes: []string{"text/event-stream"}},
+		{method: fiber.MethodGet, path: "/api/v1/users/events/ws", name: "HandleUserEventsWebSocket", handler: h.events.HandleUserEventsWebSocket,
+			access:  authenticated,
+			summary: "Stream user changes over a WebSocket", tag: "users",
+			params:   []openapi.Parameter{queryParam("lastEventId", "integer", "replay the events after this one from the event log")},
+			response: types.UserEvent{}},
+		{method: fiber.MethodPost, path: "/api/v1/users/import", name: "HandleImportUsers", handler: h.bulk.HandleImportUsers,
+			access: admin, idempotent: true,
+			summary: "Import users from CSV or NDJSON", tag: "users",
+			params: []openapi.Parameter{
+				queryParam("atomic", "boolean", "import every row or none"),
+				queryParam("dryRun", "boolean", "check the rows without importing them"),
+			},
+			body: "", bodyTypes: []string{"text/csv", "application/x-ndjson"}, response: types.ImportReport{}},
+		{method: fiber.MethodGet, path: "/api/v1/users/export", name: "HandleExportUsers", handler: h.bulk.HandleExportUsers,
+			access:  admin,
+			summary: "Export users as CSV or NDJSON", tag: "users",
+			params:   []openapi.Parameter{{Name: "format", In: "query", Schema: &openapi.Schema{Type: "string", Enum: []any{"csv", "ndjson"}}}},
+			response: "", responseTypes: []string{"text/csv", "application/x-ndjson"}},
+		{method: fiber.MethodPost, path: types.BatchPath, name: "HandleBatch", handler: h.batch.HandleBatch,
+			access: authenticated, idempotent: true,
+			summary: "Run several requests at once", tag: "batch", body: types.BatchRequest{}, response: types.BatchResponse{}},
+		{method: fiber.MethodPost, path: "/graphql", name: "HandleGraphQL", handler: h.graphql.HandleGraphQL,
+			access:  authenticated,
+			summary: "Run a GraphQL query or mutation", tag: "graphql", body: graphqlapi.Request{}, response: graphql.Result{}},
+		{method: fiber.MethodGet, path: "/api/v1/audit", name: "HandleGetAuditEvents", handler: h.audit.HandleGetAuditEvents,
+			access:  admin,
+			summary: "List audit events", tag: "audit", query: types.AuditFilter{},
+			params: []openapi.Parameter{
+				{Name: "from", In: "query", Schema: &openapi.Schema{Type: "string", Format: "date-time"}},
+				{Name: "to", In: "query", Schema: &openapi.Schema{Type: "string", Format: "date-time"}},
+			},
+			response: []types.AuditEvent{}},
+
+		{method: fiber.MethodPost, path: "/api/v1/webhooks", name: "HandlePostWebhook", handler: h.webhook.HandlePostWebhook,
+			access: admin, idempotent: true,
+			summary: "Subscribe a URL to user events", tag: "webhooks", body: types.WebhookParams{}, response: types.Webhook{}},
+		{method: fiber.MethodGet, path: "/api/v1/webhooks", name: "HandleGetWebhooks", handler: h.webhook.HandleGetWebhooks,
+			access:  admin,
+			summary: "List webhooks", tag: "webhooks", response: []types.Webhook{}},
+		// Registered before /api/v1/webhooks/:id, which would match them too.
+		{method: fiber.MethodGet, path: "/api/v1/webhooks/deliveries", name: "HandleGetWebhookDeliveries", handler: h.webhook.HandleGetWebhookDeliveries,
+			access:  admin,
+			summary: "List webhook deliveries, status=dead for the dead letters", tag: "webhooks",
+			query: types.WebhookDeliveryFilter{}, response: []types.WebhookDelivery{}},
+		{method: fiber.MethodPost, path: "/api/v1/webhooks/deliveries/:id/redeliver", name: "HandleRedeliverWebhook", handler: h.webhook.HandleRedeliverWebhook,
+			access: admin, idempotent: true,
+			summary: "Send a dead or delivered webhook delivery again", tag: "webhooks", response: types.WebhookDelivery{}},
+		{method: fiber.MethodGet, path: "/api/v1/webhooks/:id", name: "HandleGetWebhook", handler: h.webhook.HandleGetWebhook,
+			access:  admin,
+			summary: "Get a webhook", tag: "webhooks", response: types.Webhook{}},
+		{method: fiber.MethodPut, path: "/api/v1/webhooks/:id", name: "HandlePutWebhook", handler: h.webhook.HandlePutWebhook,
+			access: admin, idempotent: true,
+			summary: "Replace a webhook", tag: "webhooks", body: types.WebhookParams{}, response: types.Webhook{}},
+		{method: fiber.MethodDelete, path: "/api/v1/webhooks/:id", name: "HandleDeleteWebhook", handler: h.webhook.HandleDeleteWebhook,
+			access: admin, idempotent: true,
+			summary: "Delete a webhook and its deliveries", tag: "webhooks", response: map[string]string{}},
+	}
+
+	if h.faults != nil {
+		routes = append(routes,
+			route{method: fiber.MethodGet, path: "/api/v1/admin/faults", name: "HandleGetFaults", handler: h.faults.HandleGetFaults,
+				access: admin, control: true,
+				summary: "List fault injection rules", tag: "faults", response: []fault.Rule{}},
+			route{method: fiber.MethodPut, path: "/api/v1/admin/faults", name: "HandlePutFault", handler: h.faults.HandlePutFault,
+				access: admin, control: true,
+				summary: "Set a fault injection rule", tag: "faults", body: fault.Rule{}, response: []fault.Rule{}},
+			route{method: fiber.MethodDelete, path: "/api/v1/admin/faults", name: "HandleDeleteFault", handler: h.faults.HandleDeleteFault,
+				access: admin, control: true,
+				summary: "Remove fault injection rules", tag: "faults",
+				params: []openapi.Parameter{
+					queryParam("method", "string", "method of the rule to remove; all rules when method and path are empty"),
+					queryParam("path", "string", "route template of the rule to remove"),
+				},
+				response: []fault.Rule{}},
+		)
+	}
+	return routes
+}
+
+// routeDeps is what registerRoutes wraps the handlers of the route table with.
+type routeDeps struct {
+	metrics     *middleware.PromMetrics
+	injector    *fault.Injector // nil unless fault injection is enabled
+	userStore   store.UserStore
+	adminStore  store.UserStore
+	idempotency store.IdempotencyStore
+	ttl         time.Duration
+	rateLimiter *middleware.RateLimiter // nil when rate limiting is off
+	// rateLimits are the policies by group; groups without one are not limited.
+	rateLimits map[string]ratelimit.Policy
+	// proxy tells the client address behind a reverse proxy.
+	proxy proxyConfig
+}
+
+// rateLimit returns the policy of a rate limit group, if any; "" is limitAPI.
+func (deps routeDeps) rateLimit(group string) (ratelimit.Policy, bool) {
+	if deps.rateLimiter == nil {
+		return ratelimit.Policy{}, false
+	}
+	if group == "" {
+		group = limitAPI
+	}
+	policy, ok := deps.rateLimits[group]
+	return policy, ok
+}
+
+func registerRoutes(app *fiber.App, routes []route, deps routeDeps) {
+	for _, r := range routes {
+		handler := r.handler
+		if r.idempotent {
+			// Inside authentication, so keys are scoped to the caller.
+			handler = middleware.WithIdempotency(handler, deps.idempotency, deps.ttl)
+		}
+		// Policies by IP run before authentication so that floods are turned
+		// away cheaply; the others need the authenticated user.
+		policy, limited := deps.rateLimit(r.rateLimit)
+		if limited && policy.KeyBy != ratelimit.ByIP {
+			handler = deps.rateLimiter.WithRateLimit(handler, policy)
+		}
+		// Inside authentication, so that an injected database failure fails
+		// the handler's store calls rather than the lookup of the caller.
+		if deps.injector != nil && !r.control {
+			handler = middleware.WithFaults(handler, deps.injector)
+		}
+		authStore := deps.userStore
+		if r.control {
+			authStore = deps.adminStore
+		}
+		switch r.access {
+		case authenticated:
+			handler = WithAuth(handler, authStore)
+		case admin:
+			handler = WithAdmin(handler, authStore)
+		}
+		if limited && policy.KeyBy == ratelimit.ByIP {
+			handler = deps.rateLimiter.WithRateLimit(handler, policy)
+		}
+		app.Add(r.method, r.path, WrapHandler(deps.metrics, handler, r.name))
+	}
+}
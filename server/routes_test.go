@@ -0,0 +1,118 @@
+package server
+
+import (
+	"context"
+	"fiber/api"
+	"fiber/fault"
+	"fiber/middleware"
+	"fiber/ratelimit"
+	"fiber/store"
+	"fiber/store/storetest"
+	"fiber/types"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestRateLimitedRoutes(t *testing.T) {
+	limits := map[string]ratelimit.Policy{}
+	for _, group := range []string{limitAuth, limitAPI} {
+		limits[group] = ratelimit.Policy{Name: group, Algorithm: ratelimit.SlidingWindow, Limit: 1, Window: time.Minute, KeyBy: ratelimit.ByIP}
+	}
+	limiter := middleware.NewRateLimiter(ratelimit.NewMemory(), prometheus.NewRegistry())
+	app := newTestAppWith(t, nil, routeDeps{rateLimiter: limiter, rateLimits: limits})
+
+	statuses := func(method, path string) []int {
+		var got []int
+		for range 2 {
+			resp, err := app.Test(httptest.NewRequest(method, path, strings.NewReader("{}")))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, resp.StatusCode)
+		}
+		return got
+	}
+
+	// By IP, so even requests that fail authentication count.
+	if got := statuses(fiber.MethodGet, "/api/v1/users"); got[1] != fiber.StatusTooManyRequests {
+		t.Errorf("expected the API to be limited, got %v", got)
+	}
+	if got := statuses(fiber.MethodPost, "/api/auth"); got[0] == fiber.StatusTooManyRequests || got[1] != fiber.StatusTooManyRequests {
+		t.Errorf("expected logins to be limited apart from the API, got %v", got)
+	}
+}
+
+func TestInjectedDBFailureSparesAuthentication(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	mem := storetest.NewMemStore()
+	user, _ := mem.InsertUser(context.Background(), &types.User{FirstName: "Ada", Email: "ada@foo.com"})
+	token, err := api.CreateTokenFromUser(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	injector := fault.NewInjector()
+	injector.SetRule(fault.Rule{Method: fiber.MethodGet, Path: "/api/v1/user/:id", DBFailureRate: 1})
+	app := newTestAppWith(t, store.NewFaultStore(mem), routeDeps{injector: injector})
+
+	req := httptest.NewRequest(fiber.MethodGet, "/api/v1/user/1", nil)
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusInternalServerError {
+		t.Errorf("expected the handler to fail with 500 after authenticating, got %d", resp.StatusCode)
+	}
+}
+
+func TestImportBodyLimit(t *testing.T) {
+	app := newTestApp(t)
+	if limit := app.Config().BodyLimit; limit != api.MaxImportBytes {
+		t.Errorf("expected request bodies to be limited to %d bytes, got %d", api.MaxImportBytes, limit)
+	}
+	// fasthttp answers larger bodies with 413 and closes the connection,
+	// which app.Test reports as an error.
+	body := strings.Repeat("x", api.MaxImportBytes+1)
+	req := httptest.NewRequest(fiber.MethodPost, "/api/v1/users/import", strings.NewReader(body))
+	req.Header.Set(fiber.HeaderContentType, "text/csv")
+	if _, err := app.Test(req); err == nil {
+		t.Error("expected an import above the limit to be rejected")
+	}
+}
+
+func TestRateLimitBehindProxy(t *testing.T) {
+	limits := map[string]ratelimit.Policy{
+		limitAuth: {Name: limitAuth, Algorithm: ratelimit.SlidingWindow, Limit: 1, Window: time.Minute, KeyBy: ratelimit.ByIP},
+	}
+	login := func(app *fiber.App, client string) int {
+		req := httptest.NewRequest(fiber.MethodPost, "/api/auth", strings.NewReader("{}"))
+		req.Header.Set(fiber.HeaderXForwardedFor, client)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+	newApp := func(trusted string) *fiber.App {
+		limiter := middleware.NewRateLimiter(ratelimit.NewMemory(), prometheus.NewRegistry())
+		proxy := proxyConfig{header: fiber.HeaderXForwardedFor, trusted: []string{trusted}}
+		return newTestAppWith(t, nil, routeDeps{rateLimiter: limiter, rateLimits: limits, proxy: proxy})
+	}
+
+	// app.Test connects from 0.0.0.0.
+	app := newApp("0.0.0.0/8")
+	login(app, "203.0.113.1")
+	if got := login(app, "203.0.113.2, 10.0.0.1"); got == fiber.StatusTooManyRequests {
+		t.Error("expected the clients behind a trusted proxy to be limited apart")
+	}
+	app = newApp("10.0.0.1")
+	login(app, "203.0.113.1")
+	if got := login(app, "203.0.113.2"); got != fiber.StatusTooManyRequests {
+		t.Errorf("expected the header of an untrusted peer to be ignored, got %d", got)
+	}
+}
@@ -1,47 +1,73 @@
 package server
 
 import (
+	"context"
 	"fiber/api"
+	"fiber/cache"
+	"fiber/fault"
+	"fiber/graphqlapi"
+	"fiber/grpcapi"
 	"fiber/middleware"
+	"fiber/outbox"
+	"fiber/ratelimit"
 	"fiber/store"
+	"fiber/stream"
+	"fiber/webhook"
 	"fmt"
 	"log/slog"
+	"net"
 	"os"
 	"strconv"
 
-	"github.com/gofiber/adaptor/v2"
 	"github.com/gofiber/fiber/v2"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/redis/go-redis/v9"
 )
 
-var config = fiber.Config{
-	ErrorHandler: api.ErrorHandler,
-}
-
 type Server struct {
 	listenAddr string
 	logger     *slog.Logger
+	// ctx is cancelled by Stop and bounds the background jobs started by Run.
+	ctx    context.Context
+	cancel context.CancelFunc
+	// redis is shared by the features using Redis; see redisClient.
+	redis *redis.Client
 }
 
 func NewServer(addr string) *Server {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &Server{
 		listenAddr: addr,
 		logger:     slog.Default(),
+		ctx:        ctx,
+		cancel:     cancel,
 	}
 }
 
 func (s *Server) Stop() {
+	s.cancel()
 	s.logger.Info("server stopped")
 }
 
-func RegisterMetrics(app *fiber.App) {
-	app.Get("/metrics", adaptor.HTTPHandler(promhttp.Handler()))
+func newRegistry() *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return reg
 }
 
 func (s *Server) Run() {
 	port, _ := strconv.Atoi(os.Getenv("PG_PORT"))
 	connStr := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable", os.Getenv("PG_HOST"), port, os.Getenv("PG_USER"), os.Getenv("PG_PASS"), os.Getenv("PG_DB_NAME"))
-	db, err := store.NewPostgresStore(connStr)
+	poolConfig, err := poolConfigFromEnv()
+	if err != nil {
+		s.logger.Error("error to configure Postgres pool", "error", err.Error())
+		return
+	}
+	db, err := store.NewPostgresStore(connStr, poolConfig)
 	if err != nil {
 		s.logger.Error("error to connect to Posgres database", "error", err.Error())
 		return
@@ -56,28 +82,166 @@ func (s *Server) Run() {
 		fmt.Println(err)
 	}
 
+	retention, err := retentionFromEnv()
+	if err != nil {
+		s.logger.Error("error to configure user retention", "error", err.Error())
+		return
+	}
+
+	idempotencyKeyTTL, err := idempotencyTTL()
+	if err != nil {
+		s.logger.Error("error to configure idempotency keys", "error", err.Error())
+		return
+	}
+
+	buckets, err := latencyBuckets()
+	if err != nil {
+		s.logger.Error("error to configure metrics", "error", err.Error())
+		return
+	}
+	slowQuery, err := slowQueryThreshold()
+	if err != nil {
+		s.logger.Error("error to configure store metrics", "error", err.Error())
+		return
+	}
+	registry := newRegistry()
+	registry.MustRegister(db.StatsCollector())
+	promMetrics := middleware.NewPromMetrics(registry, buckets)
+
+	// Fault injection is only wired in when explicitly enabled, so production
+	// builds never carry the chaos routes or the failing store decorator.
 	var (
-		app          = fiber.New(config)
-		checkHandler = api.NewCheckHandler
-		userHandler  = api.NewUserHandler(db)
-		authHandler  = api.NewAuthHandler(db)
-		promMetrics  = middleware.NewPromMetrics()
-		check        = app.Group("/check")
-		auth         = app.Group("/api")
-		apiv1        = app.Group("/api/v1")
+		injector  *fault.Injector
+		userStore store.BulkUserStore = db
 	)
-	RegisterMetrics(app)
+	if faultInjectionEnabled() {
+		s.logger.Warn("fault injection is enabled")
+		injector = fault.NewInjector()
+		userStore = store.NewFaultStore(userStore)
+	}
+	// Instrumentation wraps the fault store so injected failures show up in the store metrics.
+	userStore = store.NewInstrumentedStore(userStore, registry, slowQuery)
+	eventLogSize, err := userEventLogSize()
+	if err != nil {
+		s.logger.Error("error to configure the user event log", "error", err.Error())
+		return
+	}
+	broker := stream.NewBroker()
+	webhookConfig, err := webhookConfigFromEnv()
+	if err != nil {
+		s.logger.Error("error to configure webhooks", "error", err.Error())
+		return
+	}
+	outboxConfig, err := outboxConfigFromEnv()
+	if err != nil {
+		s.logger.Error("error to configure the outbox", "error", err.Error())
+		return
+	}
+	sink, err := s.outboxSink(outboxConfig)
+	if err != nil {
+		s.logger.Error("error to connect the outbox sinks", "error", err.Error())
+		return
+	}
+	cacheConfig, err := userCacheConfigFromEnv()
+	if err != nil {
+		s.logger.Error("error to configure the user cache", "error", err.Error())
+		return
+	}
+	if userCache, err := s.userCache(cacheConfig); err != nil {
+		s.logger.Error("error to connect the user cache", "error", err.Error())
+		return
+	} else if userCache != nil {
+		// Caching outermost keeps hits out of the store metrics, which then
+		// count the queries actually made.
+		cached := store.NewCachedStore(userStore, userCache, registry)
+		userStore = cached
+		go invalidateUserCache(s.ctx, broker, cached)
+	}
+	rateLimitConfig, err := rateLimitConfigFromEnv()
+	if err != nil {
+		s.logger.Error("error to configure rate limits", "error", err.Error())
+		return
+	}
+	rateLimiter, err := s.rateLimiter(rateLimitConfig, registry)
+	if err != nil {
+		s.logger.Error("error to connect the rate limiter", "error", err.Error())
+		return
+	}
 
-	auth.Post("/auth", WrapHandler(promMetrics, authHandler.HandleAuthenticate, "HandleAuthenticate"))
+	graphqlLimits, err := graphQLLimits()
+	if err != nil {
+		s.logger.Error("error to configure GraphQL", "error", err.Error())
+		return
+	}
+	graphqlHandler, err := graphqlapi.NewHandler(userStore, graphqlLimits)
+	if err != nil {
+		s.logger.Error("error to build the GraphQL schema", "error", err.Error())
+		return
+	}
+	var faultHandler *api.FaultHandler
+	if injector != nil {
+		faultHandler = api.NewFaultHandler(injector)
+	}
+	proxyConfig, err := proxyConfigFromEnv()
+	if err != nil {
+		s.logger.Error("error to configure proxies", "error", err.Error())
+		return
+	}
+	adminConfig, err := adminConfigFromEnv()
+	if err != nil {
+		s.logger.Error("error to configure the admin server", "error", err.Error())
+		return
+	}
+	deps := routeDeps{
+		metrics:     promMetrics,
+		injector:    injector,
+		userStore:   userStore,
+		adminStore:  db,
+		idempotency: db,
+		ttl:         idempotencyKeyTTL,
+		rateLimiter: rateLimiter,
+		rateLimits:  rateLimitConfig.policies,
+		proxy:       proxyConfig,
+	}
+	app, err := newApp(handlers{
+		user:    api.NewUserHandler(userStore),
+		auth:    api.NewAuthHandler(userStore, db),
+		audit:   api.NewAuditHandler(db),
+		bulk:    api.NewImportHandler(userStore),
+		batch:   api.NewBatchHandler(userStore),
+		events:  api.NewEventsHandler(broker, db),
+		webhook: api.NewWebhookHandler(db, webhook.TargetPolicy{AllowPrivate: webhookConfig.AllowPrivateTargets}),
+		graphql: graphqlHandler,
+		faults:  faultHandler,
+	}, deps)
+	if err != nil {
+		s.logger.Error("error to build the API", "error", err.Error())
+		return
+	}
 
-	check.Get("/healthy", WrapHandler(promMetrics, checkHandler().HandleHealthy, "Healthy"))
-	check.Get("/drop", WrapHandler(promMetrics, checkHandler().HandleDrop, "Drop"))
-	apiv1.Post("/user", WrapHandler(promMetrics, WithAuth(userHandler.HandlePostUser, db), "HandlePostUser"))
-	apiv1.Put("/user/:id", WrapHandler(promMetrics, WithAuth(userHandler.HandlePutUser, db), "HandlePutUser"))
-	apiv1.Delete("/user/:id", WrapHandler(promMetrics, WithAuth(userHandler.HandleDeleteUser, db), "HandleDeleteUser"))
-	apiv1.Get("/user/:id", WrapHandler(promMetrics, WithAuth(userHandler.HandleGetUserByID, db), "HandleGetUserByID"))
+	go store.RunRetention(s.ctx, userStore, retention.period, retention.interval)
+	go store.RunIdempotencyExpiry(s.ctx, db, retention.interval)
+	go store.RunUserEventTrim(s.ctx, db, eventLogSize, retention.interval)
+	go stream.Relay(s.ctx, db, broker)
+	go webhook.NewWorker(db, webhookConfig).Run(s.ctx)
+	go outbox.NewRelay(db, sink, outboxConfig.relay).Run(s.ctx)
 
-	apiv1.Get("/users", WrapHandler(promMetrics, WithAuth(userHandler.HandleGetUsers, db), "HandleGetUsers"))
+	if adminConfig.addr != "off" {
+		if adminConfig.noPprof {
+			s.logger.Warn("pprof is not served without ADMIN_PPROF_AUTH off loopback", "addr", adminConfig.addr)
+		}
+		admin := newAdminApp(api.NewCheckHandler(db), registry, adminConfig, deps)
+		if err := s.serveAdmin(adminConfig.addr, admin); err != nil {
+			s.logger.Error("error to start admin server", "error", err.Error())
+			return
+		}
+	}
+	if addr := grpcListenAddr(); addr != "off" {
+		if err := s.serveGRPC(addr, grpcapi.NewServer(userStore, db)); err != nil {
+			s.logger.Error("error to start gRPC server", "error", err.Error())
+			return
+		}
+	}
 
 	err = app.Listen(s.listenAddr)
 	if err != nil {
@@ -86,14 +250,147 @@ func (s *Server) Run() {
 	}
 }
 
+// serveGRPC serves the gRPC API on addr in the background until Stop.
+func (s *Server) serveGRPC(addr string, srv *grpcapi.Server) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-s.ctx.Done()
+		srv.Stop()
+	}()
+	go func() {
+		if err := srv.Serve(lis); err != nil {
+			s.logger.Error("gRPC server failed", "error", err.Error())
+		}
+	}()
+	s.logger.Info("gRPC server listening", "addr", lis.Addr().String())
+	return nil
+}
+
+// outboxSink connects the sinks of cfg. Connections are closed on Stop.
+func (s *Server) outboxSink(cfg outboxConfig) (outbox.Sink, error) {
+	sinks := outbox.Fanout{}
+	for _, name := range cfg.sinks {
+		switch name {
+		case "log":
+			sinks = append(sinks, outbox.NewLogSink(s.logger))
+		case "nats":
+			sink, nc, err := outbox.DialNATS(cfg.natsURL, cfg.natsPrefix)
+			if err != nil {
+				return nil, err
+			}
+			go func() {
+				<-s.ctx.Done()
+				nc.Drain()
+			}()
+			sinks = append(sinks, sink)
+		}
+	}
+	return sinks, nil
+}
+
+// userCache builds the cache of cfg, nil when it is off. Connections are
+// closed on Stop.
+func (s *Server) userCache(cfg userCacheConfig) (store.UserCache, error) {
+	switch cfg.backend {
+	case "memory":
+		return cache.NewLRU(cfg.size, cfg.ttl), nil
+	case "redis":
+		client, err := s.redisClient(cfg.redisURL)
+		if err != nil {
+			return nil, err
+		}
+		return cache.NewRedis(client, "fiber:user:", cfg.ttl), nil
+	}
+	return nil, nil
+}
+
+// rateLimiter builds the limiter of cfg, nil when rate limiting is off.
+func (s *Server) rateLimiter(cfg rateLimitConfig, reg prometheus.Registerer) (*middleware.RateLimiter, error) {
+	switch cfg.backend {
+	case "memory":
+		return middleware.NewRateLimiter(ratelimit.NewMemory(), reg), nil
+	case "redis":
+		client, err := s.redisClient(cfg.redisURL)
+		if err != nil {
+			return nil, err
+		}
+		return middleware.NewRateLimiter(ratelimit.NewRedis(client, "fiber:ratelimit:"), reg), nil
+	}
+	return nil, nil
+}
+
+// redisClient connects to the Redis at url on first use. Every feature backed
+// by Redis reads REDIS_URL, so they share the client, which is closed on Stop.
+func (s *Server) redisClient(url string) (*redis.Client, error) {
+	if s.redis != nil {
+		return s.redis, nil
+	}
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	s.redis = redis.NewClient(opts)
+	go func(client *redis.Client) {
+		<-s.ctx.Done()
+		client.Close()
+	}(s.redis)
+	return s.redis, nil
+}
+
+// invalidateUserCache evicts the users that change, on this replica or any
+// other, as the user change stream reports them. Events may be missed when the
+// subscription falls behind, so the whole cache is dropped then.
+func invalidateUserCache(ctx context.Context, broker *stream.Broker, cached *store.CachedStore) {
+	for ctx.Err() == nil {
+		sub := broker.Subscribe(256)
+		for event := range sub.Events() {
+			if event.User != nil {
+				cached.Invalidate(ctx, event.User.ID)
+			}
+		}
+		sub.Close()
+		if ctx.Err() == nil {
+			cached.InvalidateAll(ctx)
+		}
+	}
+}
+
+// newApp registers the route table along with the API docs routes.
+func newApp(h handlers, deps routeDeps) (*fiber.App, error) {
+	config := fiber.Config{
+		ErrorHandler: deps.metrics.ErrorHandler(deps.metrics.RecoverErrorHandler(api.ErrorHandler)),
+		BodyLimit:    api.MaxImportBytes,
+	}
+	deps.proxy.apply(&config)
+	app := fiber.New(config)
+	app.Use(api.WithBatchContext)
+	routes := apiRoutes(h)
+	registerRoutes(app, routes, deps)
+
+	docsHandler, err := api.NewDocsHandler(openAPIDocument(routes))
+	if err != nil {
+		return nil, err
+	}
+	app.Get("/openapi.json", docsHandler.HandleOpenAPI)
+	app.Get("/docs", docsHandler.HandleDocs)
+	return app, nil
+}
+
 func WithAuth(handler fiber.Handler, db store.UserStore) fiber.Handler {
 	return middleware.JWTAuthentication(handler, db)
 }
 
+func WithAdmin(handler fiber.Handler, db store.UserStore) fiber.Handler {
+	return middleware.JWTAuthentication(middleware.AdminOnly(handler), db)
+}
+
 func WithLogging(handler fiber.Handler) fiber.Handler {
 	return middleware.LoggingHandlerDecorator(handler)
 }
 
 func WrapHandler(p *middleware.PromMetrics, handler fiber.Handler, handlerName string) fiber.Handler {
-	return p.WithMetrics(WithLogging(handler), handlerName)
+	return middleware.WithRequestID(p.WithMetrics(middleware.WithTracing(WithLogging(middleware.WithAuditMeta(p.WithRecover(handler, handlerName))))))
 }
@@ -0,0 +1,215 @@
+package store
+
+import (
+	"context"
+	"fiber/types"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type AuditStore interface {
+	RecordAuditEvent(context.Context, *types.AuditEvent) error
+	GetAuditEvents(context.Context, types.AuditFilter) ([]*types.AuditEvent, error)
+}
+
+// AuditMeta describes who is behind a request; PostgresStore copies it into
+// every audit event written with the context.
+type AuditMeta struct {
+	ActorID   *int
+	IP        string
+	UserAgent string
+	RequestID string
+}
+
+type auditMetaKey struct{}
+
+func WithAuditMeta(ctx context.Context, meta AuditMeta) context.Context {
+	return context.WithValue(ctx, auditMetaKey{}, meta)
+}
+
+// WithAuditActor sets the actor on the AuditMeta already carried by ctx.
+func WithAuditActor(ctx context.Context, actorID int) context.Context {
+	meta := AuditMetaFromContext(ctx)
+	meta.ActorID = &actorID
+	return WithAuditMeta(ctx, meta)
+}
+
+func AuditMetaFromContext(ctx context.Context) AuditMeta {
+	meta, _ := ctx.Value(auditMetaKey{}).(AuditMeta)
+	return meta
+}
+
+const auditColumns = "id, actor_id, action, target_type, target_id, changes, details, ip, user_agent, request_id, created_at"
+
+const createAuditTable = `create table if not exists audit_events (
+	id bigserial primary key,
+	actor_id integer,
+	action varchar(50) not null,
+	target_type varchar(50) not null,
+	target_id integer,
+	changes jsonb,
+	details jsonb,
+	ip varchar(64),
+	user_agent text,
+	request_id varchar(128),
+	created_at timestamptz not null default now()
+)`
+
+// auditAppendOnly rejects any update or delete on audit_events, including
+// from the application itself.
+const auditAppendOnly = `do $$
+begin
+	create or replace function audit_events_append_only() returns trigger as $fn$
+	begin
+		raise exception 'audit_events is append-only';
+	end;
+	$fn$ language plpgsql;
+
+	if not exists (select 1 from pg_trigger where tgname = 'audit_events_append_only') then
+		create trigger audit_events_append_only
+			before update or delete on audit_events
+			for each row execute function audit_events_append_only();
+	end if;
+end
+$$`
+
+func newAuditEvent(action string, targetID int, changes map[string]types.AuditChange) *types.AuditEvent {
+	return &types.AuditEvent{
+		Action:     action,
+		TargetType: "user",
+		TargetID:   &targetID,
+		Changes:    changes,
+	}
+}
+
+// insertAuditEvent writes event with q, which is the transaction of the audited
+// mutation when there is one. Request metadata is taken from ctx.
+func insertAuditEvent(ctx context.Context, q querier, event *types.AuditEvent) error {
+	return q.QueryRow(ctx, stmtInsertAuditEvent, auditEventArgs(ctx, event)...).Scan(&event.ID, &event.CreatedAt)
+}
+
+// queueAuditEvent is insertAuditEvent for a batch; event is filled in once the
+// batch has been sent.
+func queueAuditEvent(ctx context.Context, batch *pgx.Batch, event *types.AuditEvent) {
+	batch.Queue(stmtInsertAuditEvent, auditEventArgs(ctx, event)...).QueryRow(func(row pgx.Row) error {
+		return row.Scan(&event.ID, &event.CreatedAt)
+	})
+}
+
+// auditEventArgs completes event with the AuditMeta of ctx and returns the
+// arguments of stmtInsertAuditEvent.
+func auditEventArgs(ctx context.Context, event *types.AuditEvent) []any {
+	meta := AuditMetaFromContext(ctx)
+	if event.ActorID == nil {
+		event.ActorID = meta.ActorID
+	}
+	event.IP, event.UserAgent, event.RequestID = meta.IP, meta.UserAgent, meta.RequestID
+
+	var changes, details any
+	if len(event.Changes) > 0 {
+		changes = event.Changes
+	}
+	if len(event.Details) > 0 {
+		details = event.Details
+	}
+
+	return []any{
+		event.ActorID,
+		event.Action,
+		event.TargetType,
+		event.TargetID,
+		changes,
+		details,
+		event.IP,
+		event.UserAgent,
+		event.RequestID,
+	}
+}
+
+func (p *PostgresStore) RecordAuditEvent(ctx context.Context, event *types.AuditEvent) (err error) {
+	ctx, done := p.startQuery(ctx, "RecordAuditEvent")
+	defer done(&err)
+
+	if event.Action != types.AuditAuthLogin || event.TargetID == nil {
+		return insertAuditEvent(ctx, p.conn(ctx), event)
+	}
+	// A successful login is also a domain event.
+	return p.inTx(ctx, func(tx pgx.Tx) error {
+		if err := insertAuditEvent(ctx, tx, event); err != nil {
+			return err
+		}
+		return insertDomainEvent(ctx, tx, types.UserLoggedIn{UserID: *event.TargetID, IP: event.IP})
+	})
+}
+
+func (p *PostgresStore) GetAuditEvents(ctx context.Context, filter types.AuditFilter) (_ []*types.AuditEvent, err error) {
+	ctx, done := p.startQuery(ctx, "GetAuditEvents")
+	defer done(&err)
+
+	filter = filter.WithDefaults()
+	where := []string{}
+	args := []any{pgx.QueryExecModeExec}
+	add := func(clause string, arg any) {
+		args = append(args, arg)
+		where = append(where, fmt.Sprintf(clause, len(args)-1))
+	}
+	if filter.ActorID != 0 {
+		add("actor_id = $%d", filter.ActorID)
+	}
+	if filter.TargetID != 0 {
+		add("target_id = $%d", filter.TargetID)
+	}
+	if filter.Action != "" {
+		add("action = $%d", filter.Action)
+	}
+	if !filter.From.IsZero() {
+		add("created_at >= $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		add("created_at < $%d", filter.To)
+	}
+
+	query := "select " + auditColumns + " from audit_events"
+	if len(where) > 0 {
+		query += " where " + strings.Join(where, " and ")
+	}
+	args = append(args, filter.Limit, filter.Offset)
+	query += fmt.Sprintf(" order by id desc limit $%d offset $%d", len(args)-2, len(args)-1)
+
+	rows, err := p.conn(ctx).Query(ctx, annotate(ctx, query), args...)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, scanAuditEvent)
+}
+
+func scanAuditEvent(row pgx.CollectableRow) (*types.AuditEvent, error) {
+	event := &types.AuditEvent{}
+	var ip, userAgent, requestID *string
+	err := row.Scan(
+		&event.ID,
+		&event.ActorID,
+		&event.Action,
+		&event.TargetType,
+		&event.TargetID,
+		&event.Changes,
+		&event.Details,
+		&ip,
+		&userAgent,
+		&requestID,
+		&event.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	event.IP, event.UserAgent, event.RequestID = deref(ip), deref(userAgent), deref(requestID)
+	return event, nil
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
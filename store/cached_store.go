@@ -0,0 +1,182 @@
+package store
+
+import (
+	"context"
+	"fiber/types"
+	"log/slog"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sync/singleflight"
+)
+
+// UserCache holds users by ID for CachedStore; entries expire on their own.
+// Errors are not fatal to CachedStore, which falls back to its UserStore.
+type UserCache interface {
+	Get(ctx context.Context, id int) (*types.User, bool, error)
+	Set(ctx context.Context, user *types.User) error
+	Delete(ctx context.Context, id int) error
+	Clear(ctx context.Context) error
+}
+
+// CachedStore serves GetUserByID from a UserCache, loading and caching the
+// users it misses. Concurrent misses of one user share a single load. Changes
+// made through CachedStore evict the user; changes made elsewhere, such as on
+// another replica, must be reported with Invalidate. Missing users are not
+// cached.
+type CachedStore struct {
+	UserStore
+
+	cache UserCache
+	loads singleflight.Group
+	// generation is bumped by every invalidation, so that a load racing with
+	// one does not put back the user it evicted.
+	generation atomic.Uint64
+
+	requests      *prometheus.CounterVec
+	invalidations prometheus.Counter
+	logger        *slog.Logger
+}
+
+func NewCachedStore(next UserStore, cache UserCache, reg prometheus.Registerer) *CachedStore {
+	requests := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "store_cache_requests_total",
+			Help: "Total number of user cache lookups by result: hit, miss or error",
+		},
+		[]string{"result"})
+
+	invalidations := prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "store_cache_invalidations_total",
+			Help: "Total number of users evicted from the user cache by a change",
+		})
+
+	reg.MustRegister(requests, invalidations)
+
+	return &CachedStore{
+		UserStore:     next,
+		cache:         cache,
+		requests:      requests,
+		invalidations: invalidations,
+		logger:        slog.Default(),
+	}
+}
+
+func (s *CachedStore) GetUserByID(ctx context.Context, id int) (*types.User, error) {
+	// A transaction may have changed the user; only it knows.
+	if _, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return s.UserStore.GetUserByID(ctx, id)
+	}
+
+	user, ok, err := s.cache.Get(ctx, id)
+	switch {
+	case err != nil:
+		s.requests.WithLabelValues("error").Inc()
+		s.logger.WarnContext(ctx, "error to read the user cache", "user", id, "error", err.Error())
+	case ok:
+		s.requests.WithLabelValues("hit").Inc()
+		return user, nil
+	default:
+		s.requests.WithLabelValues("miss").Inc()
+	}
+
+	// The load is shared, so it must not fail with the caller that started it.
+	loadCtx := context.WithoutCancel(ctx)
+	v, err, _ := s.loads.Do(strconv.Itoa(id), func() (any, error) {
+		generation := s.generation.Load()
+		user, err := s.UserStore.GetUserByID(loadCtx, id)
+		if err != nil {
+			return nil, err
+		}
+		if s.generation.Load() == generation {
+			if err := s.cache.Set(loadCtx, user); err != nil {
+				s.logger.WarnContext(ctx, "error to write the user cache", "user", id, "error", err.Error())
+			}
+		}
+		return user, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	shared := *v.(*types.User)
+	return &shared, nil
+}
+
+func (s *CachedStore) UpdateUser(ctx context.Context, id int, querySet map[string]any, version int) (types.User, error) {
+	defer s.Invalidate(ctx, id)
+	return s.UserStore.UpdateUser(ctx, id, querySet, version)
+}
+
+func (s *CachedStore) DeleteUser(ctx context.Context, id int, version int) (int, error) {
+	defer s.Invalidate(ctx, id)
+	return s.UserStore.DeleteUser(ctx, id, version)
+}
+
+func (s *CachedStore) RestoreUser(ctx context.Context, id int) (*types.User, error) {
+	defer s.Invalidate(ctx, id)
+	return s.UserStore.RestoreUser(ctx, id)
+}
+
+func (s *CachedStore) PurgeUser(ctx context.Context, id int, version int) (int, error) {
+	defer s.Invalidate(ctx, id)
+	return s.UserStore.PurgeUser(ctx, id, version)
+}
+
+// evictedKey carries the users evicted during a transaction of RunInTx.
+type evictedKey struct{}
+
+// RunInTx evicts the users changed in the transaction once more after it
+// ended: until the commit, other requests may have loaded and cached them again.
+func (s *CachedStore) RunInTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(evictedKey{}).(*[]int); ok {
+		return runInTx(s.UserStore, ctx, fn)
+	}
+	var evicted []int
+	err := runInTx(s.UserStore, context.WithValue(ctx, evictedKey{}, &evicted), fn)
+	for _, id := range evicted {
+		s.Invalidate(ctx, id)
+	}
+	return err
+}
+
+func (s *CachedStore) ImportUsers(ctx context.Context, users []*types.User, opts ImportOptions) ([]error, error) {
+	importer, err := importerOf(s.UserStore)
+	if err != nil {
+		return nil, err
+	}
+	return importer.ImportUsers(ctx, users, opts)
+}
+
+func (s *CachedStore) ExportUsers(ctx context.Context, fn func(*types.User) error) error {
+	importer, err := importerOf(s.UserStore)
+	if err != nil {
+		return err
+	}
+	return importer.ExportUsers(ctx, fn)
+}
+
+// Invalidate evicts the user with id from the cache.
+func (s *CachedStore) Invalidate(ctx context.Context, id int) {
+	if evicted, ok := ctx.Value(evictedKey{}).(*[]int); ok {
+		*evicted = append(*evicted, id)
+	}
+	s.generation.Add(1)
+	s.invalidations.Inc()
+	if err := s.cache.Delete(context.WithoutCancel(ctx), id); err != nil {
+		s.logger.WarnContext(ctx, "error to evict from the user cache", "user", id, "error", err.Error())
+	}
+}
+
+// InvalidateAll empties the cache, for when changes may have gone unreported.
+func (s *CachedStore) InvalidateAll(ctx context.Context) {
+	s.generation.Add(1)
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	if err := s.cache.Clear(ctx); err != nil {
+		s.logger.WarnContext(ctx, "error to clear the user cache", "error", err.Error())
+	}
+}
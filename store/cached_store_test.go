@@ -0,0 +1,184 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fiber/cache"
+	"fiber/types"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// countingStore is a fakeStore counting its loads, which wait for release
+// when it is set.
+type countingStore struct {
+	fakeStore
+	loads   atomic.Int32
+	release chan struct{}
+}
+
+func (c *countingStore) GetUserByID(ctx context.Context, id int) (*types.User, error) {
+	c.loads.Add(1)
+	if c.release != nil {
+		<-c.release
+	}
+	user, err := c.fakeStore.GetUserByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	copied := *user
+	return &copied, nil
+}
+
+func (c *countingStore) UpdateUser(_ context.Context, id int, querySet map[string]any, _ int) (types.User, error) {
+	user := c.users[id]
+	user.FirstName = querySet["first_name"].(string)
+	return *user, nil
+}
+
+func newCountingStore() *countingStore {
+	return &countingStore{fakeStore: fakeStore{users: map[int]*types.User{1: {ID: 1, FirstName: "Ada"}}}}
+}
+
+func TestCachedStore(t *testing.T) {
+	next := newCountingStore()
+	s := NewCachedStore(next, cache.NewLRU(10, time.Minute), prometheus.NewRegistry())
+	ctx := context.Background()
+
+	for range 3 {
+		user, err := s.GetUserByID(ctx, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.FirstName != "Ada" {
+			t.Fatalf("unexpected user %+v", user)
+		}
+		user.FirstName = "changed by the caller"
+	}
+	if _, err := s.GetUserByID(ctx, 2); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected sql.ErrNoRows but got %v", err)
+	}
+	if _, err := s.GetUserByID(ctx, 2); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected sql.ErrNoRows but got %v", err)
+	}
+
+	if got := next.loads.Load(); got != 3 {
+		t.Errorf("expected 1 load of the user and 2 of the missing one but got %d", got)
+	}
+	if got := testutil.ToFloat64(s.requests.WithLabelValues("hit")); got != 2 {
+		t.Errorf("expected 2 hits but got %v", got)
+	}
+	if got := testutil.ToFloat64(s.requests.WithLabelValues("miss")); got != 3 {
+		t.Errorf("expected 3 misses but got %v", got)
+	}
+
+	if _, err := s.UpdateUser(ctx, 1, map[string]any{"first_name": "Grace"}, 1); err != nil {
+		t.Fatal(err)
+	}
+	user, err := s.GetUserByID(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.FirstName != "Grace" {
+		t.Errorf("expected the update to evict the user but got %+v", user)
+	}
+}
+
+func TestCachedStoreCoalescesLoads(t *testing.T) {
+	next := newCountingStore()
+	next.release = make(chan struct{})
+	s := NewCachedStore(next, cache.NewLRU(10, time.Minute), prometheus.NewRegistry())
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.GetUserByID(context.Background(), 1); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	// Let the callers pile up on the first load before it completes.
+	for testutil.ToFloat64(s.requests.WithLabelValues("miss")) < 10 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(next.release)
+	wg.Wait()
+
+	if got := next.loads.Load(); got != 1 {
+		t.Errorf("expected a single load but got %d", got)
+	}
+}
+
+func TestCachedStoreDropsLoadsRacingAnInvalidation(t *testing.T) {
+	next := newCountingStore()
+	next.release = make(chan struct{})
+	lru := cache.NewLRU(10, time.Minute)
+	s := NewCachedStore(next, lru, prometheus.NewRegistry())
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := s.GetUserByID(context.Background(), 1); err != nil {
+			t.Error(err)
+		}
+	}()
+	for next.loads.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	s.Invalidate(context.Background(), 1)
+	close(next.release)
+	<-done
+
+	if lru.Len() != 0 {
+		t.Error("expected the user loaded before the invalidation not to be cached")
+	}
+}
+
+// txCountingStore runs transactions by calling fn directly.
+type txCountingStore struct {
+	*countingStore
+}
+
+func (s txCountingStore) RunInTx(ctx context.Context, fn func(context.Context) error) error {
+	return fn(ctx)
+}
+
+func TestCachedStoreEvictsAfterTransaction(t *testing.T) {
+	next := newCountingStore()
+	s := NewCachedStore(txCountingStore{next}, cache.NewLRU(10, time.Minute), prometheus.NewRegistry())
+	ctx := context.Background()
+
+	err := s.RunInTx(ctx, func(txCtx context.Context) error {
+		if _, err := s.UpdateUser(txCtx, 1, map[string]any{"first_name": "Grace"}, 0); err != nil {
+			return err
+		}
+		// Another request caches the user before the transaction commits.
+		_, err := s.GetUserByID(ctx, 1)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	loads := next.loads.Load()
+	if _, err := s.GetUserByID(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := next.loads.Load(); got != loads+1 {
+		t.Errorf("expected the user to be evicted after the transaction, got %d loads", got-loads)
+	}
+
+	if err := NewCachedStore(next, cache.NewLRU(10, time.Minute), prometheus.NewRegistry()).RunInTx(ctx, func(context.Context) error {
+		return nil
+	}); err == nil {
+		t.Error("expected a store without transactions to fail RunInTx")
+	}
+}
@@ -0,0 +1,183 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fiber/types"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// UserEventStore is the log of user changes. Events are written by a trigger
+// on users, in the transaction of the change, and announced to every replica
+// with NOTIFY once it commits.
+type UserEventStore interface {
+	// UserEventsAfter returns up to limit events following the event with id
+	// after, oldest first.
+	UserEventsAfter(ctx context.Context, after int64, limit int) ([]*types.UserEvent, error)
+	// UserEventBounds returns the ids of the oldest and newest events still
+	// in the log, both 0 when it is empty.
+	UserEventBounds(ctx context.Context) (oldest, newest int64, err error)
+	// ListenUserEvents calls ready once it is listening, then fn with every
+	// event committed from then on, until ctx is done or the connection fails.
+	ListenUserEvents(ctx context.Context, ready func(context.Context) error, fn func(*types.UserEvent)) error
+	// TrimUserEvents deletes all but the newest keep events.
+	TrimUserEvents(ctx context.Context, keep int) (int64, error)
+}
+
+const userEventsChannel = "user_events"
+
+const createUserEventsTable = `create table if not exists user_events (
+	id bigserial primary key,
+	type varchar(20) not null,
+	user_id integer not null,
+	payload jsonb not null,
+	created_at timestamptz not null default now()
+)`
+
+// userEventsTrigger records every visible change of a user in user_events and
+// notifies the user_events channel with the event as JSON. The payload has the
+// shape of types.User, without the password.
+const userEventsTrigger = `do $$
+begin
+	create or replace function user_events_record() returns trigger as $fn$
+	declare
+		event_type text;
+		target users;
+		event user_events;
+	begin
+		if tg_op = 'INSERT' then
+			event_type := 'created'; target := new;
+		elsif tg_op = 'DELETE' then
+			if old.deleted_at is not null then
+				return null;
+			end if;
+			event_type := 'deleted'; target := old;
+		elsif old.deleted_at is null and new.deleted_at is not null then
+			event_type := 'deleted'; target := new;
+		elsif old.deleted_at is not null and new.deleted_at is null then
+			event_type := 'created'; target := new;
+		elsif new.deleted_at is null then
+			event_type := 'updated'; target := new;
+		else
+			return null;
+		end if;
+
+		insert into user_events (type, user_id, payload) values (event_type, target.id, jsonb_build_object(
+			'id', target.id,
+			'firstName', target.first_name,
+			'lastName', target.last_name,
+			'email', target.email,
+			'isAdmin', target.admin,
+			'createdAt', target.created_at,
+			'deletedAt', target.deleted_at,
+			'version', target.version))
+		returning * into event;
+		perform pg_notify('user_events', jsonb_build_object(
+			'id', event.id,
+			'type', event.type,
+			'user', event.payload,
+			'createdAt', event.created_at)::text);
+		return null;
+	end;
+	$fn$ language plpgsql;
+
+	if not exists (select 1 from pg_trigger where tgname = 'users_events') then
+		create trigger users_events
+			after insert or update or delete on users
+			for each row execute function user_events_record();
+	end if;
+end
+$$`
+
+func (p *PostgresStore) UserEventsAfter(ctx context.Context, after int64, limit int) (_ []*types.UserEvent, err error) {
+	ctx, done := p.startQuery(ctx, "UserEventsAfter")
+	defer done(&err)
+
+	rows, err := p.conn(ctx).Query(ctx, stmtUserEventsAfter, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, scanUserEvent)
+}
+
+func (p *PostgresStore) UserEventBounds(ctx context.Context) (oldest, newest int64, err error) {
+	ctx, done := p.startQuery(ctx, "UserEventBounds")
+	defer done(&err)
+
+	err = p.conn(ctx).QueryRow(ctx, annotate(ctx, `select coalesce(min(id), 0), coalesce(max(id), 0) from user_events`),
+		pgx.QueryExecModeExec).Scan(&oldest, &newest)
+	return oldest, newest, err
+}
+
+func (p *PostgresStore) ListenUserEvents(ctx context.Context, ready func(context.Context) error, fn func(*types.UserEvent)) error {
+	conn, err := p.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// LISTEN is connection state, so the connection leaves the pool for good.
+	listener := conn.Hijack()
+	defer listener.Close(context.Background())
+
+	if _, err := listener.Exec(ctx, "listen "+userEventsChannel); err != nil {
+		return err
+	}
+	if err := ready(ctx); err != nil {
+		return err
+	}
+	for {
+		n, err := listener.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		var event types.UserEvent
+		if err := json.Unmarshal([]byte(n.Payload), &event); err != nil {
+			slog.ErrorContext(ctx, "invalid user event notification", "payload", n.Payload, "error", err.Error())
+			continue
+		}
+		fn(&event)
+	}
+}
+
+func (p *PostgresStore) TrimUserEvents(ctx context.Context, keep int) (_ int64, err error) {
+	ctx, done := p.startQuery(ctx, "TrimUserEvents")
+	defer done(&err)
+
+	tag, err := p.pool.Exec(ctx, annotate(ctx, `delete from user_events
+		where id <= (select id from user_events order by id desc offset $1 limit 1)`), pgx.QueryExecModeExec, keep)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// RunUserEventTrim keeps the newest keep user events, trimming the log every
+// interval until ctx is done.
+func RunUserEventTrim(ctx context.Context, s UserEventStore, keep int, interval time.Duration) {
+	logger := slog.Default()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		trimmed, err := s.TrimUserEvents(ctx, keep)
+		if err != nil {
+			logger.ErrorContext(ctx, "error to trim user events", "error", err.Error())
+		} else if trimmed > 0 {
+			logger.InfoContext(ctx, "trimmed user events", "count", trimmed)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func scanUserEvent(row pgx.CollectableRow) (*types.UserEvent, error) {
+	event := &types.UserEvent{User: &types.User{}}
+	err := row.Scan(&event.ID, &event.Type, event.User, &event.CreatedAt)
+	return event, err
+}
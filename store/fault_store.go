@@ -0,0 +1,110 @@
+package store
+
+import (
+	"context"
+	"fiber/fault"
+	"fiber/types"
+)
+
+// FaultStore fails store calls whose context was marked by the fault injection middleware.
+type FaultStore struct {
+	UserStore
+}
+
+func NewFaultStore(next UserStore) *FaultStore {
+	return &FaultStore{
+		UserStore: next,
+	}
+}
+
+func (s *FaultStore) InsertUser(ctx context.Context, user *types.User) (*types.User, error) {
+	if fault.DBFailure(ctx) {
+		return nil, fault.ErrInjectedDBFailure
+	}
+	return s.UserStore.InsertUser(ctx, user)
+}
+
+func (s *FaultStore) DeleteUser(ctx context.Context, id int, version int) (int, error) {
+	if fault.DBFailure(ctx) {
+		return 0, fault.ErrInjectedDBFailure
+	}
+	return s.UserStore.DeleteUser(ctx, id, version)
+}
+
+func (s *FaultStore) GetUsers(ctx context.Context, page types.UserPage) ([]*types.User, error) {
+	if fault.DBFailure(ctx) {
+		return nil, fault.ErrInjectedDBFailure
+	}
+	return s.UserStore.GetUsers(ctx, page)
+}
+
+func (s *FaultStore) GetUserByID(ctx context.Context, id int) (*types.User, error) {
+	if fault.DBFailure(ctx) {
+		return nil, fault.ErrInjectedDBFailure
+	}
+	return s.UserStore.GetUserByID(ctx, id)
+}
+
+func (s *FaultStore) GetUserByIDWithDeleted(ctx context.Context, id int) (*types.User, error) {
+	if fault.DBFailure(ctx) {
+		return nil, fault.ErrInjectedDBFailure
+	}
+	return s.UserStore.GetUserByIDWithDeleted(ctx, id)
+}
+
+func (s *FaultStore) GetUserByEmail(ctx context.Context, email string) (*types.User, error) {
+	if fault.DBFailure(ctx) {
+		return nil, fault.ErrInjectedDBFailure
+	}
+	return s.UserStore.GetUserByEmail(ctx, email)
+}
+
+func (s *FaultStore) UpdateUser(ctx context.Context, id int, querySet map[string]any, version int) (types.User, error) {
+	if fault.DBFailure(ctx) {
+		return types.User{}, fault.ErrInjectedDBFailure
+	}
+	return s.UserStore.UpdateUser(ctx, id, querySet, version)
+}
+
+func (s *FaultStore) RestoreUser(ctx context.Context, id int) (*types.User, error) {
+	if fault.DBFailure(ctx) {
+		return nil, fault.ErrInjectedDBFailure
+	}
+	return s.UserStore.RestoreUser(ctx, id)
+}
+
+func (s *FaultStore) PurgeUser(ctx context.Context, id int, version int) (int, error) {
+	if fault.DBFailure(ctx) {
+		return 0, fault.ErrInjectedDBFailure
+	}
+	return s.UserStore.PurgeUser(ctx, id, version)
+}
+
+func (s *FaultStore) ImportUsers(ctx context.Context, users []*types.User, opts ImportOptions) ([]error, error) {
+	if fault.DBFailure(ctx) {
+		return nil, fault.ErrInjectedDBFailure
+	}
+	importer, err := importerOf(s.UserStore)
+	if err != nil {
+		return nil, err
+	}
+	return importer.ImportUsers(ctx, users, opts)
+}
+
+func (s *FaultStore) ExportUsers(ctx context.Context, fn func(*types.User) error) error {
+	if fault.DBFailure(ctx) {
+		return fault.ErrInjectedDBFailure
+	}
+	importer, err := importerOf(s.UserStore)
+	if err != nil {
+		return err
+	}
+	return importer.ExportUsers(ctx, fn)
+}
+
+func (s *FaultStore) RunInTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if fault.DBFailure(ctx) {
+		return fault.ErrInjectedDBFailure
+	}
+	return runInTx(s.UserStore, ctx, fn)
+}
@@ -0,0 +1,152 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// IdempotencyStore remembers the first response to a request carrying an
+// Idempotency-Key, so retries of that request can be answered with it.
+type IdempotencyStore interface {
+	// BeginIdempotentRequest reserves rec.Key for rec.UserID. When the key is
+	// already in use it reserves nothing and returns the existing record.
+	BeginIdempotentRequest(ctx context.Context, rec *IdempotencyRecord) (*IdempotencyRecord, error)
+	// CompleteIdempotentRequest stores the response of a reserved key.
+	CompleteIdempotentRequest(ctx context.Context, rec *IdempotencyRecord) error
+	// ReleaseIdempotentRequest frees a reserved key whose request failed, so
+	// it can be retried.
+	ReleaseIdempotentRequest(ctx context.Context, userID int, key string) error
+	PurgeExpiredIdempotencyKeys(ctx context.Context, now time.Time) (int64, error)
+}
+
+// IdempotencyRecord is a key reserved by a request. Status is 0 until the
+// request has completed and its response has been stored.
+type IdempotencyRecord struct {
+	UserID      int
+	Key         string
+	RequestHash string
+	Status      int
+	Headers     map[string]string
+	Body        []byte
+	ExpiresAt   time.Time
+}
+
+const idempotencyColumns = "user_id, key, request_hash, coalesce(status, 0), headers, body, expires_at"
+
+const createIdempotencyTable = `create table if not exists idempotency_keys (
+	user_id integer not null,
+	key varchar(255) not null,
+	request_hash varchar(64) not null,
+	status integer,
+	headers jsonb,
+	body bytea,
+	created_at timestamptz not null default now(),
+	expires_at timestamptz not null,
+	primary key (user_id, key)
+)`
+
+func (p *PostgresStore) BeginIdempotentRequest(ctx context.Context, rec *IdempotencyRecord) (_ *IdempotencyRecord, err error) {
+	ctx, done := p.startQuery(ctx, "BeginIdempotentRequest")
+	defer done(&err)
+
+	var existing *IdempotencyRecord
+	err = p.inTx(ctx, func(tx pgx.Tx) error {
+		// An expired key is free to be used again.
+		if _, err := tx.Exec(ctx, stmtFreeIdempotencyKey, rec.UserID, rec.Key); err != nil {
+			return err
+		}
+		tag, err := tx.Exec(ctx, stmtReserveIdempotencyKey, rec.UserID, rec.Key, rec.RequestHash, rec.ExpiresAt)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 1 {
+			return nil
+		}
+		rows, err := tx.Query(ctx, stmtGetIdempotencyKey, rec.UserID, rec.Key)
+		if err != nil {
+			return err
+		}
+		existing, err = pgx.CollectExactlyOneRow(rows, scanIdempotencyRecord)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
+func (p *PostgresStore) CompleteIdempotentRequest(ctx context.Context, rec *IdempotencyRecord) (err error) {
+	ctx, done := p.startQuery(ctx, "CompleteIdempotentRequest")
+	defer done(&err)
+
+	tag, err := p.conn(ctx).Exec(ctx, stmtCompleteIdempotencyKey, rec.UserID, rec.Key, rec.Status, rec.Headers, rec.Body)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errors.New("idempotency key is not reserved")
+	}
+	return nil
+}
+
+func (p *PostgresStore) ReleaseIdempotentRequest(ctx context.Context, userID int, key string) (err error) {
+	ctx, done := p.startQuery(ctx, "ReleaseIdempotentRequest")
+	defer done(&err)
+
+	_, err = p.conn(ctx).Exec(ctx, stmtReleaseIdempotencyKey, userID, key)
+	return err
+}
+
+func (p *PostgresStore) PurgeExpiredIdempotencyKeys(ctx context.Context, now time.Time) (_ int64, err error) {
+	ctx, done := p.startQuery(ctx, "PurgeExpiredIdempotencyKeys")
+	defer done(&err)
+
+	tag, err := p.pool.Exec(ctx, annotate(ctx, `delete from idempotency_keys where expires_at <= $1`), pgx.QueryExecModeExec, now)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func scanIdempotencyRecord(row pgx.CollectableRow) (*IdempotencyRecord, error) {
+	var rec IdempotencyRecord
+	err := row.Scan(
+		&rec.UserID,
+		&rec.Key,
+		&rec.RequestHash,
+		&rec.Status,
+		&rec.Headers,
+		&rec.Body,
+		&rec.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+// RunIdempotencyExpiry deletes expired idempotency keys every interval until
+// ctx is done.
+func RunIdempotencyExpiry(ctx context.Context, s IdempotencyStore, interval time.Duration) {
+	logger := slog.Default()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := s.PurgeExpiredIdempotencyKeys(ctx, time.Now())
+		if err != nil {
+			logger.ErrorContext(ctx, "error to purge expired idempotency keys", "error", err.Error())
+		} else if purged > 0 {
+			logger.InfoContext(ctx, "purged expired idempotency keys", "count", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fiber/tracing"
+	"fiber/types"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// UserImporter writes and reads users in bulk.
+type UserImporter interface {
+	// ImportUsers inserts users and returns the error of each one by index,
+	// nil for those that were inserted. The returned error is only set when
+	// the import as a whole failed.
+	ImportUsers(ctx context.Context, users []*types.User, opts ImportOptions) ([]error, error)
+	// ExportUsers calls fn for every user that is not deleted, in id order,
+	// while reading them from the database.
+	ExportUsers(ctx context.Context, fn func(*types.User) error) error
+}
+
+// BulkUserStore is a UserStore that also imports users and runs transactions.
+// PostgresStore implements it, and so do its decorators when they wrap one.
+type BulkUserStore interface {
+	UserStore
+	UserImporter
+	TxRunner
+}
+
+// importerOf returns next as a UserImporter, for the decorators of a UserStore.
+func importerOf(next UserStore) (UserImporter, error) {
+	importer, ok := next.(UserImporter)
+	if !ok {
+		return nil, fmt.Errorf("%T cannot import users", next)
+	}
+	return importer, nil
+}
+
+type ImportOptions struct {
+	// Atomic imports all users or none of them; otherwise a failing user is
+	// skipped and the others are still imported.
+	Atomic bool
+	// DryRun rolls the import back once every user has been tried.
+	DryRun bool
+}
+
+// importBatchSize is how many users an atomic import sends per round trip.
+const importBatchSize = 100
+
+// errRollback ends an import transaction without failing the import.
+var errRollback = errors.New("rollback")
+
+func (p *PostgresStore) ImportUsers(ctx context.Context, users []*types.User, opts ImportOptions) (_ []error, err error) {
+	ctx, done := p.startQuery(ctx, "ImportUsers")
+	defer done(&err)
+
+	rowErrs := make([]error, len(users))
+	err = p.inTx(ctx, func(tx pgx.Tx) error {
+		if opts.Atomic {
+			for start := 0; start < len(users); start += importBatchSize {
+				failed, err := insertUserBatch(ctx, tx, users[start:min(start+importBatchSize, len(users))])
+				if failed >= 0 {
+					rowErrs[start+failed] = err
+					return errRollback
+				}
+				if err != nil {
+					return err
+				}
+			}
+		} else {
+			for i, user := range users {
+				// Each user gets a savepoint, so a failing one does not abort the others.
+				rowErrs[i] = pgx.BeginFunc(ctx, tx, func(sp pgx.Tx) error {
+					_, err := insertUser(ctx, sp, user)
+					return err
+				})
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+			}
+		}
+		if opts.DryRun {
+			return errRollback
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errRollback) {
+		return nil, err
+	}
+	return rowErrs, nil
+}
+
+// insertUserBatch inserts users, then their audit events, domain events and
+// webhook deliveries, in two round trips. It
+// returns the index of the user that failed, or -1 when the batch itself did.
+func insertUserBatch(ctx context.Context, tx pgx.Tx, users []*types.User) (int, error) {
+	batch := &pgx.Batch{}
+	for _, user := range users {
+		batch.Queue(stmtInsertUser, insertUserArgs(user)...)
+	}
+	results := tx.SendBatch(ctx, batch)
+	inserted := make([]*types.User, len(users))
+	for i := range users {
+		rows, err := results.Query()
+		if err == nil {
+			inserted[i], err = pgx.CollectExactlyOneRow(rows, scanUser)
+		}
+		if err != nil {
+			results.Close()
+			return i, err
+		}
+	}
+	if err := results.Close(); err != nil {
+		return -1, err
+	}
+
+	batch = &pgx.Batch{}
+	for _, user := range inserted {
+		queueAuditEvent(ctx, batch, newAuditEvent(types.AuditUserCreate, user.ID, types.AuditDiff(nil, user)))
+		queueUserChange(ctx, batch, types.UserCreated{User: user}, user)
+	}
+	return -1, tx.SendBatch(ctx, batch).Close()
+}
+
+func (p *PostgresStore) ExportUsers(ctx context.Context, fn func(*types.User) error) (err error) {
+	// No query timeout: the export runs for as long as the client reads it.
+	ctx, span := tracing.Start(ctx, "store.ExportUsers",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBOperationName("ExportUsers"),
+		))
+	defer tracing.End(span, &err)
+
+	rows, err := p.pool.Query(ctx, stmtGetUsers, 0, nil, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(user); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,188 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fiber/types"
+	"log/slog"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// InstrumentedStore records latency, errors and returned rows of every call to
+// the wrapped UserStore, and logs calls slower than the configured threshold.
+type InstrumentedStore struct {
+	UserStore
+
+	latency       *prometheus.HistogramVec
+	errors        *prometheus.CounterVec
+	rows          *prometheus.HistogramVec
+	slowThreshold time.Duration
+	logger        *slog.Logger
+}
+
+func NewInstrumentedStore(next UserStore, reg prometheus.Registerer, slowThreshold time.Duration) *InstrumentedStore {
+	latency := prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "store_query_duration_seconds",
+			Help:    "Store call latency in seconds",
+			Buckets: []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1},
+		},
+		[]string{"method"})
+
+	errs := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "store_query_errors_total",
+			Help: "Total number of failed store calls, not counting missing rows",
+		},
+		[]string{"method"})
+
+	rows := prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "store_query_rows",
+			Help:    "Number of rows returned or affected by a store call",
+			Buckets: prometheus.ExponentialBuckets(1, 4, 6),
+		},
+		[]string{"method"})
+
+	reg.MustRegister(latency, errs, rows)
+
+	return &InstrumentedStore{
+		UserStore:     next,
+		latency:       latency,
+		errors:        errs,
+		rows:          rows,
+		slowThreshold: slowThreshold,
+		logger:        slog.Default(),
+	}
+}
+
+func (s *InstrumentedStore) observe(ctx context.Context, method string, start time.Time, rows int, err error) {
+	elapsed := time.Since(start)
+	s.latency.WithLabelValues(method).Observe(elapsed.Seconds())
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		s.errors.WithLabelValues(method).Inc()
+	}
+	s.rows.WithLabelValues(method).Observe(float64(rows))
+	if s.slowThreshold > 0 && elapsed >= s.slowThreshold {
+		s.logger.WarnContext(ctx, "slow store call", "method", method, "duration", elapsed, "rows", rows)
+	}
+}
+
+func rowCount(err error) int {
+	if err != nil {
+		return 0
+	}
+	return 1
+}
+
+func (s *InstrumentedStore) InsertUser(ctx context.Context, user *types.User) (*types.User, error) {
+	start := time.Now()
+	res, err := s.UserStore.InsertUser(ctx, user)
+	s.observe(ctx, "InsertUser", start, rowCount(err), err)
+	return res, err
+}
+
+func (s *InstrumentedStore) DeleteUser(ctx context.Context, id int, version int) (int, error) {
+	start := time.Now()
+	res, err := s.UserStore.DeleteUser(ctx, id, version)
+	s.observe(ctx, "DeleteUser", start, rowCount(err), err)
+	return res, err
+}
+
+func (s *InstrumentedStore) GetUsers(ctx context.Context, page types.UserPage) ([]*types.User, error) {
+	start := time.Now()
+	res, err := s.UserStore.GetUsers(ctx, page)
+	s.observe(ctx, "GetUsers", start, len(res), err)
+	return res, err
+}
+
+func (s *InstrumentedStore) GetUserByID(ctx context.Context, id int) (*types.User, error) {
+	start := time.Now()
+	res, err := s.UserStore.GetUserByID(ctx, id)
+	s.observe(ctx, "GetUserByID", start, rowCount(err), err)
+	return res, err
+}
+
+func (s *InstrumentedStore) GetUserByIDWithDeleted(ctx context.Context, id int) (*types.User, error) {
+	start := time.Now()
+	res, err := s.UserStore.GetUserByIDWithDeleted(ctx, id)
+	s.observe(ctx, "GetUserByIDWithDeleted", start, rowCount(err), err)
+	return res, err
+}
+
+func (s *InstrumentedStore) GetUserByEmail(ctx context.Context, email string) (*types.User, error) {
+	start := time.Now()
+	res, err := s.UserStore.GetUserByEmail(ctx, email)
+	s.observe(ctx, "GetUserByEmail", start, rowCount(err), err)
+	return res, err
+}
+
+func (s *InstrumentedStore) UpdateUser(ctx context.Context, id int, querySet map[string]any, version int) (types.User, error) {
+	start := time.Now()
+	res, err := s.UserStore.UpdateUser(ctx, id, querySet, version)
+	s.observe(ctx, "UpdateUser", start, rowCount(err), err)
+	return res, err
+}
+
+func (s *InstrumentedStore) RestoreUser(ctx context.Context, id int) (*types.User, error) {
+	start := time.Now()
+	res, err := s.UserStore.RestoreUser(ctx, id)
+	s.observe(ctx, "RestoreUser", start, rowCount(err), err)
+	return res, err
+}
+
+func (s *InstrumentedStore) PurgeUser(ctx context.Context, id int, version int) (int, error) {
+	start := time.Now()
+	res, err := s.UserStore.PurgeUser(ctx, id, version)
+	s.observe(ctx, "PurgeUser", start, rowCount(err), err)
+	return res, err
+}
+
+func (s *InstrumentedStore) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	start := time.Now()
+	res, err := s.UserStore.PurgeDeletedUsers(ctx, deletedBefore)
+	s.observe(ctx, "PurgeDeletedUsers", start, int(res), err)
+	return res, err
+}
+
+func (s *InstrumentedStore) ImportUsers(ctx context.Context, users []*types.User, opts ImportOptions) ([]error, error) {
+	start := time.Now()
+	importer, err := importerOf(s.UserStore)
+	if err != nil {
+		return nil, err
+	}
+	rowErrs, err := importer.ImportUsers(ctx, users, opts)
+	imported := 0
+	if err == nil {
+		for _, rowErr := range rowErrs {
+			if rowErr == nil {
+				imported++
+			}
+		}
+	}
+	s.observe(ctx, "ImportUsers", start, imported, err)
+	return rowErrs, err
+}
+
+func (s *InstrumentedStore) ExportUsers(ctx context.Context, fn func(*types.User) error) error {
+	start := time.Now()
+	importer, err := importerOf(s.UserStore)
+	if err != nil {
+		return err
+	}
+	exported := 0
+	err = importer.ExportUsers(ctx, func(user *types.User) error {
+		exported++
+		return fn(user)
+	})
+	s.observe(ctx, "ExportUsers", start, exported, err)
+	return err
+}
+
+// RunInTx is not observed itself; the calls made in the transaction are.
+func (s *InstrumentedStore) RunInTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return runInTx(s.UserStore, ctx, fn)
+}
@@ -0,0 +1,55 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fiber/types"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type fakeStore struct {
+	UserStore
+	users map[int]*types.User
+}
+
+func (f *fakeStore) GetUserByID(_ context.Context, id int) (*types.User, error) {
+	user, ok := f.users[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return user, nil
+}
+
+func (f *fakeStore) GetUsers(context.Context, types.UserPage) ([]*types.User, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestInstrumentedStore(t *testing.T) {
+	fake := &fakeStore{users: map[int]*types.User{1: {ID: 1}}}
+	s := NewInstrumentedStore(fake, prometheus.NewRegistry(), time.Second)
+
+	if _, err := s.GetUserByID(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetUserByID(context.Background(), 2); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected sql.ErrNoRows but got %v", err)
+	}
+	if _, err := s.GetUsers(context.Background(), types.UserPage{}); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if got := testutil.CollectAndCount(s.latency); got != 2 {
+		t.Errorf("expected latency for 2 methods but got %d", got)
+	}
+	if got := testutil.ToFloat64(s.errors.WithLabelValues("GetUserByID")); got != 0 {
+		t.Errorf("expected missing rows not to count as errors but got %v", got)
+	}
+	if got := testutil.ToFloat64(s.errors.WithLabelValues("GetUsers")); got != 1 {
+		t.Errorf("expected 1 GetUsers error but got %v", got)
+	}
+}
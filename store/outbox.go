@@ -0,0 +1,117 @@
+package store
+
+import (
+	"context"
+	"fiber/requestid"
+	"fiber/types"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// OutboxStore is what the outbox relay reads domain events from.
+type OutboxStore interface {
+	// PendingDomainEvents returns up to limit events after the one with ID
+	// after that were not published yet, in ID order.
+	PendingDomainEvents(ctx context.Context, after int64, limit int) ([]*types.DomainEvent, error)
+	// DeleteDomainEvents removes published events from the outbox.
+	DeleteDomainEvents(ctx context.Context, ids []int64) error
+	// WithOutboxLock runs fn unless another relay, possibly on another replica,
+	// holds the outbox lock, and reports whether fn ran. Only one relay
+	// publishing at a time keeps the events of a user in order.
+	WithOutboxLock(ctx context.Context, fn func(context.Context) error) (bool, error)
+}
+
+const domainEventColumns = "id, type, user_id, payload, request_id, occurred_at"
+
+const createOutboxTable = `create table if not exists outbox (
+	id bigserial primary key,
+	type varchar(50) not null,
+	user_id integer not null,
+	payload jsonb not null,
+	request_id varchar(128),
+	occurred_at timestamptz not null default now()
+)`
+
+// outboxLockKey is the advisory lock held by the publishing relay ("outbox" in ASCII).
+const outboxLockKey int64 = 0x6f7574626f78
+
+// insertDomainEvent writes payload to the outbox with q, the transaction of
+// the change it describes.
+func insertDomainEvent(ctx context.Context, q querier, payload types.DomainPayload) error {
+	_, err := q.Exec(ctx, stmtInsertDomainEvent, domainEventArgs(ctx, payload)...)
+	return err
+}
+
+// queueDomainEvent is insertDomainEvent for a batch.
+func queueDomainEvent(ctx context.Context, batch *pgx.Batch, payload types.DomainPayload) {
+	batch.Queue(stmtInsertDomainEvent, domainEventArgs(ctx, payload)...)
+}
+
+func domainEventArgs(ctx context.Context, payload types.DomainPayload) []any {
+	var requestID *string
+	if id := requestid.FromContext(ctx); id != "" {
+		requestID = &id
+	}
+	return []any{payload.EventType(), payload.EventUserID(), payload, requestID}
+}
+
+func (p *PostgresStore) PendingDomainEvents(ctx context.Context, after int64, limit int) (_ []*types.DomainEvent, err error) {
+	ctx, done := p.startQuery(ctx, "PendingDomainEvents")
+	defer done(&err)
+
+	rows, err := p.pool.Query(ctx, stmtPendingDomainEvents, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, scanDomainEvent)
+}
+
+func (p *PostgresStore) DeleteDomainEvents(ctx context.Context, ids []int64) (err error) {
+	ctx, done := p.startQuery(ctx, "DeleteDomainEvents")
+	defer done(&err)
+
+	_, err = p.pool.Exec(ctx, stmtDeleteDomainEvents, ids)
+	return err
+}
+
+func (p *PostgresStore) WithOutboxLock(ctx context.Context, fn func(context.Context) error) (bool, error) {
+	// Advisory locks belong to a session, so one connection is kept for as
+	// long as the lock is held.
+	conn, err := p.pool.Acquire(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Release()
+
+	var locked bool
+	if err := conn.QueryRow(ctx, "select pg_try_advisory_lock($1)", outboxLockKey).Scan(&locked); err != nil {
+		return false, err
+	}
+	if !locked {
+		return false, nil
+	}
+	defer func() {
+		if _, err := conn.Exec(context.Background(), "select pg_advisory_unlock($1)", outboxLockKey); err != nil {
+			// Closing the session is the other way to release the lock.
+			conn.Conn().Close(context.Background())
+		}
+	}()
+	return true, fn(ctx)
+}
+
+func scanDomainEvent(row pgx.CollectableRow) (*types.DomainEvent, error) {
+	event := &types.DomainEvent{}
+	var requestID *string
+	err := row.Scan(
+		&event.ID,
+		&event.Type,
+		&event.UserID,
+		&event.Payload,
+		&requestID,
+		&event.OccurredAt)
+	if err != nil {
+		return nil, err
+	}
+	event.RequestID = deref(requestID)
+	return event, nil
+}
@@ -0,0 +1,41 @@
+package store
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// queryLogger is a pgx.QueryTracer that logs every statement with the context
+// of the call, so the log handler attaches the request ID. It correlates
+// prepared statements, which are executed by name and cannot carry the
+// annotate comment.
+type queryLogger struct {
+	logger *slog.Logger
+}
+
+type queryStartKey struct{}
+
+type queryStart struct {
+	sql   string
+	start time.Time
+}
+
+func (l queryLogger) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	return context.WithValue(ctx, queryStartKey{}, queryStart{sql: data.SQL, start: time.Now()})
+}
+
+func (l queryLogger) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	q, ok := ctx.Value(queryStartKey{}).(queryStart)
+	if !ok {
+		return
+	}
+	args := []any{"statement", q.sql, "duration", time.Since(q.start), "rows", data.CommandTag.RowsAffected()}
+	if data.Err != nil {
+		l.logger.WarnContext(ctx, "postgres statement failed", append(args, "error", data.Err.Error())...)
+		return
+	}
+	l.logger.InfoContext(ctx, "postgres statement", args...)
+}
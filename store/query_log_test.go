@@ -0,0 +1,31 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestQueryLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := queryLogger{logger: slog.New(slog.NewTextHandler(&buf, nil))}
+
+	ctx := l.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: stmtGetUserByID})
+	l.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{CommandTag: pgconn.NewCommandTag("SELECT 1")})
+	if out := buf.String(); !strings.Contains(out, "statement="+stmtGetUserByID) || !strings.Contains(out, "rows=1") {
+		t.Errorf("expected the statement name and rows to be logged, got %q", out)
+	}
+
+	buf.Reset()
+	ctx = l.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: stmtGetUserByID})
+	l.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{Err: errors.New("boom")})
+	if out := buf.String(); !strings.Contains(out, "level=WARN") || !strings.Contains(out, "error=boom") {
+		t.Errorf("expected the failure to be logged as a warning, got %q", out)
+	}
+}
@@ -0,0 +1,30 @@
+package store
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// RunRetention purges users that were soft-deleted more than retention ago,
+// checking every interval until ctx is done.
+func RunRetention(ctx context.Context, s UserStore, retention, interval time.Duration) {
+	logger := slog.Default()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := s.PurgeDeletedUsers(ctx, time.Now().Add(-retention))
+		if err != nil {
+			logger.ErrorContext(ctx, "error to purge deleted users", "error", err.Error())
+		} else if purged > 0 {
+			logger.InfoContext(ctx, "purged deleted users", "count", purged, "retention", retention)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type purgeFunc func(ctx context.Context, before time.Time) (int64, error)
+
+type purgeStore struct {
+	UserStore
+	purge purgeFunc
+}
+
+func (s purgeStore) PurgeDeletedUsers(ctx context.Context, before time.Time) (int64, error) {
+	return s.purge(ctx, before)
+}
+
+func TestRunRetention(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cutoffs := make(chan time.Time, 3)
+	calls := 0
+	s := purgeStore{purge: func(_ context.Context, before time.Time) (int64, error) {
+		calls++
+		cutoffs <- before
+		if calls == 3 {
+			cancel()
+		}
+		if calls == 1 {
+			// A failed run must not stop the loop.
+			return 0, errors.New("connection refused")
+		}
+		return 1, nil
+	}}
+
+	done := make(chan struct{})
+	go func() {
+		RunRetention(ctx, s, time.Hour, time.Millisecond)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("RunRetention did not return after the context was cancelled")
+	}
+
+	if calls != 3 {
+		t.Fatalf("expected 3 purges got %d", calls)
+	}
+	for i := 0; i < 3; i++ {
+		before := <-cutoffs
+		if age := time.Since(before); age < time.Hour || age > time.Hour+time.Minute {
+			t.Errorf("expected the cutoff to be an hour ago, got %v", age)
+		}
+	}
+}
@@ -3,223 +3,613 @@ package store
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fiber/requestid"
+	"fiber/tracing"
 	"fiber/types"
 	"fmt"
+	"log/slog"
+	"sort"
 	"strings"
+	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Dropper interface {
 	DropTable(name string) error
 }
 
+// ErrVersionMismatch is returned by mutations whose expected version is not the
+// current version of the user.
+var ErrVersionMismatch = errors.New("user version mismatch")
+
+// UserStore returns sql.ErrNoRows (possibly wrapped) when a user does not exist.
+// Mutations taking a version only apply when it matches the user's current
+// version, or unconditionally when it is 0.
 type UserStore interface {
 	Dropper
 
 	InsertUser(context.Context, *types.User) (*types.User, error)
-	DeleteUser(context.Context, int) (int, error)
-	GetUsers(context.Context) ([]*types.User, error)
+	DeleteUser(ctx context.Context, id int, version int) (int, error)
+	GetUsers(context.Context, types.UserPage) ([]*types.User, error)
 	GetUserByID(context.Context, int) (*types.User, error)
 	GetUserByEmail(context.Context, string) (*types.User, error)
-	UpdateUser(context.Context, int, map[string]any) (types.User, error)
+	UpdateUser(ctx context.Context, id int, querySet map[string]any, version int) (types.User, error)
+
+	// DeleteUser only marks a user as deleted; RestoreUser undoes it and
+	// PurgeUser removes the row for good, deleted or not.
+	RestoreUser(context.Context, int) (*types.User, error)
+	PurgeUser(ctx context.Context, id int, version int) (int, error)
+	// GetUserByIDWithDeleted is GetUserByID including soft-deleted users.
+	GetUserByIDWithDeleted(context.Context, int) (*types.User, error)
+	PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) (int64, error)
+}
+
+// updatableColumns are the only columns UpdateUser writes; other keys are rejected.
+var updatableColumns = map[string]bool{
+	"first_name": true,
+	"last_name":  true,
+	"email":      true,
+}
+
+// userColumns is the column list every user query selects, in the order scanUser reads them.
+const userColumns = "id, first_name, last_name, email, pass, admin, created_at, deleted_at, version"
+
+// Prepared statements, registered on every new pool connection by name.
+const (
+	stmtGetUsers       = "get_users"
+	stmtGetUserByID    = "get_user_by_id"
+	stmtGetAnyUserByID = "get_any_user_by_id"
+	stmtGetUserByEmail = "get_user_by_email"
+	stmtInsertUser     = "insert_user"
+	stmtDeleteUser     = "delete_user"
+	stmtRestoreUser    = "restore_user"
+	stmtPurgeUser      = "purge_user"
+	stmtLockUser       = "lock_user"
+
+	stmtInsertAuditEvent = "insert_audit_event"
+
+	stmtFreeIdempotencyKey     = "free_idempotency_key"
+	stmtReserveIdempotencyKey  = "reserve_idempotency_key"
+	stmtGetIdempotencyKey      = "get_idempotency_key"
+	stmtCompleteIdempotencyKey = "complete_idempotency_key"
+	stmtReleaseIdempotencyKey  = "release_idempotency_key"
+
+	stmtUserEventsAfter = "user_events_after"
+
+	stmtEnqueueWebhooks        = "enqueue_webhooks"
+	stmtInsertWebhook          = "insert_webhook"
+	stmtGetWebhookByID         = "get_webhook_by_id"
+	stmtUpdateWebhook          = "update_webhook"
+	stmtDeleteWebhook          = "delete_webhook"
+	stmtRedeliverWebhook       = "redeliver_webhook"
+	stmtClaimWebhookDeliveries = "claim_webhook_deliveries"
+	stmtRecordWebhookAttempt   = "record_webhook_attempt"
+
+	stmtInsertDomainEvent   = "insert_domain_event"
+	stmtPendingDomainEvents = "pending_domain_events"
+	stmtDeleteDomainEvents  = "delete_domain_events"
+)
+
+var preparedStatements = map[string]string{
+	// NULL filters match every user.
+	stmtGetUsers: `select ` + userColumns + ` from users where deleted_at is null and id > $1
+		and ($3::text is null or email = $3)
+		and ($4::text is null or first_name ilike $4 or last_name ilike $4)
+		and ($5::boolean is null or admin = $5)
+		order by id limit $2`,
+	stmtGetUserByID:    `select ` + userColumns + ` from users where id=$1 and deleted_at is null`,
+	stmtGetAnyUserByID: `select ` + userColumns + ` from users where id=$1`,
+	stmtGetUserByEmail: `select ` + userColumns + ` from users where email=$1 and deleted_at is null`,
+	stmtInsertUser: `insert into users
+		(first_name, last_name, email, pass, admin, created_at)
+		values($1, $2, $3, $4, $5, $6)
+		RETURNING ` + userColumns,
+	stmtDeleteUser: `UPDATE users SET deleted_at=now(), version=version+1 WHERE id=$1 AND deleted_at IS NULL
+		RETURNING ` + userColumns,
+	stmtRestoreUser: `UPDATE users SET deleted_at=NULL, version=version+1 WHERE id=$1 AND deleted_at IS NOT NULL
+		RETURNING ` + userColumns,
+	stmtPurgeUser: `DELETE FROM users WHERE id=$1 RETURNING ` + userColumns,
+	stmtLockUser:  `select ` + userColumns + ` from users where id=$1 for update`,
+
+	stmtInsertAuditEvent: `insert into audit_events
+		(actor_id, action, target_type, target_id, changes, details, ip, user_agent, request_id)
+		values($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id, created_at`,
+
+	stmtFreeIdempotencyKey: `delete from idempotency_keys where user_id=$1 and key=$2 and expires_at <= now()`,
+	stmtReserveIdempotencyKey: `insert into idempotency_keys (user_id, key, request_hash, expires_at)
+		values($1, $2, $3, $4) on conflict do nothing`,
+	stmtGetIdempotencyKey: `select ` + idempotencyColumns + ` from idempotency_keys where user_id=$1 and key=$2`,
+	stmtCompleteIdempotencyKey: `update idempotency_keys set status=$3, headers=$4, body=$5
+		where user_id=$1 and key=$2 and status is null`,
+	stmtReleaseIdempotencyKey: `delete from idempotency_keys where user_id=$1 and key=$2 and status is null`,
+
+	stmtUserEventsAfter: `select id, type, payload, created_at from user_events where id > $1 order by id limit $2`,
+
+	stmtEnqueueWebhooks: `insert into webhook_deliveries (webhook_id, event, payload)
+		select id, $1::text, $2::jsonb from webhooks where active and $1::text = any(events)`,
+	stmtInsertWebhook: `insert into webhooks (url, events, secret, active) values($1, $2, $3, $4)
+		RETURNING ` + webhookColumns,
+	stmtGetWebhookByID: `select ` + webhookColumns + ` from webhooks where id=$1`,
+	stmtUpdateWebhook: `update webhooks set url=$2, events=$3, secret=$4, active=$5 where id=$1
+		RETURNING ` + webhookColumns,
+	stmtDeleteWebhook: `delete from webhooks where id=$1`,
+	stmtRedeliverWebhook: `update webhook_deliveries d set status='pending', attempts=0, next_attempt_at=now()
+		where d.id=$1 and d.status <> 'pending'
+		RETURNING ` + webhookDeliveryColumns,
+	// Claimed deliveries are pushed back by the lease; skip locked lets several
+	// workers claim at once without sending the same delivery twice. The
+	// deliveries of inactive webhooks wait until it is activated again.
+	stmtClaimWebhookDeliveries: `with due as (
+			select d.id from webhook_deliveries d join webhooks w on w.id=d.webhook_id
+			where d.status='pending' and d.next_attempt_at <= now() and w.active
+			order by d.id limit $1 for update of d skip locked
+		)
+		update webhook_deliveries d set attempts=d.attempts+1, next_attempt_at=now()+$2::interval
+		from due, webhooks w where d.id=due.id and w.id=d.webhook_id
+		RETURNING ` + webhookDeliveryColumns + `, w.url, w.secret`,
+	stmtRecordWebhookAttempt: `update webhook_deliveries set status=$2::text, last_status_code=$3, last_error=$4,
+		next_attempt_at=$5, delivered_at=case when $2::text='delivered' then now() end
+		where id=$1`,
+
+	stmtInsertDomainEvent:   `insert into outbox (type, user_id, payload, request_id) values($1, $2, $3, $4)`,
+	stmtPendingDomainEvents: `select ` + domainEventColumns + ` from outbox where id > $1 order by id limit $2`,
+	stmtDeleteDomainEvents:  `delete from outbox where id = any($1)`,
+}
+
+type PoolConfig struct {
+	MaxOpenConns int
+	// MinIdleConns is how many idle connections the pool keeps warm. Idle
+	// connections above it are closed once they exceed ConnMaxIdleTime.
+	MinIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+	// HealthCheckPeriod is how often idle connections are checked and replaced.
+	HealthCheckPeriod time.Duration
+	// QueryTimeout bounds every store call whose context has no earlier deadline.
+	QueryTimeout time.Duration
+	// ConnectRetries is how many times a failed startup ping is retried,
+	// doubling RetryBackoff after each attempt.
+	ConnectRetries int
+	RetryBackoff   time.Duration
+	// LogStatements logs every statement with the request context, which is how
+	// prepared statements are correlated with a request.
+	LogStatements bool
+}
+
+func DefaultPoolConfig() PoolConfig {
+	return PoolConfig{
+		MaxOpenConns:      25,
+		MinIdleConns:      5,
+		ConnMaxLifetime:   30 * time.Minute,
+		ConnMaxIdleTime:   5 * time.Minute,
+		HealthCheckPeriod: time.Minute,
+		QueryTimeout:      5 * time.Second,
+		ConnectRetries:    5,
+		RetryBackoff:      500 * time.Millisecond,
+	}
 }
 
 type PostgresStore struct {
-	db *sql.DB
+	pool         *pgxpool.Pool
+	queryTimeout time.Duration
 }
 
-func NewPostgresStore(connStr string) (*PostgresStore, error) {
-	db, err := sql.Open("postgres", connStr)
+func NewPostgresStore(connStr string, cfg PoolConfig) (*PostgresStore, error) {
+	poolConfig, err := pgxpool.ParseConfig(connStr)
 	if err != nil {
 		return nil, err
-		//log.Fatal("error to connect to Posgres database", err)
+	}
+	poolConfig.MaxConns = int32(cfg.MaxOpenConns)
+	poolConfig.MinIdleConns = int32(cfg.MinIdleConns)
+	poolConfig.MaxConnLifetime = cfg.ConnMaxLifetime
+	poolConfig.MaxConnIdleTime = cfg.ConnMaxIdleTime
+	if cfg.HealthCheckPeriod > 0 {
+		poolConfig.HealthCheckPeriod = cfg.HealthCheckPeriod
+	}
+	poolConfig.AfterConnect = prepareStatements
+	if cfg.LogStatements {
+		poolConfig.ConnConfig.Tracer = queryLogger{logger: slog.Default()}
 	}
 
-	if err := db.Ping(); err != nil {
+	pool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
+	if err != nil {
 		return nil, err
 	}
 
-	return &PostgresStore{
-		db: db,
-	}, nil
-}
-
-func (p *PostgresStore) GetUsers(ctx context.Context) ([]*types.User, error) {
-	rows, err := p.db.Query("select * from users")
-	if err != nil {
+	if err := pingWithRetry(pool.Ping, cfg, time.Sleep); err != nil {
+		pool.Close()
 		return nil, err
 	}
-	defer rows.Close()
 
-	users := []*types.User{}
-	for rows.Next() {
-		user := new(types.User)
-		err := rows.Scan(
-			&user.ID,
-			&user.FirstName,
-			&user.LastName,
-			&user.Email,
-			&user.EncryptedPassword,
-			&user.IsAdmin,
-			&user.CreatedAt)
+	return &PostgresStore{
+		pool:         pool,
+		queryTimeout: cfg.QueryTimeout,
+	}, nil
+}
 
-		if err != nil {
-			return nil, err
+// prepareStatements runs for every new connection. Before Init has created the
+// tables preparing fails, which is tolerated: Init resets the pool afterwards.
+// A failing statement does not keep the others from being prepared.
+func prepareStatements(ctx context.Context, conn *pgx.Conn) error {
+	for name, query := range preparedStatements {
+		if _, err := conn.Prepare(ctx, name, query); err != nil {
+			slog.WarnContext(ctx, "error to prepare statement", "statement", name, "error", err.Error())
 		}
-
-		users = append(users, user)
 	}
+	return nil
+}
 
-	if len(users) == 0 {
-		return nil, sql.ErrNoRows
+// pingWithRetry calls ping until it succeeds or cfg.ConnectRetries retries
+// failed, sleeping between attempts.
+func pingWithRetry(ping func(context.Context) error, cfg PoolConfig, sleep func(time.Duration)) error {
+	backoff := cfg.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err := ping(ctx)
+		cancel()
+		if err == nil || attempt >= cfg.ConnectRetries {
+			return err
+		}
+		slog.Warn("postgres is not reachable yet, retrying", "attempt", attempt+1, "backoff", backoff, "error", err.Error())
+		sleep(backoff)
+		backoff *= 2
 	}
-
-	return users, nil
-
 }
 
-func (p *PostgresStore) GetUserByEmail(ctx context.Context, email string) (*types.User, error) {
-	rows, err := p.db.QueryContext(ctx, "select * from users where email=$1", email)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
+func (p *PostgresStore) Close() error {
+	p.pool.Close()
+	return nil
+}
 
-	if !rows.Next() {
-		return nil, sql.ErrNoRows
-	}
+// Ping checks that the database answers.
+func (p *PostgresStore) Ping(ctx context.Context) error {
+	return p.pool.Ping(ctx)
+}
 
+// scanUser reads a row selected with userColumns.
+func scanUser(row pgx.CollectableRow) (*types.User, error) {
 	user := &types.User{}
-	if err := rows.Scan(
+	err := row.Scan(
 		&user.ID,
 		&user.FirstName,
 		&user.LastName,
 		&user.Email,
 		&user.EncryptedPassword,
 		&user.IsAdmin,
-		&user.CreatedAt); err != nil {
+		&user.CreatedAt,
+		&user.DeletedAt,
+		&user.Version)
+	if err != nil {
 		return nil, err
 	}
 	return user, nil
 }
 
-func (p *PostgresStore) GetUserByID(ctx context.Context, id int) (*types.User, error) {
-	rows, err := p.db.QueryContext(ctx, "select * from users where id=$1", id)
+// querier is satisfied by both the pool and a transaction.
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+func queryUser(ctx context.Context, q querier, stmt string, args ...any) (*types.User, error) {
+	rows, err := q.Query(ctx, stmt, args...)
 	if err != nil {
-		fmt.Println("DB", err)
 		return nil, err
 	}
-	defer rows.Close()
+	return pgx.CollectExactlyOneRow(rows, scanUser)
+}
 
-	if !rows.Next() {
-		return nil, sql.ErrNoRows
+// inTx runs fn in a transaction that is committed when fn returns nil. Inside
+// a transaction started by RunInTx, fn gets a savepoint of it instead.
+func (p *PostgresStore) inTx(ctx context.Context, fn func(pgx.Tx) error) error {
+	if tx, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return pgx.BeginFunc(ctx, tx, fn)
 	}
+	return pgx.BeginFunc(ctx, p.pool, fn)
+}
 
-	user := &types.User{}
-	//rows.Next()
-	if err := rows.Scan(
-		&user.ID,
-		&user.FirstName,
-		&user.LastName,
-		&user.Email,
-		&user.EncryptedPassword,
-		&user.IsAdmin,
-		&user.CreatedAt); err != nil {
+// likeEscaper escapes the wildcards of a LIKE pattern.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+func (p *PostgresStore) GetUsers(ctx context.Context, page types.UserPage) (_ []*types.User, err error) {
+	ctx, done := p.startQuery(ctx, "GetUsers")
+	defer done(&err)
 
+	// A NULL limit is no limit.
+	var limit *int
+	if page.Limit > 0 {
+		limit = &page.Limit
+	}
+	var email, name *string
+	if page.Email != "" {
+		email = &page.Email
+	}
+	if page.Name != "" {
+		pattern := "%" + likeEscaper.Replace(page.Name) + "%"
+		name = &pattern
+	}
+	rows, err := p.conn(ctx).Query(ctx, stmtGetUsers, page.After, limit, email, name, page.IsAdmin)
+	if err != nil {
+		return nil, err
+	}
+	users, err := pgx.CollectRows(rows, scanUser)
+	if err != nil {
 		return nil, err
+	}
 
+	if len(users) == 0 {
+		return nil, sql.ErrNoRows
 	}
-	//}
 
+	return users, nil
+}
+
+func (p *PostgresStore) GetUserByEmail(ctx context.Context, email string) (_ *types.User, err error) {
+	ctx, done := p.startQuery(ctx, "GetUserByEmail")
+	defer done(&err)
+
+	return queryUser(ctx, p.conn(ctx), stmtGetUserByEmail, email)
+}
+
+func (p *PostgresStore) GetUserByID(ctx context.Context, id int) (_ *types.User, err error) {
+	ctx, done := p.startQuery(ctx, "GetUserByID")
+	defer done(&err)
+
+	return queryUser(ctx, p.conn(ctx), stmtGetUserByID, id)
+}
+
+func (p *PostgresStore) GetUserByIDWithDeleted(ctx context.Context, id int) (_ *types.User, err error) {
+	ctx, done := p.startQuery(ctx, "GetUserByIDWithDeleted")
+	defer done(&err)
+
+	return queryUser(ctx, p.conn(ctx), stmtGetAnyUserByID, id)
+}
+
+// lockUser locks the row of a user that is not deleted and checks its version.
+func lockUser(ctx context.Context, tx pgx.Tx, id int, version int) (*types.User, error) {
+	user, err := queryUser(ctx, tx, stmtLockUser, id)
+	if err != nil {
+		return nil, err
+	}
+	if user.DeletedAt != nil {
+		return nil, sql.ErrNoRows
+	}
+	if version != 0 && user.Version != version {
+		return nil, ErrVersionMismatch
+	}
 	return user, nil
 }
 
-func (p *PostgresStore) DeleteUser(ctx context.Context, id int) (int, error) {
-	query := `DELETE FROM users WHERE id=$1 RETURNING id`
-	var deletedID int
-	err := p.db.QueryRowContext(ctx, query, id).Scan(&deletedID)
+func (p *PostgresStore) DeleteUser(ctx context.Context, id int, version int) (_ int, err error) {
+	ctx, done := p.startQuery(ctx, "DeleteUser")
+	defer done(&err)
 
+	err = p.inTx(ctx, func(tx pgx.Tx) error {
+		if _, err := lockUser(ctx, tx, id, version); err != nil {
+			return err
+		}
+		deleted, err := queryUser(ctx, tx, stmtDeleteUser, id)
+		if err != nil {
+			return err
+		}
+		before := *deleted
+		before.DeletedAt = nil
+		if err := insertAuditEvent(ctx, tx, newAuditEvent(types.AuditUserDelete, id, types.AuditDiff(&before, deleted))); err != nil {
+			return err
+		}
+		return recordUserChange(ctx, tx, types.UserDeleted{UserID: id}, deleted)
+	})
 	if err != nil {
-		fmt.Println("no rows found")
-		return 0, sql.ErrNoRows
+		return 0, err
 	}
 
-	return deletedID, nil
+	return id, nil
 }
 
-func (p *PostgresStore) UpdateUser(ctx context.Context, id int, querySet map[string]any) (types.User, error) {
+func (p *PostgresStore) UpdateUser(ctx context.Context, id int, querySet map[string]any, version int) (_ types.User, err error) {
+	ctx, done := p.startQuery(ctx, "UpdateUser")
+	defer done(&err)
+
+	if len(querySet) == 0 {
+		return types.User{}, errors.New("no columns to update")
+	}
+	keys := make([]string, 0, len(querySet))
+	for k := range querySet {
+		if !updatableColumns[k] {
+			return types.User{}, fmt.Errorf("column %q cannot be updated", k)
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
 
 	setClauses := []string{}
-	args := []any{}
+	// The annotated SQL differs per request, so it must not enter the
+	// connection's statement cache.
+	args := []any{pgx.QueryExecModeExec}
 	argPos := 1
 
-	for k, v := range querySet {
-		setClauses = append(setClauses, fmt.Sprintf("%s = $%d", k, argPos))
-		args = append(args, v)
+	for _, k := range keys {
+		setClauses = append(setClauses, fmt.Sprintf("%s = $%d", pgx.Identifier{k}.Sanitize(), argPos))
+		args = append(args, querySet[k])
 		argPos++
 	}
 
 	args = append(args, id)
 
 	query := fmt.Sprintf(`
-	Update users 
-	SET %s
-	WHERE id=$%d 
-	RETURNING id, first_name, last_name, email, admin, created_at
-	`, strings.Join(setClauses, ", "), argPos)
-
-	updUser := types.User{}
-	err := p.db.QueryRowContext(ctx, query, args...).Scan(
-		&updUser.ID,
-		&updUser.FirstName,
-		&updUser.LastName,
-		&updUser.Email,
-		&updUser.IsAdmin,
-		&updUser.CreatedAt)
+	Update users
+	SET %s, version = version + 1
+	WHERE id=$%d AND deleted_at IS NULL
+	RETURNING %s
+	`, strings.Join(setClauses, ", "), argPos, userColumns)
+
+	var user *types.User
+	err = p.inTx(ctx, func(tx pgx.Tx) error {
+		before, err := lockUser(ctx, tx, id, version)
+		if err != nil {
+			return err
+		}
+		user, err = queryUser(ctx, tx, annotate(ctx, query), args...)
+		if err != nil {
+			return err
+		}
+		changes := types.AuditDiff(before, user)
+		if err := insertAuditEvent(ctx, tx, newAuditEvent(types.AuditUserUpdate, id, changes)); err != nil {
+			return err
+		}
+		return recordUserChange(ctx, tx, types.UserUpdated{User: user, Changes: changes}, user)
+	})
+	if err != nil {
+		return types.User{}, err
+	}
+	user.EncryptedPassword = ""
+
+	return *user, nil
+}
+
+func (p *PostgresStore) RestoreUser(ctx context.Context, id int) (_ *types.User, err error) {
+	ctx, done := p.startQuery(ctx, "RestoreUser")
+	defer done(&err)
+
+	var user *types.User
+	err = p.inTx(ctx, func(tx pgx.Tx) error {
+		before, err := queryUser(ctx, tx, stmtLockUser, id)
+		if err != nil {
+			return err
+		}
+		user, err = queryUser(ctx, tx, stmtRestoreUser, id)
+		if err != nil {
+			return err
+		}
+		changes := types.AuditDiff(before, user)
+		if err := insertAuditEvent(ctx, tx, newAuditEvent(types.AuditUserRestore, id, changes)); err != nil {
+			return err
+		}
+		return recordUserChange(ctx, tx, types.UserCreated{User: user, Restored: true}, user)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (p *PostgresStore) PurgeUser(ctx context.Context, id int, version int) (_ int, err error) {
+	ctx, done := p.startQuery(ctx, "PurgeUser")
+	defer done(&err)
 
+	err = p.inTx(ctx, func(tx pgx.Tx) error {
+		// Soft-deleted users can be purged too, so only the version is checked here.
+		current, err := queryUser(ctx, tx, stmtLockUser, id)
+		if err != nil {
+			return err
+		}
+		if version != 0 && current.Version != version {
+			return ErrVersionMismatch
+		}
+		purged, err := queryUser(ctx, tx, stmtPurgeUser, id)
+		if err != nil {
+			return err
+		}
+		if err := insertAuditEvent(ctx, tx, newAuditEvent(types.AuditUserPurge, id, types.AuditDiff(purged, nil))); err != nil {
+			return err
+		}
+		if purged.DeletedAt != nil {
+			// Webhooks already got user.deleted when it was soft-deleted; the
+			// outbox records the purge itself.
+			return insertDomainEvent(ctx, tx, types.UserDeleted{UserID: id, Purged: true})
+		}
+		return recordUserChange(ctx, tx, types.UserDeleted{UserID: id, Purged: true}, purged)
+	})
 	if err != nil {
-		fmt.Println("no rows found")
-		return updUser, sql.ErrNoRows
+		return 0, err
 	}
 
-	return updUser, nil
+	return id, nil
 }
 
-func (p *PostgresStore) InsertUser(ctx context.Context, user *types.User) (*types.User, error) {
-	query := `insert into users 
-		(first_name, last_name, email, pass, admin, created_at)
-		values($1, $2, $3, $4, $5, $6)
-		RETURNING id, first_name, last_name, email, pass, admin, created_at`
+// PurgeDeletedUsers runs without an actor; its audit events are attributed to the retention job.
+func (p *PostgresStore) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) (_ int64, err error) {
+	ctx, done := p.startQuery(ctx, "PurgeDeletedUsers")
+	defer done(&err)
+
+	var purged int64
+	err = p.inTx(ctx, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, annotate(ctx, `DELETE FROM users WHERE deleted_at < $1 RETURNING `+userColumns), pgx.QueryExecModeExec, deletedBefore)
+		if err != nil {
+			return err
+		}
+		users, err := pgx.CollectRows(rows, scanUser)
+		if err != nil {
+			return err
+		}
+		for _, user := range users {
+			event := newAuditEvent(types.AuditUserPurge, user.ID, types.AuditDiff(user, nil))
+			event.Details = map[string]string{"reason": "retention"}
+			if err := insertAuditEvent(ctx, tx, event); err != nil {
+				return err
+			}
+			if err := insertDomainEvent(ctx, tx, types.UserDeleted{UserID: user.ID, Purged: true}); err != nil {
+				return err
+			}
+		}
+		purged = int64(len(users))
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return purged, nil
+}
+
+func (p *PostgresStore) InsertUser(ctx context.Context, user *types.User) (_ *types.User, err error) {
+	ctx, done := p.startQuery(ctx, "InsertUser")
+	defer done(&err)
+
+	var insUser *types.User
+	err = p.inTx(ctx, func(tx pgx.Tx) error {
+		insUser, err = insertUser(ctx, tx, user)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return insUser, nil
+}
 
-	insUser := &types.User{}
-	err := p.db.QueryRowContext(
-		ctx,
-		query,
+func insertUser(ctx context.Context, q querier, user *types.User) (*types.User, error) {
+	insUser, err := queryUser(ctx, q, stmtInsertUser, insertUserArgs(user)...)
+	if err != nil {
+		return nil, err
+	}
+	if err := insertAuditEvent(ctx, q, newAuditEvent(types.AuditUserCreate, insUser.ID, types.AuditDiff(nil, insUser))); err != nil {
+		return nil, err
+	}
+	if err := recordUserChange(ctx, q, types.UserCreated{User: insUser}, insUser); err != nil {
+		return nil, err
+	}
+	return insUser, nil
+}
+
+func insertUserArgs(user *types.User) []any {
+	return []any{
 		user.FirstName,
 		user.LastName,
 		user.Email,
 		user.EncryptedPassword,
 		user.IsAdmin,
 		user.CreatedAt,
-	).Scan(
-		&insUser.ID,
-		&insUser.FirstName,
-		&insUser.LastName,
-		&insUser.Email,
-		&insUser.EncryptedPassword,
-		&insUser.IsAdmin,
-		&insUser.CreatedAt,
-	)
-
-	if err != nil {
-		return nil, err
 	}
-
-	return insUser, nil
 }
 
-func (p *PostgresStore) createUserTable() error {
+func (p *PostgresStore) createUserTable(ctx context.Context) error {
 	query := `create table if not exists users (
 		id serial primary key,
 		first_name varchar(50),
@@ -230,21 +620,62 @@ func (p *PostgresStore) createUserTable() error {
 		created_at timestamp
 	)`
 
-	_, err := p.db.Exec(query)
-	if err != nil {
-		return err
-	}
-
+	_, err := p.pool.Exec(ctx, query)
 	return err
 }
 
+// migrations bring tables created by older versions up to date. Each one must
+// be idempotent, they all run on every start.
+var migrations = []string{
+	`alter table users add column if not exists deleted_at timestamptz`,
+	`create index if not exists users_deleted_at_idx on users (deleted_at) where deleted_at is not null`,
+	`alter table users add column if not exists version integer not null default 1`,
+	createAuditTable,
+	`create index if not exists audit_events_actor_idx on audit_events (actor_id, id)`,
+	`create index if not exists audit_events_target_idx on audit_events (target_id, id)`,
+	auditAppendOnly,
+	createIdempotencyTable,
+	`create index if not exists idempotency_keys_expires_at_idx on idempotency_keys (expires_at)`,
+	createUserEventsTable,
+	userEventsTrigger,
+	createWebhooksTable,
+	createWebhookDeliveriesTable,
+	`create index if not exists webhook_deliveries_due_idx on webhook_deliveries (next_attempt_at) where status = 'pending'`,
+	`create index if not exists webhook_deliveries_webhook_idx on webhook_deliveries (webhook_id, id)`,
+	createOutboxTable,
+}
+
+func (p *PostgresStore) migrate(ctx context.Context) error {
+	for _, m := range migrations {
+		if _, err := p.pool.Exec(ctx, m); err != nil {
+			return fmt.Errorf("migration %q: %w", m, err)
+		}
+	}
+	return nil
+}
+
 func (p *PostgresStore) Init() error {
-	return p.createUserTable()
+	ctx := context.Background()
+	if err := p.createUserTable(ctx); err != nil {
+		return err
+	}
+	if err := p.migrate(ctx); err != nil {
+		return err
+	}
+	// Connections opened before the tables existed could not prepare the
+	// statements; drop them so every connection is prepared from now on.
+	p.pool.Reset()
+	return nil
 }
 
 func (p *PostgresStore) CreateAdmin() error {
-	rows, _ := p.db.Query("select * from users where first_name = $1", "Admin")
-	if rows.Next() {
+	ctx := context.Background()
+	var exists bool
+	err := p.pool.QueryRow(ctx, "select exists(select 1 from users where first_name = $1)", "Admin").Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists {
 		return nil
 	}
 
@@ -257,22 +688,55 @@ func (p *PostgresStore) CreateAdmin() error {
 
 	user, err := types.NewUserFromParams(params)
 	if err != nil {
-		fmt.Println("something went wrong with creating the user")
+		return err
 	}
 	user.IsAdmin = true
 
-	_, err = p.InsertUser(context.Background(), user)
-	if err != nil {
-		return err
-	}
-	return nil
+	_, err = p.InsertUser(ctx, user)
+	return err
 }
 
 func (p *PostgresStore) DropTable(name string) error {
-	_, err := p.db.Exec(fmt.Sprintf("drop table if exists %s", name))
+	_, err := p.pool.Exec(context.Background(), fmt.Sprintf("drop table if exists %s", pgx.Identifier{name}.Sanitize()))
 	if err != nil {
 		fmt.Println(err)
 		return err
 	}
 	return nil
 }
+
+// annotate prefixes query with the request ID so it shows up in pg_stat_activity
+// and the Postgres logs. requestid only accepts IDs that cannot close the comment.
+// Prepared statements are executed by name and cannot carry it; they are
+// correlated through the statement log instead (PoolConfig.LogStatements).
+func annotate(ctx context.Context, query string) string {
+	id := requestid.FromContext(ctx)
+	if id == "" {
+		return query
+	}
+	return fmt.Sprintf("/* request_id=%s */ %s", id, query)
+}
+
+// startQuery applies the default query timeout and starts a span for operation.
+// The returned func ends both and is meant to be deferred with the named error result.
+func (p *PostgresStore) startQuery(ctx context.Context, operation string) (context.Context, func(*error)) {
+	cancel := context.CancelFunc(func() {})
+	if p.queryTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, p.queryTimeout)
+	}
+	ctx, span := tracing.Start(ctx, "store."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBOperationName(operation),
+		))
+	return ctx, func(err *error) {
+		if err != nil && errors.Is(*err, sql.ErrNoRows) {
+			// A missing user is an expected outcome, not a failed query.
+			span.End()
+		} else {
+			tracing.End(span, err)
+		}
+		cancel()
+	}
+}
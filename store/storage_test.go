@@ -0,0 +1,43 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestPingWithRetry(t *testing.T) {
+	cfg := PoolConfig{ConnectRetries: 3, RetryBackoff: 100 * time.Millisecond}
+
+	for _, tc := range []struct {
+		name     string
+		failures int
+		wantErr  bool
+		slept    []time.Duration
+	}{
+		{"reachable", 0, false, nil},
+		{"reachable after two failures", 2, false, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond}},
+		{"unreachable", 10, true, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			pings := 0
+			ping := func(context.Context) error {
+				pings++
+				if pings <= tc.failures {
+					return errors.New("connection refused")
+				}
+				return nil
+			}
+			var slept []time.Duration
+			err := pingWithRetry(ping, cfg, func(d time.Duration) { slept = append(slept, d) })
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("expected error %v but got %v", tc.wantErr, err)
+			}
+			if !slices.Equal(slept, tc.slept) {
+				t.Errorf("expected the backoff to double as %v but got %v", tc.slept, slept)
+			}
+		})
+	}
+}
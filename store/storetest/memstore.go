@@ -0,0 +1,189 @@
+// Package storetest provides in-memory stores for tests.
+package storetest
+
+import (
+	"context"
+	"database/sql"
+	"fiber/store"
+	"fiber/types"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemStore is an in-memory store.UserStore for tests of the layers above the
+// store. It follows the contract of PostgresStore, filters and versions included.
+type MemStore struct {
+	mu     sync.Mutex
+	nextID int
+	users  map[int]*types.User
+}
+
+func NewMemStore() *MemStore {
+	return &MemStore{users: map[int]*types.User{}}
+}
+
+func (s *MemStore) DropTable(string) error { return nil }
+
+func (s *MemStore) InsertUser(_ context.Context, user *types.User) (*types.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	inserted := *user
+	inserted.ID, inserted.Version = s.nextID, 1
+	s.users[inserted.ID] = &inserted
+	copied := inserted
+	return &copied, nil
+}
+
+func (s *MemStore) live(id int) (*types.User, error) {
+	user, ok := s.users[id]
+	if !ok || user.DeletedAt != nil {
+		return nil, sql.ErrNoRows
+	}
+	return user, nil
+}
+
+func (s *MemStore) DeleteUser(_ context.Context, id int, version int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, err := s.live(id)
+	if err != nil {
+		return 0, err
+	}
+	if version != 0 && version != user.Version {
+		return 0, store.ErrVersionMismatch
+	}
+	now := time.Now()
+	user.DeletedAt = &now
+	user.Version++
+	return id, nil
+}
+
+func (s *MemStore) GetUsers(_ context.Context, page types.UserPage) ([]*types.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var users []*types.User
+	for _, user := range s.users {
+		if user.DeletedAt == nil && user.ID > page.After && matches(user, page) {
+			copied := *user
+			users = append(users, &copied)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	if page.Limit > 0 && len(users) > page.Limit {
+		users = users[:page.Limit]
+	}
+	if len(users) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return users, nil
+}
+
+func (s *MemStore) GetUserByID(_ context.Context, id int) (*types.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, err := s.live(id)
+	if err != nil {
+		return nil, err
+	}
+	copied := *user
+	return &copied, nil
+}
+
+func (s *MemStore) GetUserByIDWithDeleted(_ context.Context, id int) (*types.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	copied := *user
+	return &copied, nil
+}
+
+func (s *MemStore) GetUserByEmail(_ context.Context, email string) (*types.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, user := range s.users {
+		if user.Email == email && user.DeletedAt == nil {
+			copied := *user
+			return &copied, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *MemStore) UpdateUser(_ context.Context, id int, querySet map[string]any, version int) (types.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, err := s.live(id)
+	if err != nil {
+		return types.User{}, err
+	}
+	if version != 0 && version != user.Version {
+		return types.User{}, store.ErrVersionMismatch
+	}
+	user.FirstName = querySet["first_name"].(string)
+	user.LastName = querySet["last_name"].(string)
+	user.Email = querySet["email"].(string)
+	user.Version++
+	return *user, nil
+}
+
+func (s *MemStore) RestoreUser(_ context.Context, id int) (*types.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[id]
+	if !ok || user.DeletedAt == nil {
+		return nil, sql.ErrNoRows
+	}
+	user.DeletedAt = nil
+	user.Version++
+	copied := *user
+	return &copied, nil
+}
+
+func (s *MemStore) PurgeUser(_ context.Context, id int, version int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[id]
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+	if version != 0 && version != user.Version {
+		return 0, store.ErrVersionMismatch
+	}
+	delete(s.users, id)
+	return id, nil
+}
+
+func (s *MemStore) PurgeDeletedUsers(context.Context, time.Time) (int64, error) {
+	return 0, nil
+}
+
+// NopAuditStore is a store.AuditStore that records nothing.
+type NopAuditStore struct{}
+
+func (NopAuditStore) RecordAuditEvent(context.Context, *types.AuditEvent) error { return nil }
+
+func (NopAuditStore) GetAuditEvents(context.Context, types.AuditFilter) ([]*types.AuditEvent, error) {
+	return nil, nil
+}
+
+// matches applies the filters of page like the get_users statement does.
+func matches(user *types.User, page types.UserPage) bool {
+	if page.Email != "" && user.Email != page.Email {
+		return false
+	}
+	if name := strings.ToLower(page.Name); name != "" &&
+		!strings.Contains(strings.ToLower(user.FirstName), name) &&
+		!strings.Contains(strings.ToLower(user.LastName), name) {
+		return false
+	}
+	if page.IsAdmin != nil && user.IsAdmin != *page.IsAdmin {
+		return false
+	}
+	return true
+}
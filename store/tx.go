@@ -0,0 +1,46 @@
+package store
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// TxRunner runs fn in a database transaction that every store call made with
+// the context handed to fn takes part in. The transaction is committed when fn
+// returns nil and rolled back otherwise.
+type TxRunner interface {
+	RunInTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type txKey struct{}
+
+// runInTx forwards RunInTx to next, for the decorators of a UserStore.
+func runInTx(next UserStore, ctx context.Context, fn func(ctx context.Context) error) error {
+	runner, ok := next.(TxRunner)
+	if !ok {
+		return fmt.Errorf("%T cannot run transactions", next)
+	}
+	return runner.RunInTx(ctx, fn)
+}
+
+// RunInTx implements TxRunner. Called with a context that already carries a
+// transaction, fn joins it.
+func (p *PostgresStore) RunInTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return fn(ctx)
+	}
+	return pgx.BeginFunc(ctx, p.pool, func(tx pgx.Tx) error {
+		return fn(context.WithValue(ctx, txKey{}, tx))
+	})
+}
+
+// conn returns the transaction carried by ctx, or the pool outside of one.
+// A transaction must not be used concurrently, so neither must such a ctx.
+func (p *PostgresStore) conn(ctx context.Context) querier {
+	if tx, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return tx
+	}
+	return p.pool
+}
@@ -0,0 +1,281 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fiber/types"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// WebhookStore manages webhook subscriptions and lets admins inspect and
+// redeliver their deliveries. Missing webhooks and deliveries are reported as
+// sql.ErrNoRows.
+type WebhookStore interface {
+	CreateWebhook(context.Context, *types.Webhook) (*types.Webhook, error)
+	GetWebhooks(context.Context) ([]*types.Webhook, error)
+	GetWebhookByID(context.Context, int) (*types.Webhook, error)
+	UpdateWebhook(ctx context.Context, id int, webhook *types.Webhook) (*types.Webhook, error)
+	// DeleteWebhook also deletes the deliveries of the webhook.
+	DeleteWebhook(context.Context, int) error
+
+	GetWebhookDeliveries(context.Context, types.WebhookDeliveryFilter) ([]*types.WebhookDelivery, error)
+	// RedeliverWebhook schedules a delivered or dead delivery to be sent again
+	// now, with a fresh set of attempts.
+	RedeliverWebhook(ctx context.Context, id int64) (*types.WebhookDelivery, error)
+}
+
+// WebhookOutbox is the side of the deliveries the webhook worker uses.
+type WebhookOutbox interface {
+	// ClaimWebhookDeliveries returns up to limit pending deliveries that are due
+	// and counts an attempt for each. They are not claimed again for lease, so a
+	// worker that dies while sending leaves them to be retried.
+	ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*types.WebhookDelivery, error)
+	RecordWebhookAttempt(ctx context.Context, id int64, attempt WebhookAttempt) error
+}
+
+// WebhookAttempt is the outcome of sending a delivery. Status is the new
+// state of the delivery; pending ones are retried at NextAttemptAt.
+type WebhookAttempt struct {
+	Status        string
+	StatusCode    *int
+	Error         string
+	NextAttemptAt time.Time
+}
+
+const webhookColumns = "id, url, events, secret, active, created_at"
+
+const webhookDeliveryColumns = "d.id, d.webhook_id, d.event, d.payload, d.status, d.attempts, d.next_attempt_at, d.last_status_code, d.last_error, d.created_at, d.delivered_at"
+
+const createWebhooksTable = `create table if not exists webhooks (
+	id serial primary key,
+	url text not null,
+	events text[] not null,
+	secret text not null,
+	active boolean not null default true,
+	created_at timestamptz not null default now()
+)`
+
+// webhook_deliveries is the outbox of the webhooks: rows are written in the
+// transaction of the user change and sent afterwards by the worker.
+const createWebhookDeliveriesTable = `create table if not exists webhook_deliveries (
+	id bigserial primary key,
+	webhook_id integer not null references webhooks (id) on delete cascade,
+	event text not null,
+	payload jsonb not null,
+	status varchar(16) not null default 'pending',
+	attempts integer not null default 0,
+	next_attempt_at timestamptz not null default now(),
+	last_status_code integer,
+	last_error text,
+	created_at timestamptz not null default now(),
+	delivered_at timestamptz
+)`
+
+// recordUserChange writes change to the outbox and enqueues its webhook
+// deliveries with q, the transaction of the change to user.
+func recordUserChange(ctx context.Context, q querier, change types.UserChange, user *types.User) error {
+	if err := insertDomainEvent(ctx, q, change); err != nil {
+		return err
+	}
+	return enqueueWebhooks(ctx, q, change.WebhookEvent(), user)
+}
+
+// queueUserChange is recordUserChange for a batch.
+func queueUserChange(ctx context.Context, batch *pgx.Batch, change types.UserChange, user *types.User) {
+	queueDomainEvent(ctx, batch, change)
+	queueWebhooks(batch, change.WebhookEvent(), user)
+}
+
+// enqueueWebhooks adds a delivery of event for every active webhook
+// subscribed to it. q is the transaction of the change to user.
+func enqueueWebhooks(ctx context.Context, q querier, event string, user *types.User) error {
+	_, err := q.Exec(ctx, stmtEnqueueWebhooks, event, webhookPayload(event, user))
+	return err
+}
+
+// queueWebhooks is enqueueWebhooks for a batch.
+func queueWebhooks(batch *pgx.Batch, event string, user *types.User) {
+	batch.Queue(stmtEnqueueWebhooks, event, webhookPayload(event, user))
+}
+
+func webhookPayload(event string, user *types.User) types.WebhookPayload {
+	return types.WebhookPayload{Event: event, OccurredAt: time.Now().UTC(), User: user}
+}
+
+func (p *PostgresStore) CreateWebhook(ctx context.Context, webhook *types.Webhook) (_ *types.Webhook, err error) {
+	ctx, done := p.startQuery(ctx, "CreateWebhook")
+	defer done(&err)
+
+	rows, err := p.conn(ctx).Query(ctx, stmtInsertWebhook, webhook.URL, webhook.Events, webhook.Secret, webhook.Active)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectExactlyOneRow(rows, scanWebhook)
+}
+
+func (p *PostgresStore) GetWebhooks(ctx context.Context) (_ []*types.Webhook, err error) {
+	ctx, done := p.startQuery(ctx, "GetWebhooks")
+	defer done(&err)
+
+	rows, err := p.conn(ctx).Query(ctx, annotate(ctx, `select `+webhookColumns+` from webhooks order by id`), pgx.QueryExecModeExec)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, scanWebhook)
+}
+
+func (p *PostgresStore) GetWebhookByID(ctx context.Context, id int) (_ *types.Webhook, err error) {
+	ctx, done := p.startQuery(ctx, "GetWebhookByID")
+	defer done(&err)
+
+	rows, err := p.conn(ctx).Query(ctx, stmtGetWebhookByID, id)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectExactlyOneRow(rows, scanWebhook)
+}
+
+func (p *PostgresStore) UpdateWebhook(ctx context.Context, id int, webhook *types.Webhook) (_ *types.Webhook, err error) {
+	ctx, done := p.startQuery(ctx, "UpdateWebhook")
+	defer done(&err)
+
+	rows, err := p.conn(ctx).Query(ctx, stmtUpdateWebhook, id, webhook.URL, webhook.Events, webhook.Secret, webhook.Active)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectExactlyOneRow(rows, scanWebhook)
+}
+
+func (p *PostgresStore) DeleteWebhook(ctx context.Context, id int) (err error) {
+	ctx, done := p.startQuery(ctx, "DeleteWebhook")
+	defer done(&err)
+
+	tag, err := p.conn(ctx).Exec(ctx, stmtDeleteWebhook, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (p *PostgresStore) GetWebhookDeliveries(ctx context.Context, filter types.WebhookDeliveryFilter) (_ []*types.WebhookDelivery, err error) {
+	ctx, done := p.startQuery(ctx, "GetWebhookDeliveries")
+	defer done(&err)
+
+	filter = filter.WithDefaults()
+	where := []string{}
+	args := []any{pgx.QueryExecModeExec}
+	add := func(clause string, arg any) {
+		args = append(args, arg)
+		where = append(where, fmt.Sprintf(clause, len(args)-1))
+	}
+	if filter.WebhookID != 0 {
+		add("d.webhook_id = $%d", filter.WebhookID)
+	}
+	if filter.Status != "" {
+		add("d.status = $%d", filter.Status)
+	}
+
+	query := "select " + webhookDeliveryColumns + " from webhook_deliveries d"
+	if len(where) > 0 {
+		query += " where " + strings.Join(where, " and ")
+	}
+	args = append(args, filter.Limit, filter.Offset)
+	query += fmt.Sprintf(" order by d.id desc limit $%d offset $%d", len(args)-2, len(args)-1)
+
+	rows, err := p.conn(ctx).Query(ctx, annotate(ctx, query), args...)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, scanWebhookDelivery)
+}
+
+func (p *PostgresStore) RedeliverWebhook(ctx context.Context, id int64) (_ *types.WebhookDelivery, err error) {
+	ctx, done := p.startQuery(ctx, "RedeliverWebhook")
+	defer done(&err)
+
+	rows, err := p.conn(ctx).Query(ctx, stmtRedeliverWebhook, id)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectExactlyOneRow(rows, scanWebhookDelivery)
+}
+
+func (p *PostgresStore) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) (_ []*types.WebhookDelivery, err error) {
+	ctx, done := p.startQuery(ctx, "ClaimWebhookDeliveries")
+	defer done(&err)
+
+	rows, err := p.pool.Query(ctx, stmtClaimWebhookDeliveries, limit, lease)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (*types.WebhookDelivery, error) {
+		d := &types.WebhookDelivery{}
+		if err := scanWebhookDeliveryInto(row, d, &d.URL, &d.Secret); err != nil {
+			return nil, err
+		}
+		return d, nil
+	})
+}
+
+func (p *PostgresStore) RecordWebhookAttempt(ctx context.Context, id int64, attempt WebhookAttempt) (err error) {
+	ctx, done := p.startQuery(ctx, "RecordWebhookAttempt")
+	defer done(&err)
+
+	var lastError *string
+	if attempt.Error != "" {
+		lastError = &attempt.Error
+	}
+	_, err = p.pool.Exec(ctx, stmtRecordWebhookAttempt, id, attempt.Status, attempt.StatusCode, lastError, attempt.NextAttemptAt)
+	return err
+}
+
+func scanWebhook(row pgx.CollectableRow) (*types.Webhook, error) {
+	webhook := &types.Webhook{}
+	err := row.Scan(
+		&webhook.ID,
+		&webhook.URL,
+		&webhook.Events,
+		&webhook.Secret,
+		&webhook.Active,
+		&webhook.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
+
+func scanWebhookDelivery(row pgx.CollectableRow) (*types.WebhookDelivery, error) {
+	d := &types.WebhookDelivery{}
+	if err := scanWebhookDeliveryInto(row, d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// scanWebhookDeliveryInto reads webhookDeliveryColumns into d, followed by the
+// extra columns of the row, if any.
+func scanWebhookDeliveryInto(row pgx.Row, d *types.WebhookDelivery, extra ...any) error {
+	var lastError *string
+	err := row.Scan(append([]any{
+		&d.ID,
+		&d.WebhookID,
+		&d.Event,
+		&d.Payload,
+		&d.Status,
+		&d.Attempts,
+		&d.NextAttemptAt,
+		&d.LastStatusCode,
+		&lastError,
+		&d.CreatedAt,
+		&d.DeliveredAt,
+	}, extra...)...)
+	d.LastError = deref(lastError)
+	return err
+}
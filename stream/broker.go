@@ -0,0 +1,83 @@
+// Package stream fans user change events out to the subscribers of this
+// replica. Events reach every replica through Postgres LISTEN/NOTIFY.
+package stream
+
+import (
+	"fiber/types"
+	"sync"
+)
+
+// Broker hands every published event to all current subscribers.
+type Broker struct {
+	mu     sync.Mutex
+	subs   map[*Subscription]struct{}
+	closed bool
+}
+
+func NewBroker() *Broker {
+	return &Broker{subs: map[*Subscription]struct{}{}}
+}
+
+// Subscription receives the events published after it was created. Its
+// channel is closed when the subscriber falls more than its buffer behind or
+// the broker is closed; the subscriber is expected to resume from the event
+// log with the id of the last event it got.
+type Subscription struct {
+	events chan *types.UserEvent
+	broker *Broker
+	once   sync.Once
+}
+
+func (b *Broker) Subscribe(buffer int) *Subscription {
+	sub := &Subscription{events: make(chan *types.UserEvent, buffer), broker: b}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(sub.events)
+		return sub
+	}
+	b.subs[sub] = struct{}{}
+	return sub
+}
+
+func (s *Subscription) Events() <-chan *types.UserEvent {
+	return s.events
+}
+
+// Close unsubscribes; it is safe to call more than once.
+func (s *Subscription) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	s.drop()
+}
+
+// drop must be called with the broker locked.
+func (s *Subscription) drop() {
+	s.once.Do(func() {
+		delete(s.broker.subs, s)
+		close(s.events)
+	})
+}
+
+// Publish never blocks: a subscriber whose buffer is full is dropped.
+func (b *Broker) Publish(event *types.UserEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range b.subs {
+		select {
+		case sub.events <- event:
+		default:
+			sub.drop()
+		}
+	}
+}
+
+// Close drops every subscriber and refuses new ones.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for sub := range b.subs {
+		sub.drop()
+	}
+}
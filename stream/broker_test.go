@@ -0,0 +1,56 @@
+package stream
+
+import (
+	"fiber/types"
+	"testing"
+)
+
+func TestBrokerFanOut(t *testing.T) {
+	b := NewBroker()
+	first, second := b.Subscribe(1), b.Subscribe(1)
+	defer first.Close()
+
+	b.Publish(&types.UserEvent{ID: 1})
+	for _, sub := range []*Subscription{first, second} {
+		if event := <-sub.Events(); event.ID != 1 {
+			t.Errorf("expected event 1, got %d", event.ID)
+		}
+	}
+
+	second.Close()
+	second.Close()
+	if _, ok := <-second.Events(); ok {
+		t.Error("expected a closed subscription to be closed")
+	}
+	b.Publish(&types.UserEvent{ID: 2})
+	if event := <-first.Events(); event.ID != 2 {
+		t.Errorf("expected event 2, got %d", event.ID)
+	}
+}
+
+func TestBrokerDropsSlowSubscribers(t *testing.T) {
+	b := NewBroker()
+	sub := b.Subscribe(1)
+
+	b.Publish(&types.UserEvent{ID: 1})
+	b.Publish(&types.UserEvent{ID: 2})
+	if event := <-sub.Events(); event.ID != 1 {
+		t.Errorf("expected event 1, got %d", event.ID)
+	}
+	if _, ok := <-sub.Events(); ok {
+		t.Error("expected the subscriber to be dropped")
+	}
+	sub.Close()
+}
+
+func TestBrokerClose(t *testing.T) {
+	b := NewBroker()
+	sub := b.Subscribe(1)
+	b.Close()
+	if _, ok := <-sub.Events(); ok {
+		t.Error("expected Close to end subscriptions")
+	}
+	if _, ok := <-b.Subscribe(1).Events(); ok {
+		t.Error("expected subscriptions after Close to be closed")
+	}
+}
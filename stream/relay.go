@@ -0,0 +1,94 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fiber/store"
+	"fiber/types"
+	"log/slog"
+	"time"
+)
+
+const (
+	minRelayBackoff = time.Second
+	maxRelayBackoff = 30 * time.Second
+	// catchUpBatch is how many events are read from the log at once.
+	catchUpBatch = 500
+	// catchUpWindow is how many ids below the newest published event are read
+	// again when catching up. Ids are taken before the commit, so an event may
+	// commit after one with a higher id.
+	catchUpWindow = 100
+)
+
+// Relay publishes the events committed on any replica to b until ctx is done,
+// then closes b. When the connection to Postgres is lost it reconnects with
+// backoff and publishes the events it missed from the log.
+func Relay(ctx context.Context, s store.UserEventStore, b *Broker) {
+	defer b.Close()
+	logger := slog.Default()
+	backoff := minRelayBackoff
+	// last is the newest event published, and start the newest event in the
+	// log when the relay first connected; both are -1 until then.
+	last, start := int64(-1), int64(-1)
+	// published holds the ids within catchUpWindow of last that were published.
+	published := map[int64]bool{}
+
+	publish := func(event *types.UserEvent) {
+		// Events committed while catching up are also notified.
+		if published[event.ID] {
+			return
+		}
+		published[event.ID] = true
+		if event.ID > last {
+			last = event.ID
+			for id := range published {
+				if id <= last-catchUpWindow {
+					delete(published, id)
+				}
+			}
+		}
+		b.Publish(event)
+	}
+	ready := func(ctx context.Context) error {
+		backoff = minRelayBackoff
+		if start < 0 {
+			_, newest, err := s.UserEventBounds(ctx)
+			if err != nil {
+				return err
+			}
+			start, last = newest, newest
+			return nil
+		}
+		after := max(last-catchUpWindow, start)
+		for {
+			events, err := s.UserEventsAfter(ctx, after, catchUpBatch)
+			if err != nil {
+				return err
+			}
+			for _, event := range events {
+				after = event.ID
+				publish(event)
+			}
+			if len(events) < catchUpBatch {
+				return nil
+			}
+		}
+	}
+
+	for {
+		err := s.ListenUserEvents(ctx, ready, publish)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			err = errors.New("listener stopped")
+		}
+		logger.ErrorContext(ctx, "user event relay failed, reconnecting", "error", err.Error(), "backoff", backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxRelayBackoff)
+	}
+}
@@ -0,0 +1,113 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fiber/types"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeEventStore fails the first listen after delivering one event, and adds
+// two events to the log while disconnected, one of them with a lower id.
+type fakeEventStore struct {
+	mu      sync.Mutex
+	log     []*types.UserEvent
+	listens int
+}
+
+func (s *fakeEventStore) UserEventsAfter(_ context.Context, after int64, limit int) ([]*types.UserEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var events []*types.UserEvent
+	for _, event := range s.log {
+		if event.ID > after && len(events) < limit {
+			events = append(events, event)
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+	return events, nil
+}
+
+func (s *fakeEventStore) UserEventBounds(context.Context) (int64, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.log) == 0 {
+		return 0, 0, nil
+	}
+	return s.log[0].ID, s.log[len(s.log)-1].ID, nil
+}
+
+func (s *fakeEventStore) add(id int64) *types.UserEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	event := &types.UserEvent{ID: id, Type: types.UserEventUpdated}
+	s.log = append(s.log, event)
+	return event
+}
+
+func (s *fakeEventStore) ListenUserEvents(ctx context.Context, ready func(context.Context) error, fn func(*types.UserEvent)) error {
+	s.mu.Lock()
+	s.listens++
+	listens := s.listens
+	s.mu.Unlock()
+
+	if err := ready(ctx); err != nil {
+		return err
+	}
+	if listens == 1 {
+		fn(s.add(3))
+		// Committed while the relay is disconnected; 2 was taken before 3
+		// but committed after it.
+		s.add(2)
+		s.add(4)
+		return errors.New("connection lost")
+	}
+	// Committed while catching up, so both replayed and notified.
+	fn(s.add(5))
+	s.mu.Lock()
+	replayed := s.log[3]
+	s.mu.Unlock()
+	fn(replayed)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (s *fakeEventStore) TrimUserEvents(context.Context, int) (int64, error) {
+	return 0, nil
+}
+
+func TestRelayCatchesUpAfterReconnecting(t *testing.T) {
+	s := &fakeEventStore{}
+	s.add(1) // in the log before the relay starts, so never published
+	b := NewBroker()
+	sub := b.Subscribe(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		Relay(ctx, s, b)
+		close(done)
+	}()
+
+	var got []int64
+	timeout := time.After(5 * time.Second)
+	for len(got) < 4 {
+		select {
+		case event := <-sub.Events():
+			got = append(got, event.ID)
+		case <-timeout:
+			t.Fatalf("timed out with events %v", got)
+		}
+	}
+	cancel()
+	<-done
+
+	if got[0] != 3 || got[1] != 2 || got[2] != 4 || got[3] != 5 {
+		t.Errorf("expected events 3, 2, 4 and 5, got %v", got)
+	}
+	if event, ok := <-sub.Events(); ok {
+		t.Errorf("expected the broker to be closed when the relay stops, got event %d", event.ID)
+	}
+}
@@ -0,0 +1,104 @@
+package types
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	AuditUserCreate       = "user.create"
+	AuditUserUpdate       = "user.update"
+	AuditUserDelete       = "user.delete"
+	AuditUserRestore      = "user.restore"
+	AuditUserPurge        = "user.purge"
+	AuditAuthLogin        = "auth.login"
+	AuditAuthLoginFailure = "auth.login_failed"
+
+	maxAuditLimit     = 500
+	defaultAuditLimit = 50
+)
+
+type AuditChange struct {
+	Before any `json:"before"`
+	After  any `json:"after"`
+}
+
+type AuditEvent struct {
+	ID         int64                  `json:"id"`
+	ActorID    *int                   `json:"actorId,omitempty"`
+	Action     string                 `json:"action"`
+	TargetType string                 `json:"targetType"`
+	TargetID   *int                   `json:"targetId,omitempty"`
+	Changes    map[string]AuditChange `json:"changes,omitempty"`
+	Details    map[string]string      `json:"details,omitempty"`
+	IP         string                 `json:"ip,omitempty"`
+	UserAgent  string                 `json:"userAgent,omitempty"`
+	RequestID  string                 `json:"requestId,omitempty"`
+	CreatedAt  time.Time              `json:"createdAt"`
+}
+
+type AuditFilter struct {
+	ActorID  int       `query:"actorId"`
+	TargetID int       `query:"targetId"`
+	Action   string    `query:"action"`
+	From     time.Time `query:"-"`
+	To       time.Time `query:"-"`
+	Limit    int       `query:"limit"`
+	Offset   int       `query:"offset"`
+}
+
+func (f AuditFilter) Validate() map[string]string {
+	errors := map[string]string{}
+	if f.Limit < 0 || f.Limit > maxAuditLimit {
+		errors["limit"] = fmt.Sprintf("limit should be between 0 and %d", maxAuditLimit)
+	}
+	if f.Offset < 0 {
+		errors["offset"] = "offset should not be negative"
+	}
+	if !f.From.IsZero() && !f.To.IsZero() && f.To.Before(f.From) {
+		errors["to"] = "to should not be before from"
+	}
+	return errors
+}
+
+// WithDefaults fills in the page size when the client did not ask for one.
+func (f AuditFilter) WithDefaults() AuditFilter {
+	if f.Limit == 0 {
+		f.Limit = defaultAuditLimit
+	}
+	return f
+}
+
+// AuditSnapshot is the audited view of a user; the password hash is never part of it.
+func AuditSnapshot(u *User) map[string]any {
+	if u == nil {
+		return nil
+	}
+	return map[string]any{
+		"firstName": u.FirstName,
+		"lastName":  u.LastName,
+		"email":     u.Email,
+		"isAdmin":   u.IsAdmin,
+		"deletedAt": u.DeletedAt,
+	}
+}
+
+// AuditDiff lists the snapshot fields that differ between before and after.
+// Either side may be nil for creations and purges.
+func AuditDiff(before, after *User) map[string]AuditChange {
+	b, a := AuditSnapshot(before), AuditSnapshot(after)
+	changes := map[string]AuditChange{}
+	for _, key := range []string{"firstName", "lastName", "email", "isAdmin", "deletedAt"} {
+		var bv, av any
+		if b != nil {
+			bv = b[key]
+		}
+		if a != nil {
+			av = a[key]
+		}
+		if fmt.Sprint(bv) != fmt.Sprint(av) {
+			changes[key] = AuditChange{Before: bv, After: av}
+		}
+	}
+	return changes
+}
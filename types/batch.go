@@ -0,0 +1,76 @@
+package types
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	maxBatchOperations = 50
+
+	// BatchPath is where batches are posted; a batch cannot contain another one.
+	BatchPath = "/api/v1/batch"
+)
+
+// BatchOperation is a sub-request of a batch. Paths are absolute, such as
+// /api/v1/user/1, and may carry a query string. They must be in normalized
+// form: dot segments, escapes and repeated slashes are rejected.
+type BatchOperation struct {
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    any               `json:"body,omitempty"`
+}
+
+type BatchRequest struct {
+	// Atomic runs every operation in one database transaction, which is only
+	// committed when all of them succeed.
+	Atomic     bool             `json:"atomic"`
+	Operations []BatchOperation `json:"operations"`
+}
+
+type BatchResult struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    any               `json:"body,omitempty"`
+}
+
+type BatchResponse struct {
+	// Committed is false when an atomic batch was rolled back.
+	Committed bool          `json:"committed"`
+	Results   []BatchResult `json:"results"`
+}
+
+func (r BatchRequest) Validate() map[string]string {
+	errors := map[string]string{}
+	if len(r.Operations) == 0 || len(r.Operations) > maxBatchOperations {
+		errors["operations"] = fmt.Sprintf("a batch should have between 1 and %d operations", maxBatchOperations)
+	}
+	for i, op := range r.Operations {
+		switch op.Method {
+		case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		default:
+			errors[fmt.Sprintf("operations[%d].method", i)] = "method should be GET, POST, PUT, PATCH or DELETE"
+		}
+		path, _, _ := strings.Cut(op.Path, "?")
+		// Routing ignores case and trailing slashes.
+		isBatch := strings.EqualFold(strings.TrimRight(path, "/"), BatchPath)
+		if !strings.HasPrefix(path, "/api/v1/") || isBatch || !isNormalizedPath(path) {
+			errors[fmt.Sprintf("operations[%d].path", i)] = "path should be a normalized /api/v1/ route other than the batch itself"
+		}
+	}
+	return errors
+}
+
+// isNormalizedPath reports whether path is already in the form fasthttp
+// normalizes it to, so that checking it checks the path that is served.
+func isNormalizedPath(path string) bool {
+	var uri fasthttp.URI
+	if err := uri.Parse(nil, []byte(path)); err != nil {
+		return false
+	}
+	return string(uri.Path()) == path
+}
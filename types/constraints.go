@@ -0,0 +1,90 @@
+package types
+
+// FieldConstraint documents a rule Validate enforces on one field. It does not
+// validate anything itself; Validate stays the source of truth and a test keeps
+// both in line.
+type FieldConstraint struct {
+	Required  bool
+	MinLength int
+	MaxLength int
+	Minimum   *float64
+	Maximum   *float64
+	MinItems  int
+	MaxItems  int
+	Format    string
+	Pattern   string
+	Enum      []string
+}
+
+// Constrained is implemented by params types to describe their validation
+// rules, keyed by the JSON (or query) name of each field.
+type Constrained interface {
+	Constraints() map[string]FieldConstraint
+}
+
+func bound(v float64) *float64 {
+	return &v
+}
+
+func (CreateUserParams) Constraints() map[string]FieldConstraint {
+	return map[string]FieldConstraint{
+		"firstName": {Required: true, MinLength: minFirstNameLen},
+		"lastName":  {Required: true, MinLength: minLastNameLen},
+		"email":     {Required: true, Format: "email", Pattern: emailPattern},
+		"password":  {Required: true, MinLength: minPasswordLen},
+	}
+}
+
+func (UpdateUserParams) Constraints() map[string]FieldConstraint {
+	return map[string]FieldConstraint{
+		"firstName": {Required: true, MinLength: minFirstNameLen},
+		"lastName":  {Required: true, MinLength: minLastNameLen},
+		"email":     {Required: true, Format: "email", Pattern: emailPattern},
+	}
+}
+
+func (UserPage) Constraints() map[string]FieldConstraint {
+	return map[string]FieldConstraint{
+		"limit": {Minimum: bound(0), Maximum: bound(maxUserPageLimit)},
+		"after": {Minimum: bound(0)},
+		"email": {MaxLength: maxUserFilterLen},
+		"name":  {MaxLength: maxUserFilterLen},
+	}
+}
+
+func (AuditFilter) Constraints() map[string]FieldConstraint {
+	return map[string]FieldConstraint{
+		"limit":  {Minimum: bound(0), Maximum: bound(maxAuditLimit)},
+		"offset": {Minimum: bound(0)},
+		"action": {Enum: []string{AuditUserCreate, AuditUserUpdate, AuditUserDelete, AuditUserRestore, AuditUserPurge, AuditAuthLogin, AuditAuthLoginFailure}},
+	}
+}
+
+func (BatchRequest) Constraints() map[string]FieldConstraint {
+	return map[string]FieldConstraint{
+		"operations": {Required: true, MinItems: 1, MaxItems: maxBatchOperations},
+	}
+}
+
+func (BatchOperation) Constraints() map[string]FieldConstraint {
+	return map[string]FieldConstraint{
+		"method": {Required: true, Enum: []string{"GET", "POST", "PUT", "PATCH", "DELETE"}},
+		"path":   {Required: true, Pattern: `^/api/v1/`},
+	}
+}
+
+func (WebhookParams) Constraints() map[string]FieldConstraint {
+	return map[string]FieldConstraint{
+		"url":    {Required: true, Format: "uri", MaxLength: maxWebhookURLLen},
+		"events": {Required: true, MinItems: 1},
+		"secret": {Required: true, MinLength: minWebhookSecretLen},
+	}
+}
+
+func (WebhookDeliveryFilter) Constraints() map[string]FieldConstraint {
+	return map[string]FieldConstraint{
+		"status": {Enum: []string{WebhookPending, WebhookDelivered, WebhookDead}},
+		"limit":  {Minimum: bound(0), Maximum: bound(maxWebhookDeliveryLimit)},
+		"offset": {Minimum: bound(0)},
+	}
+}
@@ -0,0 +1,54 @@
+package types
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestConstraintsMatchValidate checks that the documented constraints are
+// enforced: breaking any of them must fail Validate on that field.
+func TestConstraintsMatchValidate(t *testing.T) {
+	valid := CreateUserParams{FirstName: "James", LastName: "Foo", Email: "james@foo.com", Password: "supersecure"}
+	if errors := valid.Validate(); len(errors) > 0 {
+		t.Fatalf("expected valid params but got %v", errors)
+	}
+	broken := map[string]func(*CreateUserParams){
+		"firstName": func(p *CreateUserParams) { p.FirstName = strings.Repeat("x", minFirstNameLen-1) },
+		"lastName":  func(p *CreateUserParams) { p.LastName = strings.Repeat("x", minLastNameLen-1) },
+		"email":     func(p *CreateUserParams) { p.Email = "not an email" },
+		"password":  func(p *CreateUserParams) { p.Password = strings.Repeat("x", minPasswordLen-1) },
+	}
+	for name, c := range valid.Constraints() {
+		breakField, ok := broken[name]
+		if !ok {
+			t.Errorf("no check for the constraints of %s", name)
+			continue
+		}
+		p := valid
+		breakField(&p)
+		if _, ok := p.Validate()[name]; !ok {
+			t.Errorf("expected %s to fail validation for %+v", name, c)
+		}
+	}
+
+	filter := AuditFilter{Limit: maxAuditLimit + 1, Offset: -1}
+	errors := filter.Validate()
+	for _, name := range []string{"limit", "offset"} {
+		if _, ok := errors[name]; !ok {
+			t.Errorf("expected %s to fail validation", name)
+		}
+	}
+
+	webhook := WebhookParams{URL: "ftp://crm", Events: []string{"user.renamed"}, Secret: "short"}
+	errors = webhook.Validate()
+	for name := range webhook.Constraints() {
+		if _, ok := errors[name]; !ok {
+			t.Errorf("expected webhook %s to fail validation", name)
+		}
+	}
+
+	batch := BatchRequest{Operations: make([]BatchOperation, maxBatchOperations+1)}
+	if _, ok := batch.Validate()["operations"]; !ok {
+		t.Errorf("expected more than %d operations to fail validation", maxBatchOperations)
+	}
+}
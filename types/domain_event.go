@@ -0,0 +1,78 @@
+package types
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Domain event types, the Type of a DomainEvent.
+const (
+	DomainUserCreated  = "UserCreated"
+	DomainUserUpdated  = "UserUpdated"
+	DomainUserDeleted  = "UserDeleted"
+	DomainUserLoggedIn = "UserLoggedIn"
+)
+
+// DomainEvent is a fact about a user, recorded in the outbox in the same
+// transaction as the change it describes. Events of one user are published in
+// ID order; UserID orders them.
+type DomainEvent struct {
+	ID         int64           `json:"id"`
+	Type       string          `json:"type"`
+	UserID     int             `json:"userId"`
+	Payload    json.RawMessage `json:"payload"`
+	RequestID  string          `json:"requestId,omitempty"`
+	OccurredAt time.Time       `json:"occurredAt"`
+}
+
+// DomainPayload is the payload of a domain event of a given type.
+type DomainPayload interface {
+	EventType() string
+	EventUserID() int
+}
+
+// UserCreated is emitted when a user is created or imported, and when a
+// soft-deleted user is restored: subscribers were told it was deleted, so it
+// comes back as created, as it does for webhooks and change streams.
+type UserCreated struct {
+	User     *User `json:"user"`
+	Restored bool  `json:"restored,omitempty"`
+}
+
+type UserUpdated struct {
+	User    *User                  `json:"user"`
+	Changes map[string]AuditChange `json:"changes"`
+}
+
+// UserDeleted is emitted when a user is soft-deleted and again when it is
+// purged for good.
+type UserDeleted struct {
+	UserID int  `json:"userId"`
+	Purged bool `json:"purged"`
+}
+
+type UserLoggedIn struct {
+	UserID int    `json:"userId"`
+	IP     string `json:"ip,omitempty"`
+}
+
+func (UserCreated) EventType() string  { return DomainUserCreated }
+func (UserUpdated) EventType() string  { return DomainUserUpdated }
+func (UserDeleted) EventType() string  { return DomainUserDeleted }
+func (UserLoggedIn) EventType() string { return DomainUserLoggedIn }
+
+func (e UserCreated) EventUserID() int  { return e.User.ID }
+func (e UserUpdated) EventUserID() int  { return e.User.ID }
+func (e UserDeleted) EventUserID() int  { return e.UserID }
+func (e UserLoggedIn) EventUserID() int { return e.UserID }
+
+// UserChange is a domain event that webhooks are also told about. Both are
+// recorded together, so they always agree on the type of a change.
+type UserChange interface {
+	DomainPayload
+	WebhookEvent() string
+}
+
+func (UserCreated) WebhookEvent() string { return WebhookUserCreated }
+func (UserUpdated) WebhookEvent() string { return WebhookUserUpdated }
+func (UserDeleted) WebhookEvent() string { return WebhookUserDeleted }
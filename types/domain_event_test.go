@@ -0,0 +1,30 @@
+package types
+
+import "testing"
+
+func TestUserChangeTypesAgree(t *testing.T) {
+	tests := []struct {
+		change  UserChange
+		domain  string
+		webhook string
+		stream  string
+	}{
+		{UserCreated{User: &User{}}, DomainUserCreated, WebhookUserCreated, UserEventCreated},
+		{UserCreated{User: &User{}, Restored: true}, DomainUserCreated, WebhookUserCreated, UserEventCreated},
+		{UserUpdated{User: &User{}}, DomainUserUpdated, WebhookUserUpdated, UserEventUpdated},
+		{UserDeleted{}, DomainUserDeleted, WebhookUserDeleted, UserEventDeleted},
+		{UserDeleted{Purged: true}, DomainUserDeleted, WebhookUserDeleted, UserEventDeleted},
+	}
+	for _, tt := range tests {
+		if got := tt.change.EventType(); got != tt.domain {
+			t.Errorf("%+v: expected domain event %s got %s", tt.change, tt.domain, got)
+		}
+		if got := tt.change.WebhookEvent(); got != tt.webhook {
+			t.Errorf("%+v: expected webhook event %s got %s", tt.change, tt.webhook, got)
+		}
+		// Webhook events are the change stream types prefixed with "user.".
+		if tt.webhook != "user."+tt.stream {
+			t.Errorf("%+v: webhook event %s does not match stream type %s", tt.change, tt.webhook, tt.stream)
+		}
+	}
+}
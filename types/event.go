@@ -0,0 +1,22 @@
+package types
+
+import "time"
+
+// Types of UserEvent. A restored user is announced as created again, and a
+// purged user as deleted unless it already was.
+const (
+	UserEventCreated = "created"
+	UserEventUpdated = "updated"
+	UserEventDeleted = "deleted"
+	// UserEventReset tells a resuming subscriber that events it missed are no
+	// longer in the log, so it has to reload the users.
+	UserEventReset = "reset"
+)
+
+// UserEvent is a change to a user, as pushed to change stream subscribers.
+type UserEvent struct {
+	ID        int64     `json:"id,omitempty"`
+	Type      string    `json:"type"`
+	User      *User     `json:"user,omitempty"`
+	CreatedAt time.Time `json:"createdAt,omitempty"`
+}
@@ -0,0 +1,18 @@
+package types
+
+// ImportRowError reports why one row of an import was not imported. Rows are
+// numbered from 1, not counting the CSV header.
+type ImportRowError struct {
+	Row    int               `json:"row"`
+	Email  string            `json:"email,omitempty"`
+	Errors map[string]string `json:"errors"`
+}
+
+type ImportReport struct {
+	Total    int              `json:"total"`
+	Imported int              `json:"imported"`
+	Failed   int              `json:"failed"`
+	Atomic   bool             `json:"atomic"`
+	DryRun   bool             `json:"dryRun"`
+	Errors   []ImportRowError `json:"errors"`
+}
@@ -13,16 +13,49 @@ const (
 	minLastNameLen  = 3
 	minPasswordLen  = 4
 	bcryptCost      = 12
+
+	maxUserPageLimit = 500
+	maxUserFilterLen = 255
 )
 
 type User struct {
-	ID                int       `json:"id"`
-	FirstName         string    `json:"firstName"`
-	LastName          string    `json:"lastName"`
-	Email             string    `json:"email"`
-	EncryptedPassword string    `json:"-"`
-	IsAdmin           bool      `json:"isAdmin"`
-	CreatedAt         time.Time `json:"createdAt"`
+	ID                int        `json:"id"`
+	FirstName         string     `json:"firstName"`
+	LastName          string     `json:"lastName"`
+	Email             string     `json:"email"`
+	EncryptedPassword string     `json:"-"`
+	IsAdmin           bool       `json:"isAdmin"`
+	CreatedAt         time.Time  `json:"createdAt"`
+	DeletedAt         *time.Time `json:"deletedAt,omitempty"`
+	Version           int        `json:"version"`
+}
+
+// UserPage selects users in id order, starting after the user with id After.
+// A zero Limit selects all of them. The filters are ignored when empty: Email
+// matches exactly and Name is a case-insensitive part of the first or last name.
+type UserPage struct {
+	After   int    `query:"after"`
+	Limit   int    `query:"limit"`
+	Email   string `query:"email"`
+	Name    string `query:"name"`
+	IsAdmin *bool  `query:"isAdmin"`
+}
+
+func (p UserPage) Validate() map[string]string {
+	errors := map[string]string{}
+	if p.Limit < 0 || p.Limit > maxUserPageLimit {
+		errors["limit"] = fmt.Sprintf("limit should be between 0 and %d", maxUserPageLimit)
+	}
+	if p.After < 0 {
+		errors["after"] = "after should not be negative"
+	}
+	if len(p.Name) > maxUserFilterLen {
+		errors["name"] = fmt.Sprintf("name should be at most %d characters", maxUserFilterLen)
+	}
+	if len(p.Email) > maxUserFilterLen {
+		errors["email"] = fmt.Sprintf("email should be at most %d characters", maxUserFilterLen)
+	}
+	return errors
 }
 
 type GetUserParams struct {
@@ -40,28 +73,47 @@ type DeleteUserParams struct {
 	ID int `json:"id"`
 }
 
+// UpdateUserParams is the full editable representation of a user: PUT
+// replaces it as a whole and PATCH documents are applied to it.
 type UpdateUserParams struct {
-	FirstName string `db:"first_name" json:"firstName,omitempty"`
-	LastName  string `db:"last_name" json:"lastName,omitempty"`
-	Email     string `db:"email" json:"email,omitempty"`
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+	Email     string `json:"email"`
+}
+
+func UpdateUserParamsFromUser(user *User) UpdateUserParams {
+	return UpdateUserParams{
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		Email:     user.Email,
+	}
 }
 
 func (params UpdateUserParams) Validate() map[string]string {
 	errors := map[string]string{}
 
-	if params.FirstName != "" && len(params.FirstName) < minFirstNameLen {
+	if len(params.FirstName) < minFirstNameLen {
 		errors["firstName"] = fmt.Sprintf("firstName length should be at least %d characters", minFirstNameLen)
 	}
-	if params.LastName != "" && len(params.LastName) < minLastNameLen {
+	if len(params.LastName) < minLastNameLen {
 		errors["lastName"] = fmt.Sprintf("lastName length should be at least %d characters", minLastNameLen)
 	}
-	if params.Email != "" && !isEmailValid(params.Email) {
+	if !isEmailValid(params.Email) {
 		errors["email"] = "invalid email present"
 	}
 
 	return errors
 }
 
+// Columns maps the params to the user columns they replace.
+func (params UpdateUserParams) Columns() map[string]any {
+	return map[string]any{
+		"first_name": params.FirstName,
+		"last_name":  params.LastName,
+		"email":      params.Email,
+	}
+}
+
 func (params GetUserParams) Validate() map[string]string {
 	errors := map[string]string{}
 	if params.ID == 0 {
@@ -95,8 +147,11 @@ func (params CreateUserParams) Validate() map[string]string {
 	return errors
 }
 
+const emailPattern = `^[a-z0-9._%+\-]+@[a-z0-9.\-]+\.[a-z]{2,4}$`
+
+var emailRegex = regexp.MustCompile(emailPattern)
+
 func isEmailValid(email string) bool {
-	emailRegex := regexp.MustCompile(`^[a-z0-9._%+\-]+@[a-z0-9.\-]+\.[a-z]{2,4}$`)
 	return emailRegex.MatchString(email)
 }
 
@@ -0,0 +1,140 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"time"
+)
+
+// Events a webhook can subscribe to.
+const (
+	WebhookUserCreated = "user.created"
+	WebhookUserUpdated = "user.updated"
+	WebhookUserDeleted = "user.deleted"
+)
+
+// Delivery states. A pending delivery is retried until it succeeds or runs out
+// of attempts and is dead-lettered.
+const (
+	WebhookPending   = "pending"
+	WebhookDelivered = "delivered"
+	WebhookDead      = "dead"
+)
+
+const (
+	minWebhookSecretLen = 16
+	maxWebhookURLLen    = 2048
+
+	maxWebhookDeliveryLimit     = 500
+	defaultWebhookDeliveryLimit = 50
+)
+
+var WebhookEvents = []string{WebhookUserCreated, WebhookUserUpdated, WebhookUserDeleted}
+
+// Webhook is a subscription of a URL to user events. The secret signs every
+// delivery and is never sent back.
+type Webhook struct {
+	ID        int       `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"-"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// WebhookParams creates or replaces a webhook. Active defaults to true.
+type WebhookParams struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Secret string   `json:"secret"`
+	Active *bool    `json:"active"`
+}
+
+func (params WebhookParams) Validate() map[string]string {
+	errors := map[string]string{}
+	if u, err := url.Parse(params.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errors["url"] = "url should be an absolute http or https URL"
+	} else if len(params.URL) > maxWebhookURLLen {
+		errors["url"] = fmt.Sprintf("url should be at most %d characters", maxWebhookURLLen)
+	}
+	if len(params.Events) == 0 {
+		errors["events"] = "events should not be empty"
+	}
+	for _, event := range params.Events {
+		if !slices.Contains(WebhookEvents, event) {
+			errors["events"] = fmt.Sprintf("unknown event %q", event)
+		}
+	}
+	if len(params.Secret) < minWebhookSecretLen {
+		errors["secret"] = fmt.Sprintf("secret length should be at least %d characters", minWebhookSecretLen)
+	}
+	return errors
+}
+
+func (params WebhookParams) Webhook() *Webhook {
+	active := params.Active == nil || *params.Active
+	return &Webhook{
+		URL:    params.URL,
+		Events: slices.Compact(slices.Sorted(slices.Values(params.Events))),
+		Secret: params.Secret,
+		Active: active,
+	}
+}
+
+// WebhookPayload is the body of every delivery.
+type WebhookPayload struct {
+	Event      string    `json:"event"`
+	OccurredAt time.Time `json:"occurredAt"`
+	User       *User     `json:"user"`
+}
+
+// WebhookDelivery is one event to send to one webhook. URL and Secret are
+// those of the webhook when the delivery was claimed.
+type WebhookDelivery struct {
+	ID             int64           `json:"id"`
+	WebhookID      int             `json:"webhookId"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"nextAttemptAt"`
+	LastStatusCode *int            `json:"lastStatusCode,omitempty"`
+	LastError      string          `json:"lastError,omitempty"`
+	CreatedAt      time.Time       `json:"createdAt"`
+	DeliveredAt    *time.Time      `json:"deliveredAt,omitempty"`
+
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
+
+// WebhookDeliveryFilter lists deliveries newest first.
+type WebhookDeliveryFilter struct {
+	WebhookID int    `query:"webhookId"`
+	Status    string `query:"status"`
+	Limit     int    `query:"limit"`
+	Offset    int    `query:"offset"`
+}
+
+func (f WebhookDeliveryFilter) Validate() map[string]string {
+	errors := map[string]string{}
+	if f.Status != "" && !slices.Contains([]string{WebhookPending, WebhookDelivered, WebhookDead}, f.Status) {
+		errors["status"] = fmt.Sprintf("status should be one of %s, %s or %s", WebhookPending, WebhookDelivered, WebhookDead)
+	}
+	if f.Limit < 0 || f.Limit > maxWebhookDeliveryLimit {
+		errors["limit"] = fmt.Sprintf("limit should be between 0 and %d", maxWebhookDeliveryLimit)
+	}
+	if f.Offset < 0 {
+		errors["offset"] = "offset should not be negative"
+	}
+	return errors
+}
+
+// WithDefaults fills in the page size when the client did not ask for one.
+func (f WebhookDeliveryFilter) WithDefaults() WebhookDeliveryFilter {
+	if f.Limit == 0 {
+		f.Limit = defaultWebhookDeliveryLimit
+	}
+	return f
+}
@@ -0,0 +1,85 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"syscall"
+)
+
+// ErrForbiddenTarget is returned for webhook URLs that resolve to an address
+// deliveries may not be sent to.
+var ErrForbiddenTarget = errors.New("webhook target address is not allowed")
+
+// TargetPolicy decides where deliveries may be sent. Unless AllowPrivate is
+// set, loopback, private, link-local and unspecified addresses are refused, so
+// that a webhook cannot reach the services next to the API. The policy is
+// checked when a webhook is created and again on every connection the worker
+// makes, after DNS resolution.
+type TargetPolicy struct {
+	AllowPrivate bool
+	// LookupIP resolves host names; nil uses net.DefaultResolver.
+	LookupIP func(ctx context.Context, host string) ([]net.IP, error)
+}
+
+// Allowed reports whether deliveries may be sent to ip.
+func (p TargetPolicy) Allowed(ip netip.Addr) bool {
+	if p.AllowPrivate {
+		return true
+	}
+	ip = ip.Unmap()
+	return ip.IsValid() && !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsUnspecified() &&
+		!ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() && !ip.IsInterfaceLocalMulticast()
+}
+
+// CheckURL resolves the host of rawURL and fails if any of its addresses is
+// not allowed.
+func (p TargetPolicy) CheckURL(ctx context.Context, rawURL string) error {
+	if p.AllowPrivate {
+		return nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	host := u.Hostname()
+	if ip, err := netip.ParseAddr(host); err == nil {
+		if !p.Allowed(ip) {
+			return ErrForbiddenTarget
+		}
+		return nil
+	}
+	lookup := p.LookupIP
+	if lookup == nil {
+		lookup = func(ctx context.Context, host string) ([]net.IP, error) {
+			return net.DefaultResolver.LookupIP(ctx, "ip", host)
+		}
+	}
+	ips, err := lookup(ctx, host)
+	if err != nil {
+		return fmt.Errorf("resolve %s: %w", host, err)
+	}
+	for _, ip := range ips {
+		addr, ok := netip.AddrFromSlice(ip)
+		if !ok || !p.Allowed(addr) {
+			return ErrForbiddenTarget
+		}
+	}
+	return nil
+}
+
+// control is a net.Dialer Control function that refuses connections to
+// addresses that are not allowed, whatever the host name resolved to.
+func (p TargetPolicy) control(_, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !p.Allowed(addrPort.Addr()) {
+		return fmt.Errorf("%w: %s", ErrForbiddenTarget, addrPort.Addr())
+	}
+	return nil
+}
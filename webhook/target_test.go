@@ -0,0 +1,57 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"testing"
+)
+
+func TestTargetPolicy(t *testing.T) {
+	var p TargetPolicy
+	for addr, want := range map[string]bool{
+		"93.184.216.34":    true,
+		"2606:2800::1":     true,
+		"127.0.0.1":        false,
+		"::1":              false,
+		"10.1.2.3":         false,
+		"172.17.0.1":       false,
+		"192.168.1.1":      false,
+		"169.254.169.254":  false,
+		"fe80::1":          false,
+		"0.0.0.0":          false,
+		"::ffff:127.0.0.1": false,
+	} {
+		if got := p.Allowed(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("Allowed(%s) = %v, want %v", addr, got, want)
+		}
+	}
+	if !(TargetPolicy{AllowPrivate: true}).Allowed(netip.MustParseAddr("127.0.0.1")) {
+		t.Error("expected AllowPrivate to allow loopback")
+	}
+}
+
+func TestTargetPolicyCheckURL(t *testing.T) {
+	p := TargetPolicy{LookupIP: func(_ context.Context, host string) ([]net.IP, error) {
+		switch host {
+		case "public.example.com":
+			return []net.IP{net.ParseIP("93.184.216.34")}, nil
+		case "internal.example.com":
+			return []net.IP{net.ParseIP("93.184.216.34"), net.ParseIP("10.0.0.5")}, nil
+		}
+		return nil, errors.New("no such host")
+	}}
+	ctx := context.Background()
+	if err := p.CheckURL(ctx, "https://public.example.com/hook"); err != nil {
+		t.Errorf("expected a public host to be allowed, got %v", err)
+	}
+	for _, url := range []string{"https://internal.example.com/hook", "http://127.0.0.1:8080/", "http://[::1]/"} {
+		if err := p.CheckURL(ctx, url); !errors.Is(err, ErrForbiddenTarget) {
+			t.Errorf("%s: expected ErrForbiddenTarget, got %v", url, err)
+		}
+	}
+	if err := p.CheckURL(ctx, "https://unknown.example.com/"); err == nil {
+		t.Error("expected an unresolvable host to fail")
+	}
+}
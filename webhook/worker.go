@@ -0,0 +1,182 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"fiber/store"
+	"fiber/types"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type Config struct {
+	// MaxAttempts is how many times a delivery is sent before it is dead-lettered.
+	MaxAttempts int
+	// Backoff is the delay before the first retry. It doubles after every
+	// failed attempt, up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Timeout bounds each request to a webhook.
+	Timeout time.Duration
+	// PollInterval is how often the outbox is checked for due deliveries.
+	PollInterval time.Duration
+	// BatchSize is how many deliveries are claimed, and sent concurrently, at once.
+	BatchSize int
+	// AllowPrivateTargets lets deliveries reach loopback, private and
+	// link-local addresses; see TargetPolicy.
+	AllowPrivateTargets bool
+}
+
+func DefaultConfig() Config {
+	return Config{
+		MaxAttempts:  8,
+		Backoff:      30 * time.Second,
+		MaxBackoff:   time.Hour,
+		Timeout:      10 * time.Second,
+		PollInterval: 5 * time.Second,
+		BatchSize:    10,
+	}
+}
+
+// Worker sends the deliveries of the webhook outbox. Several workers, in one
+// process or across replicas, can share the same outbox.
+type Worker struct {
+	outbox store.WebhookOutbox
+	cfg    Config
+	client *http.Client
+	logger *slog.Logger
+	now    func() time.Time
+}
+
+func NewWorker(outbox store.WebhookOutbox, cfg Config) *Worker {
+	policy := TargetPolicy{AllowPrivate: cfg.AllowPrivateTargets}
+	dialer := &net.Dialer{Timeout: cfg.Timeout, Control: policy.control}
+	return &Worker{
+		outbox: outbox,
+		cfg:    cfg,
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+			// No proxy, so that the dialer checks the address of the receiver.
+			Transport: &http.Transport{
+				DialContext:         dialer.DialContext,
+				ForceAttemptHTTP2:   true,
+				MaxIdleConns:        100,
+				IdleConnTimeout:     90 * time.Second,
+				TLSHandshakeTimeout: 10 * time.Second,
+			},
+			// A redirect is not a delivery: the receiver must answer itself.
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		logger: slog.Default(),
+		now:    time.Now,
+	}
+}
+
+// Run sends due deliveries every PollInterval until ctx is done.
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Keep going while full batches come back, there may be more due.
+		for {
+			sent, err := w.SendDue(ctx)
+			if err != nil {
+				w.logger.ErrorContext(ctx, "error to claim webhook deliveries", "error", err.Error())
+			}
+			if err != nil || sent < w.cfg.BatchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SendDue claims one batch of due deliveries, sends them and records the
+// outcome of each. It returns how many deliveries were claimed.
+func (w *Worker) SendDue(ctx context.Context) (int, error) {
+	// The lease outlasts the request, so a delivery is only claimed again
+	// once this worker has surely given up on it.
+	deliveries, err := w.outbox.ClaimWebhookDeliveries(ctx, w.cfg.BatchSize, 2*w.cfg.Timeout)
+	if err != nil {
+		return 0, err
+	}
+	var wg sync.WaitGroup
+	for _, d := range deliveries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			attempt := w.send(ctx, d)
+			if attempt.Status == types.WebhookDead {
+				w.logger.WarnContext(ctx, "webhook delivery dead-lettered", "delivery", d.ID, "webhook", d.WebhookID, "attempts", d.Attempts, "error", attempt.Error)
+			}
+			if err := w.outbox.RecordWebhookAttempt(ctx, d.ID, attempt); err != nil {
+				w.logger.ErrorContext(ctx, "error to record webhook attempt", "delivery", d.ID, "error", err.Error())
+			}
+		}()
+	}
+	wg.Wait()
+	return len(deliveries), nil
+}
+
+// send posts d to its webhook. Any 2xx answer delivers it, anything else is
+// retried until MaxAttempts.
+func (w *Worker) send(ctx context.Context, d *types.WebhookDelivery) store.WebhookAttempt {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return w.failed(d, nil, err.Error())
+	}
+	timestamp := w.now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "fiber-webhooks/1")
+	req.Header.Set(HeaderEvent, d.Event)
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(d.ID, 10))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(d.Secret, timestamp, d.Payload))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return w.failed(d, nil, err.Error())
+	}
+	// Drain a little of the body so the connection can be reused.
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return w.failed(d, &resp.StatusCode, fmt.Sprintf("unexpected status %d", resp.StatusCode))
+	}
+	return store.WebhookAttempt{Status: types.WebhookDelivered, StatusCode: &resp.StatusCode, NextAttemptAt: w.now()}
+}
+
+func (w *Worker) failed(d *types.WebhookDelivery, statusCode *int, msg string) store.WebhookAttempt {
+	attempt := store.WebhookAttempt{Status: types.WebhookPending, StatusCode: statusCode, Error: msg}
+	if d.Attempts >= w.cfg.MaxAttempts {
+		attempt.Status = types.WebhookDead
+		attempt.NextAttemptAt = w.now()
+		return attempt
+	}
+	attempt.NextAttemptAt = w.now().Add(w.backoff(d.Attempts))
+	return attempt
+}
+
+// backoff is the delay after the given number of failed attempts.
+func (w *Worker) backoff(attempts int) time.Duration {
+	delay := w.cfg.Backoff
+	for i := 1; i < attempts && delay < w.cfg.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, w.cfg.MaxBackoff)
+}
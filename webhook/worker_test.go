@@ -0,0 +1,152 @@
+package webhook
+
+import (
+	"context"
+	"fiber/store"
+	"fiber/types"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeOutbox hands out its deliveries once and records the attempts.
+type fakeOutbox struct {
+	mu         sync.Mutex
+	deliveries []*types.WebhookDelivery
+	attempts   map[int64]store.WebhookAttempt
+}
+
+func (o *fakeOutbox) ClaimWebhookDeliveries(_ context.Context, limit int, _ time.Duration) ([]*types.WebhookDelivery, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	n := min(limit, len(o.deliveries))
+	claimed := o.deliveries[:n]
+	o.deliveries = o.deliveries[n:]
+	for _, d := range claimed {
+		d.Attempts++
+	}
+	return claimed, nil
+}
+
+func (o *fakeOutbox) RecordWebhookAttempt(_ context.Context, id int64, attempt store.WebhookAttempt) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.attempts == nil {
+		o.attempts = map[int64]store.WebhookAttempt{}
+	}
+	o.attempts[id] = attempt
+	return nil
+}
+
+const testSecret = "0123456789abcdef"
+
+func testWorker(outbox *fakeOutbox, now time.Time) *Worker {
+	cfg := DefaultConfig()
+	cfg.AllowPrivateTargets = true // httptest listens on loopback
+	w := NewWorker(outbox, cfg)
+	w.now = func() time.Time { return now }
+	return w
+}
+
+func TestWorkerSignsDeliveries(t *testing.T) {
+	var got *http.Request
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	payload := []byte(`{"event":"user.created","user":{"id":7}}`)
+	outbox := &fakeOutbox{deliveries: []*types.WebhookDelivery{
+		{ID: 12, Event: types.WebhookUserCreated, Payload: payload, URL: srv.URL, Secret: testSecret},
+	}}
+	now := time.Unix(1700000000, 0)
+	sent, err := testWorker(outbox, now).SendDue(context.Background())
+	if err != nil || sent != 1 {
+		t.Fatalf("expected 1 delivery sent, got %d (%v)", sent, err)
+	}
+
+	if string(body) != string(payload) {
+		t.Errorf("expected body %s, got %s", payload, body)
+	}
+	if got.Header.Get(HeaderEvent) != types.WebhookUserCreated || got.Header.Get(HeaderDelivery) != "12" {
+		t.Errorf("unexpected headers %v", got.Header)
+	}
+	if got.Header.Get(HeaderTimestamp) != "1700000000" {
+		t.Errorf("expected the timestamp of the attempt, got %s", got.Header.Get(HeaderTimestamp))
+	}
+	if !Verify(testSecret, got.Header.Get(HeaderTimestamp), got.Header.Get(HeaderSignature), body) {
+		t.Errorf("signature %s does not verify", got.Header.Get(HeaderSignature))
+	}
+	if Verify("another secret!!", got.Header.Get(HeaderTimestamp), got.Header.Get(HeaderSignature), body) {
+		t.Error("signature verifies with the wrong secret")
+	}
+	if attempt := outbox.attempts[12]; attempt.Status != types.WebhookDelivered || *attempt.StatusCode != http.StatusNoContent {
+		t.Errorf("expected the delivery to be delivered, got %+v", attempt)
+	}
+}
+
+func TestWorkerRetriesThenDeadLetters(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/elsewhere", http.StatusFound)
+	}))
+	defer srv.Close()
+
+	cfg := DefaultConfig()
+	outbox := &fakeOutbox{deliveries: []*types.WebhookDelivery{
+		{ID: 1, Payload: []byte(`{}`), URL: srv.URL, Secret: testSecret, Attempts: 2},
+		{ID: 2, Payload: []byte(`{}`), URL: srv.URL, Secret: testSecret, Attempts: cfg.MaxAttempts - 1},
+	}}
+	now := time.Unix(1700000000, 0)
+	if _, err := testWorker(outbox, now).SendDue(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	retried := outbox.attempts[1]
+	if retried.Status != types.WebhookPending || *retried.StatusCode != http.StatusFound {
+		t.Errorf("expected a redirect to be retried, got %+v", retried)
+	}
+	// The third attempt failed, so the retry waits for Backoff doubled twice.
+	if want := now.Add(4 * cfg.Backoff); !retried.NextAttemptAt.Equal(want) {
+		t.Errorf("expected the retry at %s, got %s", want, retried.NextAttemptAt)
+	}
+	if dead := outbox.attempts[2]; dead.Status != types.WebhookDead || dead.Error == "" {
+		t.Errorf("expected the last attempt to dead-letter the delivery, got %+v", dead)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	w := NewWorker(&fakeOutbox{}, Config{Backoff: time.Second, MaxBackoff: 10 * time.Second})
+	for attempts, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 4: 8 * time.Second, 5: 10 * time.Second, 60: 10 * time.Second} {
+		if got := w.backoff(attempts); got != want {
+			t.Errorf("expected backoff %s after %d attempts, got %s", want, attempts, got)
+		}
+	}
+}
+
+func TestWorkerRefusesPrivateTargets(t *testing.T) {
+	called := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer srv.Close()
+
+	outbox := &fakeOutbox{deliveries: []*types.WebhookDelivery{
+		{ID: 1, Payload: []byte(`{}`), URL: srv.URL, Secret: testSecret},
+	}}
+	if _, err := NewWorker(outbox, DefaultConfig()).SendDue(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if called {
+		t.Error("expected the loopback receiver not to be called")
+	}
+	if attempt := outbox.attempts[1]; attempt.Status != types.WebhookPending || !strings.Contains(attempt.Error, ErrForbiddenTarget.Error()) {
+		t.Errorf("expected the attempt to fail on the address, got %+v", attempt)
+	}
+}